@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrMiss key 不存在或已过期
+	ErrMiss = errors.New("缓存未命中")
+	// ErrUnavailable 缓存服务暂时不可用，调用方应直接查库
+	ErrUnavailable = errors.New("缓存不可用")
+)
+
+// Cache 缓存存储。缓存只是数据库的副本，任何操作失败时调用方都应能退回到直接查库
+type Cache interface {
+	// Get 读取 key，不存在时返回 ErrMiss
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// GetMany 批量读取，返回值与 keys 一一对应，不存在的 key 对应 nil
+	GetMany(ctx context.Context, keys []string) ([][]byte, error)
+	// SetMany 批量写入，每个条目有各自的有效期
+	SetMany(ctx context.Context, entries []Entry) error
+	Delete(ctx context.Context, keys ...string) error
+	// Incr 将 key 中的整数加 1 并返回新值，key 不存在时从 0 开始，不设有效期
+	Incr(ctx context.Context, key string) (int64, error)
+}
+
+// Entry 批量写入的条目
+type Entry struct {
+	Key   string
+	Value []byte
+	TTL   time.Duration
+}
+
+// Broadcaster 可在多个实例之间广播消息的缓存，用于通知其他实例清除进程内缓存
+type Broadcaster interface {
+	Publish(ctx context.Context, channel, message string) error
+	// Subscribe 订阅频道，ctx 取消后关闭返回的 channel
+	Subscribe(ctx context.Context, channel string) <-chan string
+}
+
+// Noop 不缓存任何内容，所有读取都未命中
+type Noop struct{}
+
+func (Noop) Get(ctx context.Context, key string) ([]byte, error) { return nil, ErrMiss }
+
+func (Noop) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error { return nil }
+
+func (Noop) GetMany(ctx context.Context, keys []string) ([][]byte, error) {
+	return make([][]byte, len(keys)), nil
+}
+
+func (Noop) SetMany(ctx context.Context, entries []Entry) error { return nil }
+
+func (Noop) Delete(ctx context.Context, keys ...string) error { return nil }
+
+func (Noop) Incr(ctx context.Context, key string) (int64, error) { return 0, nil }
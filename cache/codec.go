@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// 缓存值的编码格式
+const (
+	FormatJSON    = "json"
+	FormatMsgpack = "msgpack"
+)
+
+// 缓存值的压缩方式
+const (
+	CompressionNone = "none"
+	CompressionZstd = "zstd"
+)
+
+var (
+	// ErrSchemaMismatch 缓存值由旧版本（或新版本）的结构写入，不能按当前结构解码
+	ErrSchemaMismatch = errors.New("缓存结构版本不一致")
+	// ErrCorrupt 缓存值格式无法识别或已损坏
+	ErrCorrupt = errors.New("缓存值无法解码")
+)
+
+// 编码后的缓存值以固定头部开始：
+//
+//	magic(1) | 头部版本(1) | 结构版本(2, 大端) | 编码格式(1) | 压缩方式(1) | 数据
+//
+// 头部记录了写入时使用的格式和压缩方式，修改配置后旧值仍可正确读取；
+// 结构版本由调用方在缓存的结构变化时递增，不一致的旧值会被当作无法解码而清除
+const (
+	frameMagic      byte = 0xCA
+	frameVersion    byte = 1
+	frameHeaderSize      = 6
+)
+
+var (
+	formatIDs      = map[string]byte{FormatJSON: 1, FormatMsgpack: 2}
+	compressionIDs = map[string]byte{CompressionNone: 0, CompressionZstd: 1}
+)
+
+// zstd 的编码器和解码器可并发使用，全局共享
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// Codec 缓存值的编解码方式
+type Codec struct {
+	Format      string // json 或 msgpack，为空时使用 msgpack
+	Compression string // none 或 zstd，为空时不压缩
+	MinCompress int    // 编码后不小于该字节数才压缩，过小的值压缩后反而更大
+}
+
+func (c Codec) format() string {
+	if c.Format == "" {
+		return FormatMsgpack
+	}
+	return c.Format
+}
+
+// Marshal 按编码格式序列化，不加头部。MessagePack 按 json 标签处理字段，与 JSON 格式的字段一致
+func (c Codec) Marshal(v interface{}) ([]byte, error) {
+	switch c.format() {
+	case FormatJSON:
+		return json.Marshal(v)
+	case FormatMsgpack:
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.SetCustomStructTag("json")
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("不支持的缓存编码格式: %s", c.Format)
+}
+
+// Unmarshal 按编码格式反序列化 Marshal 的结果
+func (c Codec) Unmarshal(data []byte, v interface{}) error {
+	switch c.format() {
+	case FormatJSON:
+		return json.Unmarshal(data, v)
+	case FormatMsgpack:
+		dec := msgpack.NewDecoder(bytes.NewReader(data))
+		dec.SetCustomStructTag("json")
+		return dec.Decode(v)
+	}
+	return fmt.Errorf("不支持的缓存编码格式: %s", c.Format)
+}
+
+// Encode 序列化并加上头部，按配置压缩
+func (c Codec) Encode(schema uint16, v interface{}) ([]byte, error) {
+	formatID, ok := formatIDs[c.format()]
+	if !ok {
+		return nil, fmt.Errorf("不支持的缓存编码格式: %s", c.Format)
+	}
+	payload, err := c.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	compression := CompressionNone
+	if c.Compression != "" {
+		compression = c.Compression
+	}
+	compressionID, ok := compressionIDs[compression]
+	if !ok {
+		return nil, fmt.Errorf("不支持的缓存压缩方式: %s", c.Compression)
+	}
+	if compression == CompressionZstd && len(payload) < c.MinCompress {
+		compressionID = compressionIDs[CompressionNone]
+	}
+
+	header := make([]byte, frameHeaderSize, frameHeaderSize+len(payload))
+	header[0], header[1] = frameMagic, frameVersion
+	binary.BigEndian.PutUint16(header[2:4], schema)
+	header[4], header[5] = formatID, compressionID
+	if compressionID == compressionIDs[CompressionZstd] {
+		return zstdEncoder.EncodeAll(payload, header), nil
+	}
+	return append(header, payload...), nil
+}
+
+// Decode 校验头部并反序列化 Encode 的结果，结构版本不一致时返回 ErrSchemaMismatch，
+// 其他无法解码的情况返回 ErrCorrupt。返回写入时使用的编解码方式
+func Decode(data []byte, schema uint16, v interface{}) (Codec, error) {
+	if len(data) < frameHeaderSize || data[0] != frameMagic || data[1] != frameVersion {
+		return Codec{}, ErrCorrupt
+	}
+	if binary.BigEndian.Uint16(data[2:4]) != schema {
+		return Codec{}, ErrSchemaMismatch
+	}
+	var c Codec
+	for name, id := range formatIDs {
+		if id == data[4] {
+			c.Format = name
+		}
+	}
+	for name, id := range compressionIDs {
+		if id == data[5] {
+			c.Compression = name
+		}
+	}
+	if c.Format == "" || c.Compression == "" {
+		return Codec{}, ErrCorrupt
+	}
+
+	payload := data[frameHeaderSize:]
+	if c.Compression == CompressionZstd {
+		var err error
+		if payload, err = zstdDecoder.DecodeAll(payload, nil); err != nil {
+			return Codec{}, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+	}
+	if err := c.Unmarshal(payload, v); err != nil {
+		return Codec{}, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return c, nil
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodec(t *testing.T) {
+	type item struct {
+		Name string `json:"name"`
+		Tags []string
+	}
+	in := item{Name: "alice", Tags: []string{"a", "b"}}
+
+	for _, c := range []Codec{
+		{Format: FormatJSON},
+		{Format: FormatMsgpack},
+		{Format: FormatMsgpack, Compression: CompressionZstd},
+		{Format: FormatJSON, Compression: CompressionZstd, MinCompress: 1 << 20},
+	} {
+		data, err := c.Encode(3, in)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		var out item
+		used, err := Decode(data, 3, &out)
+		assert.NoError(t, err)
+		assert.Equal(t, in, out)
+		assert.Equal(t, c.Format, used.Format)
+	}
+
+	// 超过阈值的值被压缩，重复内容压缩后明显变小
+	big := item{Name: string(bytes.Repeat([]byte("x"), 4096))}
+	plain, _ := Codec{}.Encode(1, big)
+	packed, _ := Codec{Compression: CompressionZstd, MinCompress: 512}.Encode(1, big)
+	assert.Less(t, len(packed), len(plain)/10)
+
+	var out item
+	_, err := Decode(plain, 2, &out)
+	assert.ErrorIs(t, err, ErrSchemaMismatch)
+	_, err = Decode([]byte(`{"name":"legacy"}`), 1, &out)
+	assert.ErrorIs(t, err, ErrCorrupt)
+	_, err = Decode(plain[:len(plain)-3], 1, &out)
+	assert.ErrorIs(t, err, ErrCorrupt)
+
+	_, err = Codec{Format: "xml"}.Encode(1, in)
+	assert.Error(t, err)
+}
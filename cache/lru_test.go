@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU(t *testing.T) {
+	c := NewLRU(2)
+	c.Set("a", 1, time.Minute)
+	c.Set("b", 2, time.Minute)
+
+	// 读取 a 后 b 成为最久未使用的条目
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	c.Set("c", 3, time.Minute)
+
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	_, ok = c.Get("c")
+	assert.True(t, ok)
+
+	c.Set("d", 4, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	_, ok = c.Get("d")
+	assert.False(t, ok)
+
+	c.Delete("a")
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+
+	stats := c.Stats()
+	assert.Equal(t, LRUStats{Size: 1, Capacity: 2, Hits: 2, Misses: 3, Evictions: 2}, stats)
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sweepInterval 清理过期条目的最小间隔
+const sweepInterval = time.Minute
+
+// Memory 进程内缓存，仅适用于单实例部署：写操作无法通知其他实例
+type Memory struct {
+	mu        sync.Mutex
+	items     map[string]memoryItem
+	lastSweep time.Time
+}
+
+type memoryItem struct {
+	value     []byte
+	expiresAt time.Time // 零值表示不过期
+}
+
+func (i memoryItem) expired(now time.Time) bool {
+	return !i.expiresAt.IsZero() && now.After(i.expiresAt)
+}
+
+func NewMemory() *Memory {
+	return &Memory{items: make(map[string]memoryItem), lastSweep: time.Now()}
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.items[key]
+	if !ok || item.expired(time.Now()) {
+		delete(m.items, key)
+		return nil, ErrMiss
+	}
+	return append([]byte(nil), item.value...), nil
+}
+
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	item := memoryItem{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		item.expiresAt = now.Add(ttl)
+	}
+	m.items[key] = item
+	m.sweep(now)
+	return nil
+}
+
+func (m *Memory) GetMany(ctx context.Context, keys []string) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i], _ = m.Get(ctx, key)
+	}
+	return values, nil
+}
+
+func (m *Memory) SetMany(ctx context.Context, entries []Entry) error {
+	for _, e := range entries {
+		m.Set(ctx, e.Key, e.Value, e.TTL)
+	}
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		delete(m.items, key)
+	}
+	return nil
+}
+
+func (m *Memory) Incr(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	if item, ok := m.items[key]; ok && !item.expired(time.Now()) {
+		var err error
+		if n, err = strconv.ParseInt(string(item.value), 10, 64); err != nil {
+			return 0, err
+		}
+	}
+	n++
+	m.items[key] = memoryItem{value: []byte(strconv.FormatInt(n, 10))}
+	return n, nil
+}
+
+// sweep 定期删除过期条目，避免只写不读的 key 一直占用内存
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, item := range m.items {
+		if item.expired(now) {
+			delete(m.items, key)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis 基于 Redis 的缓存，可在多实例间共享并广播消息。
+// 连接出错后进入降级状态：所有操作立即返回 ErrUnavailable，不再等待超时，
+// 后台定期探测，恢复后先补做降级期间失败的删除和自增，再恢复正常读写
+type Redis struct {
+	client *redis.Client
+
+	// ProbeInterval 降级期间探测的间隔，为 0 时取 1 秒
+	ProbeInterval time.Duration
+	// OnStateChange 进入降级（false）或恢复（true）时调用，可为空
+	OnStateChange func(available bool)
+
+	down atomic.Bool
+
+	mu            sync.Mutex
+	pendingDelete map[string]struct{}
+	pendingIncr   map[string]int64
+}
+
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{
+		client:        client,
+		pendingDelete: make(map[string]struct{}),
+		pendingIncr:   make(map[string]int64),
+	}
+}
+
+// Available 当前是否可用
+func (r *Redis) Available() bool {
+	return !r.down.Load()
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	if r.down.Load() {
+		return nil, ErrUnavailable
+	}
+	val, err := r.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrMiss
+	}
+	return val, r.check(err)
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if r.down.Load() {
+		return ErrUnavailable
+	}
+	return r.check(r.client.Set(ctx, key, value, ttl).Err())
+}
+
+// GetMany 使用 MGET 一次读取
+func (r *Redis) GetMany(ctx context.Context, keys []string) ([][]byte, error) {
+	if r.down.Load() {
+		return nil, ErrUnavailable
+	}
+	vals, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, r.check(err)
+	}
+	values := make([][]byte, len(keys))
+	for i, v := range vals {
+		if s, ok := v.(string); ok {
+			values[i] = []byte(s)
+		}
+	}
+	return values, nil
+}
+
+// SetMany 通过 pipeline 一次写入
+func (r *Redis) SetMany(ctx context.Context, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if r.down.Load() {
+		return ErrUnavailable
+	}
+	pipe := r.client.Pipeline()
+	for _, e := range entries {
+		pipe.Set(ctx, e.Key, e.Value, e.TTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return r.check(err)
+}
+
+// Delete 删除 key。不可用时记下这些 key，恢复后补删，避免恢复后读到降级期间已失效的旧值
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	err := ErrUnavailable
+	if !r.down.Load() {
+		err = r.check(r.client.Del(ctx, keys...).Err())
+	}
+	if errors.Is(err, ErrUnavailable) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		// 加锁前可能刚好恢复，此时补做列表已处理完，直接重试
+		if !r.down.Load() {
+			return r.check(r.client.Del(ctx, keys...).Err())
+		}
+		for _, key := range keys {
+			r.pendingDelete[key] = struct{}{}
+		}
+	}
+	return err
+}
+
+// Incr 自增。不可用时记下次数，恢复后补做
+func (r *Redis) Incr(ctx context.Context, key string) (int64, error) {
+	var n int64
+	err := ErrUnavailable
+	if !r.down.Load() {
+		n, err = r.client.Incr(ctx, key).Result()
+		err = r.check(err)
+	}
+	if errors.Is(err, ErrUnavailable) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if !r.down.Load() {
+			n, err = r.client.Incr(ctx, key).Result()
+			return n, r.check(err)
+		}
+		r.pendingIncr[key]++
+	}
+	return n, err
+}
+
+func (r *Redis) Publish(ctx context.Context, channel, message string) error {
+	if r.down.Load() {
+		return ErrUnavailable
+	}
+	return r.check(r.client.Publish(ctx, channel, message).Err())
+}
+
+// Subscribe 订阅频道，断线后由客户端自动重连，断线期间的消息会丢失
+func (r *Redis) Subscribe(ctx context.Context, channel string) <-chan string {
+	out := make(chan string)
+	sub := r.client.Subscribe(ctx, channel)
+	go func() {
+		defer close(out)
+		defer sub.Close()
+		ch := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				select {
+				case out <- msg.Payload:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// check 区分连接错误和 Redis 返回的命令错误，连接错误时进入降级状态
+func (r *Redis) check(err error) error {
+	if err == nil {
+		return nil
+	}
+	var replyErr redis.Error
+	if errors.As(err, &replyErr) {
+		return err
+	}
+	if r.down.CompareAndSwap(false, true) {
+		if r.OnStateChange != nil {
+			r.OnStateChange(false)
+		}
+		go r.probe()
+	}
+	return ErrUnavailable
+}
+
+// probe 定期探测直到 Redis 恢复
+func (r *Redis) probe() {
+	interval := r.ProbeInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	for {
+		time.Sleep(interval)
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := r.client.Ping(ctx).Err()
+		if err == nil {
+			err = r.replay(ctx)
+		}
+		cancel()
+		if err == nil {
+			if r.OnStateChange != nil {
+				r.OnStateChange(true)
+			}
+			return
+		}
+	}
+}
+
+// replay 补做降级期间失败的删除和自增，全部完成后恢复正常状态；
+// 失败时保留未完成的部分，下次探测时重试
+func (r *Redis) replay(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pendingDelete) > 0 {
+		keys := make([]string, 0, len(r.pendingDelete))
+		for key := range r.pendingDelete {
+			keys = append(keys, key)
+		}
+		if err := r.client.Del(ctx, keys...).Err(); err != nil {
+			return err
+		}
+		r.pendingDelete = make(map[string]struct{})
+	}
+	for key, n := range r.pendingIncr {
+		if err := r.client.IncrBy(ctx, key, n).Err(); err != nil {
+			return err
+		}
+		delete(r.pendingIncr, key)
+	}
+	r.down.Store(false)
+	return nil
+}
@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedis_Degraded(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	defer client.Close()
+	c := NewRedis(client)
+	c.ProbeInterval = 10 * time.Millisecond
+	ctx := context.Background()
+
+	assert.NoError(t, c.Set(ctx, "stale", []byte("v1"), time.Minute))
+	_, err := c.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrMiss)
+
+	// 断开后进入降级状态，删除和自增记下待恢复后补做
+	mr.Close()
+	_, err = c.Get(ctx, "stale")
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.False(t, c.Available())
+	assert.ErrorIs(t, c.Delete(ctx, "stale"), ErrUnavailable)
+	_, err = c.Incr(ctx, "gen")
+	assert.ErrorIs(t, err, ErrUnavailable)
+
+	assert.NoError(t, mr.Restart())
+	assert.Eventually(t, c.Available, time.Second, 10*time.Millisecond)
+	_, err = c.Get(ctx, "stale")
+	assert.ErrorIs(t, err, ErrMiss)
+	val, err := c.Get(ctx, "gen")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", string(val))
+}
+
+func TestMemory(t *testing.T) {
+	c := NewMemory()
+	ctx := context.Background()
+
+	assert.NoError(t, c.Set(ctx, "a", []byte("1"), time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	_, err := c.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrMiss)
+
+	n, err := c.Incr(ctx, "gen")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	n, _ = c.Incr(ctx, "gen")
+	assert.Equal(t, int64(2), n)
+
+	assert.NoError(t, c.Delete(ctx, "gen"))
+	_, err = c.Get(ctx, "gen")
+	assert.ErrorIs(t, err, ErrMiss)
+}
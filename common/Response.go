@@ -27,3 +27,12 @@ func Success(data interface{}, msg string, c *gin.Context) {
 func Fail(code int, msg string, c *gin.Context) {
 	Result(code, nil, msg, c)
 }
+
+// FailWithStatus 失败返回并同时设置 HTTP 状态码，用于 412 等客户端依赖 HTTP 语义的场景
+func FailWithStatus(status int, msg string, c *gin.Context) {
+	c.JSON(status, Response{
+		Code: status,
+		Data: nil,
+		Msg:  msg,
+	})
+}
@@ -0,0 +1,33 @@
+package common
+
+import (
+	"fmt"
+	"gin-crud/cache"
+)
+
+var CacheStore cache.Cache
+
+// InitCache 根据配置初始化缓存，redis 驱动需在 InitRedis 之后调用
+func InitCache() {
+	c := Conf.Cache
+	switch c.Driver {
+	case "", "redis":
+		store := cache.NewRedis(RDB)
+		store.OnStateChange = func(available bool) {
+			if available {
+				Logger.Info("Redis 缓存已恢复")
+			} else {
+				Logger.Warn("Redis 缓存不可用，降级为直接查库")
+			}
+		}
+		CacheStore = store
+	case "memory":
+		CacheStore = cache.NewMemory()
+	case "none":
+		CacheStore = cache.Noop{}
+	default:
+		panic(fmt.Sprintf("不支持的缓存驱动: %s", c.Driver))
+	}
+
+	Logger.Info("缓存初始化成功: " + c.Driver)
+}
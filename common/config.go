@@ -9,10 +9,18 @@ import (
 )
 
 type Config struct {
-	Server     Server     `mapstructure:"server"`
-	Datasource Datasource `mapstructure:"datasource"`
-	Redis      Redis      `mapstructure:"redis"`
-	Jwt        Jwt        `mapstructure:"jwt"`
+	Server     Server      `mapstructure:"server"`
+	Datasource Datasource  `mapstructure:"datasource"`
+	Redis      Redis       `mapstructure:"redis"`
+	Jwt        Jwt         `mapstructure:"jwt"`
+	User       User        `mapstructure:"user"`
+	Gdpr       Gdpr        `mapstructure:"gdpr"`
+	Storage    Storage     `mapstructure:"storage"`
+	Avatar     Avatar      `mapstructure:"avatar"`
+	Attributes []Attribute `mapstructure:"attributes"`
+	Mail       Mail        `mapstructure:"mail"`
+	Search     Search      `mapstructure:"search"`
+	Cache      Cache       `mapstructure:"cache"`
 }
 
 type Server struct {
@@ -20,13 +28,42 @@ type Server struct {
 }
 
 type Datasource struct {
-	DriverName string `mapstructure:"driverName"`
+	DriverName string `mapstructure:"driverName"` // mysql / postgres / sqlite
 	Host       string `mapstructure:"host"`
 	Port       int    `mapstructure:"port"`
 	Database   string `mapstructure:"database"`
 	Username   string `mapstructure:"username"`
 	Password   string `mapstructure:"password"`
-	Charset    string `mapstructure:"charset"`
+	Charset    string `mapstructure:"charset"` // 仅 mysql
+	SSLMode    string `mapstructure:"sslMode"` // 仅 postgres，默认 disable
+	// AutoMigrate 启动时按模型自动建表（开发模式）；关闭时需先执行 migrate up
+	AutoMigrate bool `mapstructure:"autoMigrate"`
+
+	ConnectTimeout int `mapstructure:"connectTimeout"` // 建立连接超时（秒），0 表示使用驱动默认值
+	ReadTimeout    int `mapstructure:"readTimeout"`    // 读超时（秒），仅 mysql
+	WriteTimeout   int `mapstructure:"writeTimeout"`   // 写超时（秒），仅 mysql
+
+	Pool Pool `mapstructure:"pool"`
+
+	// Replicas 只读副本，配置后查询按随机策略分发到副本，写入和事务使用主库。sqlite 不支持
+	Replicas     []Replica `mapstructure:"replicas"`
+	StickyWindow int       `mapstructure:"stickyWindow"` // 客户端写入后多长时间内该客户端的查询仍走主库（毫秒），避免读到复制延迟前的旧数据
+}
+
+// Pool 连接池参数，主库和每个副本各自一个连接池，启动后修改不生效
+type Pool struct {
+	MaxOpenConns    int `mapstructure:"maxOpenConns"`    // 最大连接数，0 表示不限制
+	MaxIdleConns    int `mapstructure:"maxIdleConns"`    // 最大空闲连接数，0 表示使用默认值 2
+	ConnMaxLifetime int `mapstructure:"connMaxLifetime"` // 连接最长使用时间（秒），0 表示不限制
+	ConnMaxIdleTime int `mapstructure:"connMaxIdleTime"` // 连接最长空闲时间（秒），0 表示不限制
+}
+
+// Replica 只读副本的地址，库名、驱动和连接池参数与主库相同，用户名密码为空时使用主库的
+type Replica struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
 }
 
 type Redis struct {
@@ -40,6 +77,103 @@ type Jwt struct {
 	Expire int    `mapstructure:"expire"`
 }
 
+type User struct {
+	TrashRetentionDays int `mapstructure:"trashRetentionDays"` // 软删除用户保留天数，0 表示不自动清理
+	TrashPurgeInterval int `mapstructure:"trashPurgeInterval"` // 自动清理任务执行间隔（分钟）
+
+	DeletionCoolingDays int `mapstructure:"deletionCoolingDays"` // 用户申请注销后的冷静期天数，0 表示立即删除
+
+	EmailChangeTTL int `mapstructure:"emailChangeTTL"` // 修改邮箱确认链接有效期（分钟）
+
+	AcceptLegacyIDs bool `mapstructure:"acceptLegacyIDs"` // 过渡期内是否仍接受自增 ID 和旧格式的 Token
+
+	UniformRegistration bool `mapstructure:"uniformRegistration"` // 注册结果统一响应，冲突时改为邮件通知
+
+	RegistrationMode string `mapstructure:"registrationMode"` // open / invite / closed，为空视为 open
+	InvitationTTL    int    `mapstructure:"invitationTTL"`    // 邀请默认有效期（小时）
+}
+
+type Mail struct {
+	Driver      string `mapstructure:"driver"` // log 或 smtp
+	Host        string `mapstructure:"host"`
+	Port        int    `mapstructure:"port"`
+	Username    string `mapstructure:"username"`
+	Password    string `mapstructure:"password"`
+	From        string `mapstructure:"from"`
+	LinkBaseURL string `mapstructure:"linkBaseURL"` // 邮件中确认/撤销链接的前缀
+}
+
+// CachePolicy 单类缓存的策略，未配置或为 0 的项使用代码中的默认值
+type CachePolicy struct {
+	TTL          int     `mapstructure:"ttl"`          // 有效期（秒）
+	NegativeTTL  int     `mapstructure:"negativeTTL"`  // 记录不存在时空值的有效期（秒），负数表示不缓存空值
+	Jitter       float64 `mapstructure:"jitter"`       // TTL 随机浮动比例，0.1 表示 ±10%，负数表示不浮动
+	EarlyRefresh float64 `mapstructure:"earlyRefresh"` // 临近过期时提前刷新的力度（XFetch beta），负数表示关闭
+}
+
+type Cache struct {
+	Driver          string                 `mapstructure:"driver"`          // redis / memory / none，memory 仅适用于单实例部署
+	Codec           string                 `mapstructure:"codec"`           // 缓存值编码格式：msgpack / json
+	Compression     string                 `mapstructure:"compression"`     // 缓存值压缩方式：none / zstd
+	CompressMinSize int                    `mapstructure:"compressMinSize"` // 编码后不小于该字节数才压缩
+	WriteThrough    bool                   `mapstructure:"writeThrough"`    // 更新用户后直接写入新值，而不是删除缓存等下次读取时回源
+	Local           LocalCache             `mapstructure:"local"`
+	Policies        map[string]CachePolicy `mapstructure:"policies"` // 按缓存类别（user、user_pid、user_groups）配置
+}
+
+// LocalCache 位于 Redis 之前的进程内缓存，写操作通过 Redis 发布订阅通知所有实例清除本地副本
+type LocalCache struct {
+	Size int `mapstructure:"size"` // 最多缓存的条目数，0 表示不启用，启动后修改不生效
+	TTL  int `mapstructure:"ttl"`  // 本地副本有效期（秒），不超过 Redis 中的剩余有效期；通知丢失时以此兜底
+}
+
+type Search struct {
+	Driver string `mapstructure:"driver"` // mysql 或 memory
+}
+
+type Gdpr struct {
+	ExportDir      string `mapstructure:"exportDir"`      // 数据导出 ZIP 存放目录
+	ExportTTLHours int    `mapstructure:"exportTTLHours"` // 导出文件保留时长（小时）
+}
+
+type Storage struct {
+	Driver     string       `mapstructure:"driver"`     // local 或 s3
+	SignSecret string       `mapstructure:"signSecret"` // 本地存储 URL 签名密钥，为空时使用 jwt.secret
+	URLExpire  int          `mapstructure:"urlExpire"`  // 签名 URL 有效期（秒）
+	Local      LocalStorage `mapstructure:"local"`
+	S3         S3Storage    `mapstructure:"s3"`
+}
+
+type LocalStorage struct {
+	Dir     string `mapstructure:"dir"`
+	BaseURL string `mapstructure:"baseURL"` // 对外访问前缀，路径部分需与路由一致
+}
+
+type S3Storage struct {
+	Endpoint  string `mapstructure:"endpoint"`
+	AccessKey string `mapstructure:"accessKey"`
+	SecretKey string `mapstructure:"secretKey"`
+	Bucket    string `mapstructure:"bucket"`
+	Region    string `mapstructure:"region"`
+	UseSSL    bool   `mapstructure:"useSSL"`
+}
+
+type Avatar struct {
+	MaxSize        int64 `mapstructure:"maxSize"`        // 上传文件大小上限（字节）
+	MaxDimension   int   `mapstructure:"maxDimension"`   // 原图保存时的最大边长
+	ThumbnailSizes []int `mapstructure:"thumbnailSizes"` // 生成的正方形缩略图边长
+}
+
+// Attribute 用户自定义属性定义，值保存在 users.attributes JSON 列中
+type Attribute struct {
+	Name        string   `mapstructure:"name"`
+	Type        string   `mapstructure:"type"` // string / int / number / bool
+	Required    bool     `mapstructure:"required"`
+	Pattern     string   `mapstructure:"pattern"` // 仅 string 类型，正则表达式
+	Enum        []string `mapstructure:"enum"`    // 可选值，按字符串形式比较
+	Description string   `mapstructure:"description"`
+}
+
 // 全局配置变量
 var Conf *Config
 
@@ -1,24 +1,255 @@
 package common
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"gin-crud/migrate"
 	"gin-crud/models"
+	"strings"
+	"time"
 
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
 )
 
 var DB *gorm.DB
 
 func InitDB() {
-	c := Conf.Datasource
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=True&loc=Local",
-		c.Username, c.Password, c.Host, c.Port, c.Database, c.Charset)
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	db, err := OpenDB(Conf.Datasource)
 	if err != nil {
 		panic("数据库连接失败: " + err.Error())
 	}
-	// 自动迁移
-	db.AutoMigrate(&models.User{})
+	if Conf.Datasource.AutoMigrate {
+		Logger.Warn("已启用 AutoMigrate，表结构按模型自动更新，仅用于开发环境")
+		if err := AutoMigrate(db); err != nil {
+			panic("数据库迁移失败: " + err.Error())
+		}
+	} else if err := checkSchema(db); err != nil {
+		panic(err.Error())
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		panic("数据库连接失败: " + err.Error())
+	}
+	dbPools = []namedPool{{name: "primary", db: sqlDB}}
+	if err := useReplicas(db, Conf.Datasource); err != nil {
+		panic("只读副本连接失败: " + err.Error())
+	}
 	DB = db
 }
+
+// OpenDB 按 driverName 连接 mysql（默认）、postgres 或 sqlite，并按 pool 设置连接池。
+// sqlite 的 database 为文件路径，:memory: 为内存数据库。只连接主库，不包括副本
+func OpenDB(c Datasource) (*gorm.DB, error) {
+	dialector, err := newDialector(c, nil)
+	if err != nil {
+		return nil, err
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	if c.DriverName == "sqlite" {
+		// SQLite 同一时间只允许一个写入者，单连接避免 database is locked；
+		// 内存数据库每个连接互相独立，也必须只用一个连接
+		sqlDB.SetMaxOpenConns(1)
+		return db, nil
+	}
+	sqlDB.SetMaxOpenConns(c.Pool.MaxOpenConns)
+	if c.Pool.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(c.Pool.MaxIdleConns)
+	}
+	sqlDB.SetConnMaxLifetime(time.Duration(c.Pool.ConnMaxLifetime) * time.Second)
+	sqlDB.SetConnMaxIdleTime(time.Duration(c.Pool.ConnMaxIdleTime) * time.Second)
+	return db, nil
+}
+
+// newDialector 按配置创建 Dialector，conn 不为空时复用已建立的连接池
+func newDialector(c Datasource, conn gorm.ConnPool) (gorm.Dialector, error) {
+	switch c.DriverName {
+	case "", "mysql":
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=True&loc=Local",
+			c.Username, c.Password, c.Host, c.Port, c.Database, c.Charset)
+		if c.ConnectTimeout > 0 {
+			dsn += fmt.Sprintf("&timeout=%ds", c.ConnectTimeout)
+		}
+		if c.ReadTimeout > 0 {
+			dsn += fmt.Sprintf("&readTimeout=%ds", c.ReadTimeout)
+		}
+		if c.WriteTimeout > 0 {
+			dsn += fmt.Sprintf("&writeTimeout=%ds", c.WriteTimeout)
+		}
+		return mysql.New(mysql.Config{DSN: dsn, Conn: conn}), nil
+	case "postgres":
+		sslMode := c.SSLMode
+		if sslMode == "" {
+			sslMode = "disable"
+		}
+		dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s TimeZone=Local",
+			c.Host, c.Port, c.Username, c.Password, c.Database, sslMode)
+		if c.ConnectTimeout > 0 {
+			dsn += fmt.Sprintf(" connect_timeout=%d", c.ConnectTimeout)
+		}
+		return postgres.New(postgres.Config{DSN: dsn, Conn: conn}), nil
+	case "sqlite":
+		return &sqlite.Dialector{DSN: c.Database + "?_busy_timeout=5000", Conn: conn}, nil
+	default:
+		return nil, fmt.Errorf("不支持的数据库驱动: %s", c.DriverName)
+	}
+}
+
+// useReplicas 连接配置中的只读副本并注册读写分离：查询随机分发到副本，写入、事务和
+// 带 dbresolver.Write 的查询使用主库。副本沿用主库的库名、驱动和连接池参数
+func useReplicas(db *gorm.DB, c Datasource) error {
+	if len(c.Replicas) == 0 {
+		return nil
+	}
+	if c.DriverName == "sqlite" {
+		return errors.New("sqlite 不支持只读副本")
+	}
+	replicas := make([]gorm.Dialector, 0, len(c.Replicas))
+	for _, r := range c.Replicas {
+		rc := c
+		rc.Host, rc.Port = r.Host, r.Port
+		if r.Username != "" {
+			rc.Username, rc.Password = r.Username, r.Password
+		}
+		replicaDB, err := OpenDB(rc)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", r.Host, r.Port, err)
+		}
+		sqlDB, err := replicaDB.DB()
+		if err != nil {
+			return err
+		}
+		dialector, _ := newDialector(rc, sqlDB)
+		replicas = append(replicas, dialector)
+		dbPools = append(dbPools, namedPool{name: fmt.Sprintf("replica %s:%d", r.Host, r.Port), db: sqlDB})
+	}
+	return db.Use(dbresolver.Register(dbresolver.Config{Replicas: replicas}))
+}
+
+// namedPool 连接池及其名称，用于输出统计
+type namedPool struct {
+	name string
+	db   *sql.DB
+}
+
+// dbPools 主库和各副本的连接池，由 InitDB 设置
+var dbPools []namedPool
+
+// PoolStats 单个连接池的统计
+type PoolStats struct {
+	Name              string `json:"name"`
+	MaxOpen           int    `json:"max_open"`             // 最大连接数，0 表示不限制
+	Open              int    `json:"open"`                 // 当前连接数
+	InUse             int    `json:"in_use"`               // 使用中的连接数
+	Idle              int    `json:"idle"`                 // 空闲连接数
+	WaitCount         int64  `json:"wait_count"`           // 累计等待连接的次数
+	WaitDurationMs    int64  `json:"wait_duration_ms"`     // 累计等待时长（毫秒）
+	MaxIdleClosed     int64  `json:"max_idle_closed"`      // 因超出空闲连接数而关闭的连接数
+	MaxIdleTimeClosed int64  `json:"max_idle_time_closed"` // 因空闲超时而关闭的连接数
+	MaxLifetimeClosed int64  `json:"max_lifetime_closed"`  // 因超过最长使用时间而关闭的连接数
+}
+
+// DBPoolStats 主库和各副本连接池的当前统计
+func DBPoolStats() []PoolStats {
+	stats := make([]PoolStats, 0, len(dbPools))
+	for _, p := range dbPools {
+		s := p.db.Stats()
+		stats = append(stats, PoolStats{
+			Name:              p.name,
+			MaxOpen:           s.MaxOpenConnections,
+			Open:              s.OpenConnections,
+			InUse:             s.InUse,
+			Idle:              s.Idle,
+			WaitCount:         s.WaitCount,
+			WaitDurationMs:    s.WaitDuration.Milliseconds(),
+			MaxIdleClosed:     s.MaxIdleClosed,
+			MaxIdleTimeClosed: s.MaxIdleTimeClosed,
+			MaxLifetimeClosed: s.MaxLifetimeClosed,
+		})
+	}
+	return stats
+}
+
+// AutoMigrate 按模型创建或补充表结构，不能改名或删除列，也不记录版本，只用于开发环境。
+// MySQL 检索使用的 FULLTEXT 索引无法由模型声明，与迁移 0002_users_fulltext 一样单独创建
+func AutoMigrate(db *gorm.DB) error {
+	err := db.AutoMigrate(&models.User{}, &models.AuditLog{},
+		&models.Group{}, &models.GroupMember{}, &models.GroupPermission{}, &models.Invitation{})
+	if err != nil || db.Dialector.Name() != "mysql" || db.Migrator().HasIndex("users", "ft_users_search") {
+		return err
+	}
+	return db.Exec("CREATE FULLTEXT INDEX `ft_users_search` ON `users` (`username`, `email`) WITH PARSER ngram").Error
+}
+
+// checkSchema 启动时检查是否有未执行的迁移。迁移由 migrate up 命令显式执行，
+// 避免多个实例同时启动时各自修改表结构
+func checkSchema(db *gorm.DB) error {
+	m, err := migrate.New(db)
+	if err != nil {
+		return err
+	}
+	pending, err := m.Pending()
+	if err != nil {
+		return fmt.Errorf("读取迁移记录失败: %w", err)
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("数据库有 %d 个迁移未执行（最早为 %s），请先执行 migrate up", len(pending), pending[0])
+	}
+	return nil
+}
+
+// uniqueIndexFields 唯一索引名与字段的对应关系
+var uniqueIndexFields = map[string]string{
+	"uk_users_username": "username",
+	"uk_users_email":    "email",
+	"uk_groups_name":    "name",
+}
+
+// uniqueColumnFields SQLite 的冲突信息只包含表名和列名
+var uniqueColumnFields = map[string]string{
+	"users.unique_username": "username",
+	"users.unique_email":    "email",
+	"groups.name":           "name",
+}
+
+// TranslateDBError 将驱动返回的唯一键冲突转换为 ConflictError，其它错误原样返回
+func TranslateDBError(err error) error {
+	var mysqlErr *mysqlDriver.MySQLError
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &mysqlErr) && mysqlErr.Number == 1062:
+		// 例: Duplicate entry 'bob' for key 'users.uk_users_username'
+		return conflictError(mysqlErr.Message, uniqueIndexFields)
+	case errors.As(err, &pgErr) && pgErr.Code == "23505":
+		return conflictError(pgErr.ConstraintName, uniqueIndexFields)
+	case err != nil && strings.HasPrefix(err.Error(), "UNIQUE constraint failed"):
+		// SQLite 驱动只能按错误信息识别，不引用驱动的错误类型以免禁用 cgo 时无法编译。
+		// 例: UNIQUE constraint failed: users.unique_username
+		return conflictError(err.Error(), uniqueColumnFields)
+	}
+	return err
+}
+
+// conflictError 在驱动的错误信息中查找索引名或列名，确定冲突的字段
+func conflictError(message string, fields map[string]string) error {
+	for key, field := range fields {
+		if strings.Contains(message, key) {
+			return &ConflictError{Field: field}
+		}
+	}
+	return &ConflictError{Field: "unknown"}
+}
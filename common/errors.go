@@ -0,0 +1,22 @@
+package common
+
+import "fmt"
+
+// fieldLabels 字段的中文名称，用于错误提示
+var fieldLabels = map[string]string{
+	"username": "用户名",
+	"email":    "邮箱",
+	"name":     "组名",
+}
+
+// ConflictError 唯一约束冲突，Field 为冲突的字段名
+type ConflictError struct {
+	Field string
+}
+
+func (e *ConflictError) Error() string {
+	if label, ok := fieldLabels[e.Field]; ok {
+		return label + "已存在"
+	}
+	return fmt.Sprintf("%s 已存在", e.Field)
+}
@@ -9,20 +9,22 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// MyClaims 自定义声明结构体
+// MyClaims 自定义声明结构体，用户的公开 ID 放在标准声明 sub 中
 type MyClaims struct {
-	UserID               uint   `json:"user_id"`
+	UserID               uint   `json:"user_id,omitempty"` // 已废弃：旧版 Token 中的自增 ID，仅在过渡期内识别
 	Username             string `json:"username"`
+	SessionID            string `json:"sid,omitempty"` // 所属会话（由 Refresh Token 派生）
 	jwt.RegisteredClaims        // 内置的标准声明
 }
 
-// GenerateAccessToken 生成短效 Access Token (JWT)
-func GenerateAccessToken(userID uint, username string) (string, error) {
+// GenerateAccessToken 生成短效 Access Token (JWT)，publicID 为用户的公开 ID
+func GenerateAccessToken(publicID, username, sessionID string) (string, error) {
 	var MySecret = []byte(Conf.Jwt.Secret)
 	claims := MyClaims{
-		userID,
-		username,
-		jwt.RegisteredClaims{
+		Username:  username,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: publicID,
 			// 设置 15 分钟后过期 (短效)
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
 			Issuer:    "gin-crud",
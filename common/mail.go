@@ -0,0 +1,29 @@
+package common
+
+import (
+	"fmt"
+	"gin-crud/mail"
+)
+
+var Mailer mail.Mailer
+
+// InitMailer 根据配置初始化邮件发送
+func InitMailer() {
+	c := Conf.Mail
+	switch c.Driver {
+	case "smtp":
+		Mailer = &mail.SMTPMailer{
+			Host:     c.Host,
+			Port:     c.Port,
+			Username: c.Username,
+			Password: c.Password,
+			From:     c.From,
+		}
+	case "", "log":
+		Mailer = &mail.LogMailer{Logger: Logger}
+	default:
+		panic(fmt.Sprintf("不支持的邮件驱动: %s", c.Driver))
+	}
+
+	Logger.Info("邮件发送初始化成功: " + c.Driver)
+}
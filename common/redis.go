@@ -2,14 +2,16 @@ package common
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
 )
 
 var RDB *redis.Client
 
+// InitRedis 初始化 Redis 客户端。连接失败时不退出：缓存降级为直接查库，
+// 客户端在 Redis 恢复后自动重连；会话等依赖 Redis 的功能在此期间不可用
 func InitRedis() {
 	RDB = redis.NewClient(&redis.Options{
 		Addr:     Conf.Redis.Addr,
@@ -21,9 +23,9 @@ func InitRedis() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := RDB.Ping(ctx).Result()
-	if err != nil {
-		panic(fmt.Sprintf("Redis 连接失败: %v", err))
+	if err := RDB.Ping(ctx).Err(); err != nil {
+		Logger.Error("Redis 连接失败，将在恢复后自动重连", zap.Error(err))
+		return
 	}
 
 	Logger.Info("Redis 连接成功")
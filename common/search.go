@@ -0,0 +1,39 @@
+package common
+
+import (
+	"fmt"
+	"gin-crud/search"
+)
+
+var SearchIndex search.Index
+
+// InitSearch 根据配置初始化用户检索，需在 InitDB 之后调用
+func InitSearch() {
+	c := Conf.Search
+	var err error
+	driver := c.Driver
+	if driver == "" {
+		// 全文索引依赖 MySQL，其他数据库默认使用进程内索引
+		driver = "memory"
+		if DB.Dialector.Name() == "mysql" {
+			driver = "mysql"
+		}
+	}
+	switch driver {
+	case "mysql":
+		if DB.Dialector.Name() != "mysql" {
+			err = fmt.Errorf("mysql 检索驱动需要 MySQL 数据库，当前为 %s", DB.Dialector.Name())
+			break
+		}
+		SearchIndex, err = search.NewMySQLIndex(DB)
+	case "memory":
+		SearchIndex = search.NewMemoryIndex()
+	default:
+		err = fmt.Errorf("不支持的检索驱动: %s", driver)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("用户检索初始化失败: %v", err))
+	}
+
+	Logger.Info("用户检索初始化成功: " + driver)
+}
@@ -0,0 +1,42 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"gin-crud/storage"
+	"time"
+)
+
+var Blob storage.BlobStore
+
+// InitStorage 根据配置初始化对象存储
+func InitStorage() {
+	c := Conf.Storage
+	var err error
+	switch c.Driver {
+	case "s3":
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		Blob, err = storage.NewS3Store(ctx, storage.S3Options{
+			Endpoint:  c.S3.Endpoint,
+			AccessKey: c.S3.AccessKey,
+			SecretKey: c.S3.SecretKey,
+			Bucket:    c.S3.Bucket,
+			Region:    c.S3.Region,
+			UseSSL:    c.S3.UseSSL,
+		})
+	case "", "local":
+		secret := c.SignSecret
+		if secret == "" {
+			secret = Conf.Jwt.Secret
+		}
+		Blob, err = storage.NewLocalStore(c.Local.Dir, c.Local.BaseURL, secret)
+	default:
+		err = fmt.Errorf("不支持的存储驱动: %s", c.Driver)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("对象存储初始化失败: %v", err))
+	}
+
+	Logger.Info("对象存储初始化成功: " + c.Driver)
+}
@@ -0,0 +1,428 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"gin-crud/common"
+	"gin-crud/models"
+	"gin-crud/service"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parsePage 解析分页参数，默认第 1 页、每页 20 条，每页最多 100 条
+func parsePage(c *gin.Context) (int, int) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	size, err := strconv.Atoi(c.DefaultQuery("size", "20"))
+	if err != nil || size < 1 {
+		size = 20
+	}
+	if size > 100 {
+		size = 100
+	}
+	return page, size
+}
+
+// ListDeletedUsers 回收站用户列表
+// @Summary      回收站用户列表
+// @Description  分页查看已软删除的用户
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        page  query     int  false  "页码"  default(1)
+// @Param        size  query     int  false  "每页数量"  default(20)
+// @Success      200   {object}  common.Response{data=object{list=[]models.User,total=int}}
+// @Failure      403   {object}  common.Response
+// @Failure      500   {object}  common.Response
+// @Router       /admin/users/trash [get]
+func ListDeletedUsers(c *gin.Context, s *service.UserService) {
+	page, size := parsePage(c)
+
+	users, total, err := s.ListDeletedUsers(page, size)
+	if err != nil {
+		common.Fail(500, "系统异常: "+err.Error(), c)
+		return
+	}
+
+	common.Success(gin.H{"list": users, "total": total}, "获取成功", c)
+}
+
+// SearchUsers 检索用户
+// @Summary      检索用户
+// @Description  按用户名或邮箱的部分内容检索未删除的用户，多个检索词用空格分隔且需全部命中。结果按相关度排序，highlights 中命中部分用 <em></em> 包裹
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        q     query     string  true   "检索词"
+// @Param        page  query     int     false  "页码"  default(1)
+// @Param        size  query     int     false  "每页数量"  default(20)
+// @Success      200   {object}  common.Response{data=object{list=[]service.UserSearchHit,total=int}}
+// @Failure      400   {object}  common.Response
+// @Failure      403   {object}  common.Response
+// @Failure      500   {object}  common.Response
+// @Router       /admin/users/search [get]
+func SearchUsers(c *gin.Context, s *service.UserService) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		common.Fail(400, "请输入检索词", c)
+		return
+	}
+	page, size := parsePage(c)
+
+	hits, total, err := s.SearchUsers(q, page, size)
+	if err != nil {
+		common.Fail(500, "系统异常: "+err.Error(), c)
+		return
+	}
+
+	common.Success(gin.H{"list": hits, "total": total}, "获取成功", c)
+}
+
+// RestoreUser 恢复用户
+// @Summary      恢复用户
+// @Description  从回收站恢复已软删除的用户，用户名或邮箱已被占用时无法恢复
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "User public ID"
+// @Success      200  {object}  common.Response
+// @Failure      404  {object}  common.Response
+// @Failure      409  {object}  common.Response{data=object{field=string}}
+// @Failure      500  {object}  common.Response
+// @Router       /admin/users/trash/{id}/restore [post]
+func RestoreUser(c *gin.Context, s *service.UserService) {
+	id, ok := userParam(c, s, "id")
+	if !ok {
+		return
+	}
+
+	err := s.RestoreUser(id)
+	if err != nil {
+		if failConflict(err, c) {
+			return
+		}
+		if err.Error() == "用户不存在" {
+			common.Fail(404, err.Error(), c)
+		} else {
+			common.Fail(500, "恢复失败: "+err.Error(), c)
+		}
+		return
+	}
+
+	common.Success(nil, "恢复成功", c)
+}
+
+// PurgeUser 永久删除用户
+// @Summary      永久删除用户
+// @Description  从回收站中永久删除用户，操作不可撤销
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "User public ID"
+// @Success      200  {object}  common.Response
+// @Failure      404  {object}  common.Response
+// @Failure      500  {object}  common.Response
+// @Router       /admin/users/trash/{id} [delete]
+func PurgeUser(c *gin.Context, s *service.UserService) {
+	id, ok := userParam(c, s, "id")
+	if !ok {
+		return
+	}
+
+	err := s.PurgeUser(id)
+	if err != nil {
+		if err.Error() == "用户不存在" {
+			common.Fail(404, err.Error(), c)
+		} else {
+			common.Fail(500, "删除失败: "+err.Error(), c)
+		}
+		return
+	}
+
+	common.Success(nil, "永久删除成功", c)
+}
+
+// maxImportSize 导入文件大小上限
+const maxImportSize = 10 << 20
+
+// detectImportFormat 根据 format 参数、文件扩展名或 Content-Type 判断导入格式
+func detectImportFormat(c *gin.Context, filename string) string {
+	if format := c.Query("format"); format != "" {
+		return strings.ToLower(format)
+	}
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		return service.FormatCSV
+	case ".jsonl", ".ndjson":
+		return service.FormatJSONL
+	}
+	switch c.ContentType() {
+	case "text/csv":
+		return service.FormatCSV
+	case "application/jsonl", "application/x-ndjson", "application/x-jsonlines":
+		return service.FormatJSONL
+	}
+	return ""
+}
+
+// ImportUsers 批量导入用户
+// @Summary      批量导入用户
+// @Description  上传 CSV（需包含 username,email,password 表头，可选 role）或 JSONL 文件批量创建用户。支持 multipart 的 file 字段或直接以请求体上传
+// @Tags         admin
+// @Accept       mpfd,text/csv,application/x-ndjson
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        file        formData  file    false  "导入文件"
+// @Param        format      query     string  false  "文件格式，默认根据扩展名或 Content-Type 判断"  Enums(csv, jsonl)
+// @Param        dry_run     query     bool    false  "只校验不写入"
+// @Param        pre_hashed  query     bool    false  "password 已是 bcrypt 哈希"
+// @Param        chunk_size  query     int     false  "每个事务写入的行数"  default(100)
+// @Success      200         {object}  common.Response{data=service.ImportResult}
+// @Failure      400         {object}  common.Response
+// @Failure      403         {object}  common.Response
+// @Failure      500         {object}  common.Response
+// @Router       /admin/users/import [post]
+func ImportUsers(c *gin.Context, s *service.UserService) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+
+	var body io.Reader = c.Request.Body
+	filename := ""
+	if c.ContentType() == "multipart/form-data" {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			common.Fail(400, "请上传文件: "+err.Error(), c)
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			common.Fail(400, "文件读取失败: "+err.Error(), c)
+			return
+		}
+		defer f.Close()
+		body = f
+		filename = fh.Filename
+	}
+
+	format := detectImportFormat(c, filename)
+	if format != service.FormatCSV && format != service.FormatJSONL {
+		common.Fail(400, "不支持的格式，仅支持 csv 或 jsonl", c)
+		return
+	}
+	chunkSize, _ := strconv.Atoi(c.Query("chunk_size"))
+
+	result, err := s.ImportUsers(body, service.ImportOptions{
+		Format:    format,
+		DryRun:    c.Query("dry_run") == "true",
+		PreHashed: c.Query("pre_hashed") == "true",
+		ChunkSize: chunkSize,
+	})
+	if err != nil {
+		common.Fail(400, "导入失败: "+err.Error(), c)
+		return
+	}
+
+	msg := "导入完成"
+	if result.DryRun {
+		msg = "校验完成"
+	}
+	common.Success(result, msg, c)
+}
+
+// ExportUsers 导出全部用户
+// @Summary      导出全部用户
+// @Description  以 CSV 或 JSONL 格式流式导出全部用户，不包含密码哈希
+// @Tags         admin
+// @Produce      text/csv,application/x-ndjson
+// @Security     ApiKeyAuth
+// @Param        format  query  string  false  "导出格式"  Enums(csv, jsonl)  default(csv)
+// @Success      200     {file}    file
+// @Failure      400     {object}  common.Response
+// @Failure      403     {object}  common.Response
+// @Router       /admin/users/export [get]
+func ExportUsers(c *gin.Context, s *service.UserService) {
+	format := strings.ToLower(c.DefaultQuery("format", service.FormatCSV))
+
+	var contentType string
+	switch format {
+	case service.FormatCSV:
+		contentType = "text/csv; charset=utf-8"
+	case service.FormatJSONL:
+		contentType = "application/x-ndjson"
+	default:
+		common.Fail(400, "不支持的格式，仅支持 csv 或 jsonl", c)
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="users-%s.%s"`, time.Now().Format("20060102150405"), format))
+	c.Status(200)
+
+	// 响应头已发出，导出中途出错只能记录日志并中断输出
+	if err := s.ExportUsers(c.Writer, format); err != nil {
+		common.Logger.Error("导出用户失败: " + err.Error())
+	}
+}
+
+// statusRequest 变更账号状态的请求参数
+type statusRequest struct {
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at"` // 为空表示永久，仅暂停和封禁有效
+}
+
+// changeUserStatus 变更账号状态的公共处理
+func changeUserStatus(c *gin.Context, s *service.UserService, status, successMsg string) {
+	id, ok := userParam(c, s, "id")
+	if !ok {
+		return
+	}
+
+	var req statusRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		common.Fail(400, "参数错误", c)
+		return
+	}
+	if status != models.StatusActive && req.Reason == "" {
+		common.Fail(400, "请填写原因", c)
+		return
+	}
+
+	actorID, _ := c.Get("user_id")
+	err := s.ChangeStatus(id, status, req.Reason, req.ExpiresAt, actorID.(uint))
+	if err != nil {
+		if errors.Is(err, service.ErrPreconditionFailed) {
+			common.Fail(409, err.Error(), c)
+		} else if err.Error() == "用户不存在" {
+			common.Fail(404, err.Error(), c)
+		} else {
+			common.Fail(400, err.Error(), c)
+		}
+		return
+	}
+
+	common.Success(nil, successMsg, c)
+}
+
+// SuspendUser 暂停账号
+// @Summary      暂停账号
+// @Description  暂停用户账号并注销其所有会话，可设置到期时间，到期后自动恢复
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id    path      string                                    true  "User public ID"
+// @Param        data  body      object{reason=string,expires_at=string}  true  "原因及到期时间（RFC3339，可选）"
+// @Success      200   {object}  common.Response
+// @Failure      400   {object}  common.Response
+// @Failure      404   {object}  common.Response
+// @Failure      409   {object}  common.Response
+// @Router       /admin/users/{id}/suspend [post]
+func SuspendUser(c *gin.Context, s *service.UserService) {
+	changeUserStatus(c, s, models.StatusSuspended, "账号已暂停")
+}
+
+// BanUser 封禁账号
+// @Summary      封禁账号
+// @Description  封禁用户账号并注销其所有会话，可设置到期时间，到期后自动恢复
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id    path      string                                    true  "User public ID"
+// @Param        data  body      object{reason=string,expires_at=string}  true  "原因及到期时间（RFC3339，可选）"
+// @Success      200   {object}  common.Response
+// @Failure      400   {object}  common.Response
+// @Failure      404   {object}  common.Response
+// @Failure      409   {object}  common.Response
+// @Router       /admin/users/{id}/ban [post]
+func BanUser(c *gin.Context, s *service.UserService) {
+	changeUserStatus(c, s, models.StatusBanned, "账号已封禁")
+}
+
+// ActivateUser 恢复 / 激活账号
+// @Summary      恢复或激活账号
+// @Description  将待激活、暂停或封禁的账号恢复为正常状态
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id    path      string                 true   "User public ID"
+// @Param        data  body      object{reason=string}  false  "原因"
+// @Success      200   {object}  common.Response
+// @Failure      400   {object}  common.Response
+// @Failure      404   {object}  common.Response
+// @Failure      409   {object}  common.Response
+// @Router       /admin/users/{id}/activate [post]
+func ActivateUser(c *gin.Context, s *service.UserService) {
+	changeUserStatus(c, s, models.StatusActive, "账号已恢复正常")
+}
+
+// ListAuditLogs 用户审计记录
+// @Summary      用户审计记录
+// @Description  分页查看用户的审计记录（如状态变更），按时间倒序
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id    path      string  true   "User public ID"
+// @Param        page  query     int     false  "页码"  default(1)
+// @Param        size  query     int     false  "每页数量"  default(20)
+// @Success      200   {object}  common.Response{data=object{list=[]models.AuditLog,total=int}}
+// @Failure      404   {object}  common.Response
+// @Failure      500   {object}  common.Response
+// @Router       /admin/users/{id}/audit-logs [get]
+func ListAuditLogs(c *gin.Context, s *service.UserService) {
+	id, ok := userParam(c, s, "id")
+	if !ok {
+		return
+	}
+	page, size := parsePage(c)
+
+	logs, total, err := s.ListAuditLogs(id, page, size)
+	if err != nil {
+		common.Fail(500, "系统异常: "+err.Error(), c)
+		return
+	}
+
+	common.Success(gin.H{"list": logs, "total": total}, "获取成功", c)
+}
+
+// GetCacheStats 查看缓存命中统计
+// @Summary      查看缓存命中统计
+// @Description  返回当前实例启动以来进程内缓存和共享缓存各自的命中与未命中次数，未启用进程内缓存时 local 为空；decode_failures 为因结构版本不一致或数据损坏而被清除的缓存值数量；available 为 false 表示共享缓存已降级，请求直接查库
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  common.Response{data=service.CacheStats}
+// @Failure      403  {object}  common.Response
+// @Router       /admin/cache/stats [get]
+func GetCacheStats(c *gin.Context, s *service.UserService) {
+	common.Success(s.CacheStats(), "获取成功", c)
+}
+
+// GetDBStats 查看数据库连接池统计
+// @Summary      查看数据库连接池统计
+// @Description  返回当前实例主库和各只读副本连接池的连接数与等待情况，wait_count 持续增长说明连接数不足
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  common.Response{data=[]common.PoolStats}
+// @Failure      403  {object}  common.Response
+// @Router       /admin/db/stats [get]
+func GetDBStats(c *gin.Context) {
+	common.Success(common.DBPoolStats(), "获取成功", c)
+}
@@ -1,15 +1,72 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
 	"gin-crud/common"
+	"gin-crud/models"
 	"gin-crud/service"
 
 	"github.com/gin-gonic/gin"
 )
 
+// registerRequest 注册的请求参数，只包含客户端可以设置的字段
+type registerRequest struct {
+	Username   string            `json:"username" binding:"required"`
+	Email      string            `json:"email" binding:"required,email"`
+	Password   string            `json:"password" binding:"required,min=6"`
+	Attributes models.Attributes `json:"attributes"`
+}
+
+// Register 注册接口
+// @Summary      用户注册
+// @Description  用户名和邮箱会先规范化（去除首尾空白、NFKC、大小写折叠）再保存。
+// @Description  注册方式由 user.registrationMode 控制，仅限受邀或关闭注册时返回 403，受邀用户通过 /invitations/accept 注册。
+// @Description  开启 user.uniformRegistration 时，不论用户名或邮箱是否已被占用都返回相同的成功响应（data 为空），结果通过邮件告知，不会返回 409
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        data  body      object{username=string,email=string,password=string,attributes=object}  true  "Register Data"
+// @Success      200   {object}  common.Response{data=models.User}
+// @Failure      400   {object}  common.Response
+// @Failure      403   {object}  common.Response
+// @Failure      409   {object}  common.Response{data=object{field=string}}
+// @Failure      500   {object}  common.Response
+// @Router       /register [post]
+func Register(c *gin.Context, s *service.UserService) {
+	var req registerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.Fail(400, "参数错误", c)
+		return
+	}
+	user := models.User{Username: req.Username, Email: req.Email, Password: req.Password, Attributes: req.Attributes}
+
+	if common.Conf.User.UniformRegistration {
+		if err := s.RegisterUniform(&user); err != nil {
+			if failAttribute(err, c) || failRegistration(err, c) {
+				return
+			}
+			common.Fail(500, err.Error(), c)
+			return
+		}
+		common.Success(nil, "注册申请已提交，结果将发送到您的邮箱", c)
+		return
+	}
+
+	if err := s.Register(&user); err != nil {
+		if failConflict(err, c) || failAttribute(err, c) || failRegistration(err, c) {
+			return
+		}
+		common.Fail(500, err.Error(), c)
+		return
+	}
+
+	common.Success(user, "注册成功", c)
+}
+
 // Login 登录接口
 // @Summary      用户登录
-// @Description  使用用户名和密码登录，返回 Access Token 和 Refresh Token
+// @Description  使用用户名和密码登录，返回 Access Token 和 Refresh Token。用户不存在和密码错误返回相同的错误
 // @Tags         auth
 // @Accept       json
 // @Produce      json
@@ -17,6 +74,8 @@ import (
 // @Success      200   {object}  common.Response{data=service.TokenResponse}
 // @Failure      400   {object}  common.Response
 // @Failure      401   {object}  common.Response
+// @Failure      403   {object}  common.Response{data=object{status=string,reason=string,expires_at=string}}
+// @Failure      503   {object}  common.Response
 // @Router       /login [post]
 func Login(c *gin.Context, s *service.UserService) {
 	var loginData struct {
@@ -31,6 +90,9 @@ func Login(c *gin.Context, s *service.UserService) {
 
 	tokens, err := s.Login(loginData.Username, loginData.Password)
 	if err != nil {
+		if failAccountStatus(err, c) || failUnavailable(err, c) {
+			return
+		}
 		common.Fail(401, err.Error(), c)
 		return
 	}
@@ -48,6 +110,8 @@ func Login(c *gin.Context, s *service.UserService) {
 // @Success      200   {object}  common.Response{data=object{access_token=string}}
 // @Failure      400   {object}  common.Response
 // @Failure      401   {object}  common.Response
+// @Failure      403   {object}  common.Response{data=object{status=string,reason=string,expires_at=string}}
+// @Failure      503   {object}  common.Response
 // @Router       /refresh [post]
 func RefreshToken(c *gin.Context, s *service.UserService) {
 	var req struct {
@@ -61,6 +125,9 @@ func RefreshToken(c *gin.Context, s *service.UserService) {
 
 	newAccessToken, err := s.RefreshToken(req.RefreshToken)
 	if err != nil {
+		if failAccountStatus(err, c) || failUnavailable(err, c) {
+			return
+		}
 		common.Fail(401, err.Error(), c)
 		return
 	}
@@ -96,8 +163,8 @@ func Logout(c *gin.Context, s *service.UserService) {
 	common.Success(nil, "登出成功", c)
 }
 
-// AuthMiddleware 拦截器
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware 拦截器：校验 Token，并检查账号当前是否允许访问（暂停、封禁立即生效）
+func AuthMiddleware(s *service.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token := c.GetHeader("Authorization")
 
@@ -114,9 +181,116 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		c.Set("user_id", claims.UserID)
+		// 新 Token 的 sub 为公开 ID；过渡期内仍接受只带自增 ID 的旧 Token
+		ref := claims.Subject
+		if ref == "" && claims.UserID != 0 && common.Conf.User.AcceptLegacyIDs {
+			ref = fmt.Sprintf("%d", claims.UserID)
+		}
+		if ref == "" {
+			common.Fail(401, "Token 无效或已过期", c)
+			c.Abort()
+			return
+		}
+		user, err := s.GetUser(ref)
+		if err != nil {
+			common.Fail(401, "用户不存在", c)
+			c.Abort()
+			return
+		}
+		if err := service.CheckActive(user); err != nil {
+			failAccountStatus(err, c)
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", user.ID)
 		c.Set("username", claims.Username)
+		c.Set("session_id", claims.SessionID)
+		c.Set("user", user)
 
 		c.Next()
 	}
 }
+
+// AdminMiddleware 管理员权限拦截器，需放在 AuthMiddleware 之后
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c)
+		if !ok {
+			common.Fail(401, "未登录，请先提供 Token", c)
+			c.Abort()
+			return
+		}
+
+		if user.Role != models.RoleAdmin {
+			common.Fail(403, "无权限访问", c)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission 要求当前用户通过所属组获得指定权限，管理员不受限制
+func RequirePermission(s *service.UserService, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c)
+		if !ok {
+			common.Fail(401, "未登录，请先提供 Token", c)
+			c.Abort()
+			return
+		}
+		if user.Role == models.RoleAdmin {
+			c.Next()
+			return
+		}
+
+		allowed, err := s.HasPermission(user.ID, permission)
+		if err != nil {
+			common.Fail(500, "系统异常: "+err.Error(), c)
+			c.Abort()
+			return
+		}
+		if !allowed {
+			common.Fail(403, "无权限访问", c)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// currentUserID 获取 AuthMiddleware 写入的当前用户 ID
+func currentUserID(c *gin.Context) (string, bool) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%d", userID), true
+}
+
+// currentUser 获取 AuthMiddleware 写入的当前用户
+func currentUser(c *gin.Context) (*models.User, bool) {
+	v, ok := c.Get("user")
+	if !ok {
+		return nil, false
+	}
+	user, ok := v.(*models.User)
+	return user, ok
+}
+
+// failAccountStatus 账号状态不允许访问时返回 403 及状态详情，返回值表示是否已处理
+func failAccountStatus(err error, c *gin.Context) bool {
+	var statusErr *service.AccountStatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	common.Result(403, gin.H{
+		"status":     statusErr.Status,
+		"reason":     statusErr.Reason,
+		"expires_at": statusErr.ExpiresAt,
+	}, statusErr.Error(), c)
+	return true
+}
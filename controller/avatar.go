@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"errors"
+	"gin-crud/common"
+	"gin-crud/service"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UploadMyAvatar 上传当前用户头像
+// @Summary      上传头像
+// @Description  multipart 字段 avatar，支持 JPEG/PNG/GIF/WebP。图片会去除 EXIF 等元数据并统一转为 JPEG，同时生成缩略图
+// @Tags         me
+// @Accept       multipart/form-data
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        avatar  formData  file  true  "头像图片"
+// @Success      200  {object}  common.Response{data=service.AvatarURLs}
+// @Failure      400  {object}  common.Response
+// @Failure      413  {object}  common.Response
+// @Router       /me/avatar [put]
+func UploadMyAvatar(c *gin.Context, s *service.UserService) {
+	id, _ := currentUserID(c)
+
+	// 预留 1MB 给 multipart 头部，超出时 FormFile 会失败
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, service.AvatarMaxSize()+1<<20)
+	fh, err := c.FormFile("avatar")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			common.Fail(413, "头像文件过大", c)
+			return
+		}
+		common.Fail(400, "请通过 avatar 字段上传图片", c)
+		return
+	}
+	if fh.Size > service.AvatarMaxSize() {
+		common.Fail(413, "头像文件过大", c)
+		return
+	}
+	f, err := fh.Open()
+	if err != nil {
+		common.Fail(500, "读取上传文件失败", c)
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		common.Fail(500, "读取上传文件失败", c)
+		return
+	}
+
+	urls, err := s.UploadAvatar(id, data)
+	if err != nil {
+		var invalid *service.InvalidAvatarError
+		switch {
+		case errors.As(err, &invalid):
+			common.Fail(400, err.Error(), c)
+		case err.Error() == "用户不存在":
+			common.Fail(404, err.Error(), c)
+		default:
+			common.Fail(500, "上传失败: "+err.Error(), c)
+		}
+		return
+	}
+
+	common.Success(urls, "上传成功", c)
+}
+
+// DeleteMyAvatar 删除当前用户头像
+// @Summary      删除头像
+// @Description  删除当前用户的头像及其缩略图
+// @Tags         me
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  common.Response
+// @Failure      404  {object}  common.Response
+// @Router       /me/avatar [delete]
+func DeleteMyAvatar(c *gin.Context, s *service.UserService) {
+	id, _ := currentUserID(c)
+
+	if err := s.DeleteAvatar(id); err != nil {
+		if errors.Is(err, service.ErrNoAvatar) || err.Error() == "用户不存在" {
+			common.Fail(404, err.Error(), c)
+		} else {
+			common.Fail(500, "删除失败: "+err.Error(), c)
+		}
+		return
+	}
+
+	common.Success(nil, "删除成功", c)
+}
+
+// GetUserAvatar 获取用户头像
+// @Summary      获取用户头像
+// @Description  302 重定向到头像的签名地址，size 为缩略图边长，不传时返回原图
+// @Tags         users
+// @Param        id    path   string  true   "User public ID"
+// @Param        size  query  int     false  "缩略图边长"
+// @Success      302
+// @Failure      400  {object}  common.Response
+// @Failure      404  {object}  common.Response
+// @Router       /users/{id}/avatar [get]
+func GetUserAvatar(c *gin.Context, s *service.UserService) {
+	size := 0
+	if v := c.Query("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			common.Fail(400, "size 参数错误", c)
+			return
+		}
+		size = n
+	}
+
+	user := getUserParam(c, s, "id")
+	if user == nil {
+		return
+	}
+
+	url, err := s.AvatarURL(user, size)
+	if err != nil {
+		if errors.Is(err, service.ErrNoAvatar) {
+			common.Fail(404, err.Error(), c)
+		} else if err.Error() == "不支持的头像尺寸" {
+			common.Fail(400, err.Error(), c)
+		} else {
+			common.Fail(500, "系统异常: "+err.Error(), c)
+		}
+		return
+	}
+
+	// 签名地址会过期，不允许客户端缓存重定向本身
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, url)
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"fmt"
+	"gin-crud/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userETag 根据版本号生成用户资源的 ETag
+func userETag(user *models.User) string {
+	return fmt.Sprintf(`"%d"`, user.Version)
+}
+
+// parseIfMatch 解析 If-Match 请求头，返回允许的版本号列表。
+// 未携带或为 * 时返回 nil 表示不校验；ok 为 false 表示请求头中没有任何可识别的 ETag
+func parseIfMatch(c *gin.Context) (versions []uint, ok bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return nil, true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		// If-Match 要求强比较，忽略弱 ETag
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		v, err := strconv.ParseUint(strings.Trim(tag, `"`), 10, 64)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, uint(v))
+	}
+	return versions, len(versions) > 0
+}
+
+// notModified 判断 GET 请求的 If-None-Match / If-Modified-Since 条件，未变化时返回 true。
+// 同时携带两者时按 RFC 7232 只看 If-None-Match
+func notModified(c *gin.Context, etag string, lastModified time.Time) bool {
+	if header := c.GetHeader("If-None-Match"); header != "" {
+		if strings.TrimSpace(header) == "*" {
+			return true
+		}
+		for _, tag := range strings.Split(header, ",") {
+			// If-None-Match 使用弱比较
+			if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if header := c.GetHeader("If-Modified-Since"); header != "" {
+		since, err := http.ParseTime(header)
+		if err != nil {
+			return false
+		}
+		// HTTP 日期只精确到秒
+		return !lastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// setCacheHeaders 设置用户资源的 ETag 和 Last-Modified 响应头
+func setCacheHeaders(c *gin.Context, user *models.User) {
+	c.Header("ETag", userETag(user))
+	c.Header("Last-Modified", user.UpdatedAt.UTC().Format(http.TimeFormat))
+}
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"gin-crud/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestContext(headers map[string]string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/users/1", nil)
+	for k, v := range headers {
+		c.Request.Header.Set(k, v)
+	}
+	return c
+}
+
+func TestParseIfMatch(t *testing.T) {
+	versions, ok := parseIfMatch(newTestContext(nil))
+	assert.True(t, ok)
+	assert.Nil(t, versions)
+
+	versions, ok = parseIfMatch(newTestContext(map[string]string{"If-Match": "*"}))
+	assert.True(t, ok)
+	assert.Nil(t, versions)
+
+	versions, ok = parseIfMatch(newTestContext(map[string]string{"If-Match": `"3", W/"4", "5"`}))
+	assert.True(t, ok)
+	assert.Equal(t, []uint{3, 5}, versions)
+
+	_, ok = parseIfMatch(newTestContext(map[string]string{"If-Match": `W/"4"`}))
+	assert.False(t, ok)
+}
+
+func TestNotModified(t *testing.T) {
+	user := &models.User{Version: 3}
+	user.UpdatedAt = time.Date(2024, 5, 1, 8, 0, 0, 500, time.UTC)
+	etag := userETag(user)
+
+	assert.True(t, notModified(newTestContext(map[string]string{"If-None-Match": `W/"3"`}), etag, user.UpdatedAt))
+	assert.False(t, notModified(newTestContext(map[string]string{"If-None-Match": `"2"`}), etag, user.UpdatedAt))
+	assert.True(t, notModified(newTestContext(map[string]string{"If-Modified-Since": "Wed, 01 May 2024 08:00:00 GMT"}), etag, user.UpdatedAt))
+	assert.False(t, notModified(newTestContext(map[string]string{"If-Modified-Since": "Wed, 01 May 2024 07:59:59 GMT"}), etag, user.UpdatedAt))
+	// If-None-Match 优先于 If-Modified-Since
+	assert.False(t, notModified(newTestContext(map[string]string{
+		"If-None-Match":     `"2"`,
+		"If-Modified-Since": "Wed, 01 May 2024 08:00:00 GMT",
+	}), etag, user.UpdatedAt))
+}
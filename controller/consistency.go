@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"gin-crud/service"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 客户端最近一次写请求的时间（Unix 毫秒）及其签名，浏览器通过 Cookie、其它客户端通过同名请求头带回
+const (
+	lastWriteCookie = "last_write"
+	lastWriteHeader = "X-Last-Write"
+)
+
+// ReadYourWrites 写请求后 window 内同一客户端的查询使用主库，避免读到副本上尚未同步的自己的修改。
+// 写请求无论成败都记录时间，失败前可能已有部分写入生效；window 为 0 时不启用。
+// 时间由服务端用 secret 签名后保存在客户端，只影响该客户端，多实例部署时同样有效；
+// 客户端无法伪造或延长，签名不符的值被忽略
+func ReadYourWrites(window time.Duration, secret []byte) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if window <= 0 {
+			return
+		}
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			if lastWrite, ok := lastWriteOf(c, secret); ok && time.Since(lastWrite) < window {
+				c.Set("read_primary", true)
+			}
+			return
+		}
+		// 响应头在处理函数写入响应体时发出，需要在执行前设置
+		now := signLastWrite(time.Now().UnixMilli(), secret)
+		c.Header(lastWriteHeader, now)
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(lastWriteCookie, now, int(window/time.Second)+1, "/", "", false, true)
+		c.Set("read_primary", true)
+	}
+}
+
+// signLastWrite 写入时间及其 HMAC 签名，格式为 "<毫秒>.<签名>"
+func signLastWrite(ms int64, secret []byte) string {
+	value := strconv.FormatInt(ms, 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(value))
+	return value + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// lastWriteOf 读取客户端带回的写入时间，缺失或签名不符时返回 false
+func lastWriteOf(c *gin.Context, secret []byte) (time.Time, bool) {
+	value := c.GetHeader(lastWriteHeader)
+	if value == "" {
+		value, _ = c.Cookie(lastWriteCookie)
+	}
+	raw, _, _ := strings.Cut(value, ".")
+	ms, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || !hmac.Equal([]byte(value), []byte(signLastWrite(ms, secret))) {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
+
+// ServiceFor 当前请求使用的服务：经 ReadYourWrites 判定需要读主库时查询也使用主库，否则为 s
+func ServiceFor(c *gin.Context, s *service.UserService) *service.UserService {
+	if c.GetBool("read_primary") {
+		return s.Primary()
+	}
+	return s
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"gin-crud/dao"
+	"gin-crud/service"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadYourWrites(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	base := &service.UserService{Repo: dao.NewMemoryRepository()}
+	var primary bool
+	r := gin.New()
+	secret := []byte("secret")
+	r.Use(ReadYourWrites(time.Second, secret))
+	handler := func(c *gin.Context) {
+		primary = ServiceFor(c, base) != base
+	}
+	r.GET("/users", handler)
+	r.PUT("/users/1", handler)
+
+	serve := func(method string, headers map[string]string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/users", nil)
+		if method == http.MethodPut {
+			req.URL.Path = "/users/1"
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 没有写入记录时查询副本
+	serve(http.MethodGet, nil)
+	assert.False(t, primary)
+
+	// 写请求本身使用主库，并通过 Cookie 和响应头返回写入时间
+	w := serve(http.MethodPut, nil)
+	assert.True(t, primary)
+	assert.NotEmpty(t, w.Header().Get(lastWriteHeader))
+	cookies := w.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, lastWriteCookie, cookies[0].Name)
+		assert.True(t, cookies[0].HttpOnly)
+	}
+
+	// 带回写入时间的客户端在窗口内使用主库
+	serve(http.MethodGet, nil, cookies...)
+	assert.True(t, primary)
+	serve(http.MethodGet, map[string]string{lastWriteHeader: w.Header().Get(lastWriteHeader)})
+	assert.True(t, primary)
+
+	// 超出窗口或无法解析时查询副本
+	old := signLastWrite(time.Now().Add(-2*time.Second).UnixMilli(), secret)
+	serve(http.MethodGet, map[string]string{lastWriteHeader: old})
+	assert.False(t, primary)
+	serve(http.MethodGet, map[string]string{lastWriteHeader: "x"})
+	assert.False(t, primary)
+
+	// 客户端自行构造的时间没有有效签名，不能把查询固定到主库
+	future := time.Now().Add(time.Hour).UnixMilli()
+	for _, forged := range []string{
+		strconv.FormatInt(time.Now().UnixMilli(), 10),
+		strconv.FormatInt(future, 10) + "." + strings.Repeat("0", 64),
+		signLastWrite(future, []byte("other")),
+	} {
+		serve(http.MethodGet, map[string]string{lastWriteHeader: forged})
+		assert.False(t, primary, forged)
+		serve(http.MethodGet, nil, &http.Cookie{Name: lastWriteCookie, Value: forged})
+		assert.False(t, primary, forged)
+	}
+
+	// 未启用时不记录
+	r = gin.New()
+	r.Use(ReadYourWrites(0, secret))
+	r.PUT("/users/1", handler)
+	w = serve(http.MethodPut, nil)
+	assert.False(t, primary)
+	assert.Empty(t, w.Result().Cookies())
+}
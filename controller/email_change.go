@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"gin-crud/common"
+	"gin-crud/service"
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChangeMyEmail 申请修改邮箱
+// @Summary      申请修改邮箱
+// @Description  确认密码后向新邮箱发送确认链接，并向旧邮箱发送带撤销链接的通知。邮箱在确认后才会修改，链接过期后需重新申请
+// @Tags         me
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      object{new_email=string,password=string}  true  "Email Data"
+// @Success      200   {object}  common.Response{data=object{expires_at=string}}
+// @Failure      400   {object}  common.Response
+// @Failure      403   {object}  common.Response
+// @Failure      409   {object}  common.Response{data=object{field=string}}
+// @Failure      503   {object}  common.Response
+// @Router       /me/email [post]
+func ChangeMyEmail(c *gin.Context, s *service.UserService) {
+	id, _ := currentUserID(c)
+
+	var req struct {
+		NewEmail string `json:"new_email" binding:"required,email"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.Fail(400, "参数错误", c)
+		return
+	}
+
+	expiresAt, err := s.RequestEmailChange(id, req.NewEmail, req.Password)
+	if err != nil {
+		if failConflict(err, c) || failUnavailable(err, c) {
+			return
+		}
+		switch err.Error() {
+		case "密码错误":
+			common.Fail(403, err.Error(), c)
+		case "新邮箱与当前邮箱相同":
+			common.Fail(400, err.Error(), c)
+		case "用户不存在":
+			common.Fail(404, err.Error(), c)
+		default:
+			common.Fail(500, "申请失败: "+err.Error(), c)
+		}
+		return
+	}
+
+	common.Success(gin.H{"expires_at": expiresAt}, "确认邮件已发送到新邮箱", c)
+}
+
+// emailChangePage 邮件链接打开的确认页。GET 请求不修改任何状态，由用户点击按钮以 POST 提交，
+// 避免邮件安全扫描和链接预取自动完成确认或撤销
+var emailChangePage = template.Must(template.New("email-change").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Prompt}}</p>
+<form method="post">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">{{.Button}}</button>
+</form>
+</body>
+</html>
+`))
+
+// renderEmailChangePage 输出确认页，表单提交到当前地址，与链接使用同一个前缀
+func renderEmailChangePage(c *gin.Context, title, prompt, button string) {
+	var buf bytes.Buffer
+	err := emailChangePage.Execute(&buf, map[string]string{
+		"Title":  title,
+		"Prompt": prompt,
+		"Button": button,
+		"Token":  c.Query("token"),
+	})
+	if err != nil {
+		common.Fail(500, "系统异常: "+err.Error(), c)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// emailChangeToken POST 提交的 token，表单字段优先，也接受查询参数
+func emailChangeToken(c *gin.Context) string {
+	if token := c.PostForm("token"); token != "" {
+		return token
+	}
+	return c.Query("token")
+}
+
+// ConfirmEmailChangePage 确认修改邮箱页面
+// @Summary      确认修改邮箱页面
+// @Description  新邮箱收到的确认链接打开的页面，不修改邮箱，点击页面中的按钮后提交确认
+// @Tags         auth
+// @Produce      html
+// @Param        token  query     string  true  "确认 token"
+// @Success      200    {string}  string
+// @Router       /email-change/confirm [get]
+func ConfirmEmailChangePage(c *gin.Context) {
+	renderEmailChangePage(c, "确认修改邮箱", "确认后账号邮箱将改为本邮箱。", "确认修改")
+}
+
+// CancelEmailChangePage 撤销修改邮箱页面
+// @Summary      撤销修改邮箱页面
+// @Description  旧邮箱收到的撤销链接打开的页面，不撤销申请，点击页面中的按钮后提交撤销
+// @Tags         auth
+// @Produce      html
+// @Param        token  query     string  true  "撤销 token"
+// @Success      200    {string}  string
+// @Router       /email-change/cancel [get]
+func CancelEmailChangePage(c *gin.Context) {
+	renderEmailChangePage(c, "撤销修改邮箱", "如果不是您本人申请修改邮箱，请撤销申请并尽快修改密码。", "撤销申请")
+}
+
+// ConfirmEmailChange 确认修改邮箱
+// @Summary      确认修改邮箱
+// @Description  确认页提交，确认后邮箱正式修改
+// @Tags         auth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        token  formData  string  true  "确认 token"
+// @Success      200    {object}  common.Response
+// @Failure      400    {object}  common.Response
+// @Failure      409    {object}  common.Response{data=object{field=string}}
+// @Failure      503    {object}  common.Response
+// @Router       /email-change/confirm [post]
+func ConfirmEmailChange(c *gin.Context, s *service.UserService) {
+	err := s.ConfirmEmailChange(emailChangeToken(c))
+	if err != nil {
+		if failConflict(err, c) || failUnavailable(err, c) {
+			return
+		}
+		switch {
+		case errors.Is(err, service.ErrInvalidEmailChangeToken):
+			common.Fail(400, err.Error(), c)
+		case errors.Is(err, service.ErrPreconditionFailed):
+			common.FailWithStatus(http.StatusPreconditionFailed, err.Error(), c)
+		default:
+			common.Fail(500, "确认失败: "+err.Error(), c)
+		}
+		return
+	}
+
+	common.Success(nil, "邮箱修改成功", c)
+}
+
+// CancelEmailChange 撤销修改邮箱
+// @Summary      撤销修改邮箱
+// @Description  撤销页提交，撤销后确认链接同时失效
+// @Tags         auth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        token  formData  string  true  "撤销 token"
+// @Success      200    {object}  common.Response
+// @Failure      400    {object}  common.Response
+// @Failure      503    {object}  common.Response
+// @Router       /email-change/cancel [post]
+func CancelEmailChange(c *gin.Context, s *service.UserService) {
+	if err := s.CancelEmailChange(emailChangeToken(c)); err != nil {
+		if failUnavailable(err, c) {
+			return
+		}
+		if errors.Is(err, service.ErrInvalidEmailChangeToken) {
+			common.Fail(400, err.Error(), c)
+		} else {
+			common.Fail(500, "撤销失败: "+err.Error(), c)
+		}
+		return
+	}
+
+	common.Success(nil, "已撤销修改邮箱申请", c)
+}
@@ -0,0 +1,25 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfirmEmailChangePage(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/email-change/confirm?token=%22%3E%3Cscript%3E", nil)
+
+	ConfirmEmailChangePage(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	body := w.Body.String()
+	assert.Contains(t, body, `<form method="post">`)
+	assert.Contains(t, body, `value="&#34;&gt;&lt;script&gt;"`)
+	assert.NotContains(t, body, `"><script>`)
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"fmt"
+	"gin-crud/common"
+	"gin-crud/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StartDataExport 创建数据导出任务
+// @Summary      创建数据导出任务
+// @Description  异步生成包含用户资料、会话、审计记录等全部数据的 ZIP，返回任务 ID，通过任务接口查询进度
+// @Tags         gdpr
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "User public ID"
+// @Success      200  {object}  common.Response{data=service.DataExportJob}
+// @Failure      404  {object}  common.Response
+// @Failure      500  {object}  common.Response
+// @Failure      503  {object}  common.Response
+// @Router       /admin/users/{id}/data-export [post]
+func StartDataExport(c *gin.Context, s *service.UserService) {
+	id, ok := userParam(c, s, "id")
+	if !ok {
+		return
+	}
+	actorID, _ := c.Get("user_id")
+
+	job, err := s.StartDataExport(id, actorID.(uint))
+	if err != nil {
+		if failUnavailable(err, c) {
+			return
+		}
+		if err.Error() == "用户不存在" {
+			common.Fail(404, err.Error(), c)
+		} else {
+			common.Fail(500, "创建导出任务失败: "+err.Error(), c)
+		}
+		return
+	}
+
+	common.Success(job, "导出任务已创建", c)
+}
+
+// GetDataExport 查询数据导出任务
+// @Summary      查询数据导出任务
+// @Tags         gdpr
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        job  path      string  true  "Job ID"
+// @Success      200  {object}  common.Response{data=service.DataExportJob}
+// @Failure      404  {object}  common.Response
+// @Failure      503  {object}  common.Response
+// @Router       /admin/data-exports/{job} [get]
+func GetDataExport(c *gin.Context, s *service.UserService) {
+	job, err := s.GetDataExport(c.Param("job"))
+	if err != nil {
+		if failUnavailable(err, c) {
+			return
+		}
+		common.Fail(404, err.Error(), c)
+		return
+	}
+
+	common.Success(job, "获取成功", c)
+}
+
+// DownloadDataExport 下载数据导出文件
+// @Summary      下载数据导出文件
+// @Tags         gdpr
+// @Produce      application/zip
+// @Security     ApiKeyAuth
+// @Param        job  path      string  true  "Job ID"
+// @Success      200  {file}    file
+// @Failure      404  {object}  common.Response
+// @Failure      503  {object}  common.Response
+// @Router       /admin/data-exports/{job}/download [get]
+func DownloadDataExport(c *gin.Context, s *service.UserService) {
+	path, err := s.DataExportFile(c.Param("job"))
+	if err != nil {
+		if failUnavailable(err, c) {
+			return
+		}
+		common.Fail(404, err.Error(), c)
+		return
+	}
+
+	c.FileAttachment(path, fmt.Sprintf("user-data-%s.zip", c.Param("job")))
+}
+
+// EraseUser 匿名化用户
+// @Summary      匿名化用户
+// @Description  按数据主体请求原地匿名化用户的个人信息（保留行以维持关联数据的引用），并清除缓存和所有会话。操作不可撤销
+// @Tags         gdpr
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "User public ID"
+// @Success      200  {object}  common.Response
+// @Failure      404  {object}  common.Response
+// @Failure      409  {object}  common.Response
+// @Failure      500  {object}  common.Response
+// @Router       /admin/users/{id}/erase [post]
+func EraseUser(c *gin.Context, s *service.UserService) {
+	id, ok := userParam(c, s, "id")
+	if !ok {
+		return
+	}
+	actorID, _ := c.Get("user_id")
+
+	err := s.EraseUser(id, actorID.(uint))
+	if err != nil {
+		switch err.Error() {
+		case "用户不存在":
+			common.Fail(404, err.Error(), c)
+		case "用户已匿名化":
+			common.Fail(409, err.Error(), c)
+		default:
+			common.Fail(500, "匿名化失败: "+err.Error(), c)
+		}
+		return
+	}
+
+	common.Success(nil, "用户已匿名化", c)
+}
@@ -0,0 +1,401 @@
+package controller
+
+import (
+	"gin-crud/common"
+	"gin-crud/models"
+	"gin-crud/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// failGroup 组相关的常见业务错误映射为状态码，返回值表示是否已处理
+func failGroup(err error, c *gin.Context) bool {
+	if failConflict(err, c) {
+		return true
+	}
+	switch err.Error() {
+	case "组不存在", "用户不存在", "不是该组成员", "组没有该权限":
+		common.Fail(404, err.Error(), c)
+	case "上级组不存在", "不能将组移动到自身或其子组下", "没有可更新的字段", "无效的组内角色", "无效的权限名":
+		common.Fail(400, err.Error(), c)
+	case "请先删除或移走子组":
+		common.Fail(409, err.Error(), c)
+	default:
+		return false
+	}
+	return true
+}
+
+// ListGroups 组列表
+// @Summary      组列表
+// @Description  获取全部组，通过 parent_id 组成树形结构
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  common.Response{data=[]models.Group}
+// @Failure      403  {object}  common.Response
+// @Router       /admin/groups [get]
+func ListGroups(c *gin.Context, s *service.UserService) {
+	groups, err := s.ListGroups()
+	if err != nil {
+		common.Fail(500, "系统异常: "+err.Error(), c)
+		return
+	}
+	common.Success(groups, "获取成功", c)
+}
+
+// CreateGroup 创建组
+// @Summary      创建组
+// @Description  parent_id 为上级组，子组成员同时属于所有上级组
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      object{name=string,description=string,parent_id=int}  true  "Group Data"
+// @Success      200   {object}  common.Response{data=models.Group}
+// @Failure      400   {object}  common.Response
+// @Failure      409   {object}  common.Response{data=object{field=string}}
+// @Router       /admin/groups [post]
+func CreateGroup(c *gin.Context, s *service.UserService) {
+	var req struct {
+		Name        string `json:"name" binding:"required,max=100"`
+		Description string `json:"description" binding:"max=255"`
+		ParentID    *uint  `json:"parent_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.Fail(400, "参数错误", c)
+		return
+	}
+
+	group := &models.Group{Name: req.Name, Description: req.Description, ParentID: req.ParentID}
+	if err := s.CreateGroup(group); err != nil {
+		if failGroup(err, c) {
+			return
+		}
+		common.Fail(500, "创建失败: "+err.Error(), c)
+		return
+	}
+	common.Success(group, "创建成功", c)
+}
+
+// UpdateGroup 修改组
+// @Summary      修改组
+// @Description  可修改 name、description、parent_id，parent_id 为 null 表示移到顶层
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id    path      string  true  "Group ID"
+// @Param        data  body      object{name=string,description=string,parent_id=int}  true  "Group Data"
+// @Success      200   {object}  common.Response
+// @Failure      400   {object}  common.Response
+// @Failure      404   {object}  common.Response
+// @Failure      409   {object}  common.Response{data=object{field=string}}
+// @Router       /admin/groups/{id} [put]
+func UpdateGroup(c *gin.Context, s *service.UserService) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var data map[string]interface{}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		common.Fail(400, "无效的 JSON: "+err.Error(), c)
+		return
+	}
+
+	if err := s.UpdateGroup(id, data); err != nil {
+		if failGroup(err, c) {
+			return
+		}
+		common.Fail(500, "更新失败: "+err.Error(), c)
+		return
+	}
+	common.Success(nil, "更新成功", c)
+}
+
+// DeleteGroup 删除组
+// @Summary      删除组
+// @Description  删除组及其成员关系和权限，存在子组时不能删除
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "Group ID"
+// @Success      200  {object}  common.Response
+// @Failure      400  {object}  common.Response
+// @Failure      404  {object}  common.Response
+// @Failure      409  {object}  common.Response
+// @Router       /admin/groups/{id} [delete]
+func DeleteGroup(c *gin.Context, s *service.UserService) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if err := s.DeleteGroup(id); err != nil {
+		if failGroup(err, c) {
+			return
+		}
+		common.Fail(500, "删除失败: "+err.Error(), c)
+		return
+	}
+	common.Success(nil, "删除成功", c)
+}
+
+// ListGroupPermissions 组权限列表
+// @Summary      组权限列表
+// @Description  获取直接授予该组的权限，不包括上级组的权限
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "Group ID"
+// @Success      200  {object}  common.Response{data=[]string}
+// @Failure      400  {object}  common.Response
+// @Failure      404  {object}  common.Response
+// @Router       /admin/groups/{id}/permissions [get]
+func ListGroupPermissions(c *gin.Context, s *service.UserService) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	perms, err := s.ListGroupPermissions(id)
+	if err != nil {
+		if failGroup(err, c) {
+			return
+		}
+		common.Fail(500, "系统异常: "+err.Error(), c)
+		return
+	}
+	common.Success(perms, "获取成功", c)
+}
+
+// GrantGroupPermission 授予组权限
+// @Summary      授予组权限
+// @Description  组及其全部子组的成员都会获得该权限
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id    path      string                     true  "Group ID"
+// @Param        data  body      object{permission=string}  true  "Permission"
+// @Success      200   {object}  common.Response
+// @Failure      400   {object}  common.Response
+// @Failure      404   {object}  common.Response
+// @Router       /admin/groups/{id}/permissions [post]
+func GrantGroupPermission(c *gin.Context, s *service.UserService) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Permission string `json:"permission" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.Fail(400, "参数错误", c)
+		return
+	}
+
+	if err := s.GrantGroupPermission(id, req.Permission); err != nil {
+		if failGroup(err, c) {
+			return
+		}
+		common.Fail(500, "授权失败: "+err.Error(), c)
+		return
+	}
+	common.Success(nil, "授权成功", c)
+}
+
+// RevokeGroupPermission 收回组权限
+// @Summary      收回组权限
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id          path      string  true  "Group ID"
+// @Param        permission  path      string  true  "Permission"
+// @Success      200  {object}  common.Response
+// @Failure      400  {object}  common.Response
+// @Failure      404  {object}  common.Response
+// @Router       /admin/groups/{id}/permissions/{permission} [delete]
+func RevokeGroupPermission(c *gin.Context, s *service.UserService) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if err := s.RevokeGroupPermission(id, c.Param("permission")); err != nil {
+		if failGroup(err, c) {
+			return
+		}
+		common.Fail(500, "收回失败: "+err.Error(), c)
+		return
+	}
+	common.Success(nil, "收回成功", c)
+}
+
+// GetUserGroups 用户的有效组
+// @Summary      用户的有效组
+// @Description  用户直接加入的组及其全部上级组，以及由此获得的权限
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "User public ID"
+// @Success      200  {object}  common.Response{data=service.EffectiveGroups}
+// @Failure      404  {object}  common.Response
+// @Router       /admin/users/{id}/groups [get]
+func GetUserGroups(c *gin.Context, s *service.UserService) {
+	user := getUserParam(c, s, "id")
+	if user == nil {
+		return
+	}
+	writeEffectiveGroups(c, s, user.ID)
+}
+
+// GetMyGroups 当前用户的有效组
+// @Summary      当前用户的有效组
+// @Description  当前用户直接加入的组及其全部上级组，以及由此获得的权限
+// @Tags         me
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  common.Response{data=service.EffectiveGroups}
+// @Router       /me/groups [get]
+func GetMyGroups(c *gin.Context, s *service.UserService) {
+	user, _ := currentUser(c)
+	writeEffectiveGroups(c, s, user.ID)
+}
+
+func writeEffectiveGroups(c *gin.Context, s *service.UserService, userID uint) {
+	eg, err := s.EffectiveGroups(userID)
+	if err != nil {
+		common.Fail(500, "系统异常: "+err.Error(), c)
+		return
+	}
+	common.Success(eg, "获取成功", c)
+}
+
+// requireGroupManager 检查当前用户能否管理路径参数中的组的成员，返回组 ID；不能时写入响应并返回 false
+func requireGroupManager(c *gin.Context, s *service.UserService) (string, bool) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return "", false
+	}
+	user, _ := currentUser(c)
+	group, err := s.GetGroup(id)
+	if err != nil {
+		if !failGroup(err, c) {
+			common.Fail(500, "系统异常: "+err.Error(), c)
+		}
+		return "", false
+	}
+	ok, err = s.CanManageGroup(user, group.ID)
+	if err != nil {
+		common.Fail(500, "系统异常: "+err.Error(), c)
+		return "", false
+	}
+	if !ok {
+		common.Fail(403, "只有组管理员可以管理成员", c)
+		return "", false
+	}
+	return id, true
+}
+
+// ListGroupMembers 组成员列表
+// @Summary      组成员列表
+// @Description  获取组的直接成员，管理员或本组及上级组的 owner 可查看
+// @Tags         groups
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "Group ID"
+// @Success      200  {object}  common.Response{data=[]models.GroupMember}
+// @Failure      400  {object}  common.Response
+// @Failure      403  {object}  common.Response
+// @Failure      404  {object}  common.Response
+// @Router       /groups/{id}/members [get]
+func ListGroupMembers(c *gin.Context, s *service.UserService) {
+	groupID, ok := requireGroupManager(c, s)
+	if !ok {
+		return
+	}
+	members, err := s.ListGroupMembers(groupID)
+	if err != nil {
+		if failGroup(err, c) {
+			return
+		}
+		common.Fail(500, "系统异常: "+err.Error(), c)
+		return
+	}
+	common.Success(members, "获取成功", c)
+}
+
+// AddGroupMember 添加组成员
+// @Summary      添加组成员
+// @Description  添加成员或修改成员角色（member / owner），管理员或本组及上级组的 owner 可操作
+// @Tags         groups
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id       path      string               true   "Group ID"
+// @Param        user_id  path      string               true   "User public ID"
+// @Param        data     body      object{role=string}  false  "Role"
+// @Success      200  {object}  common.Response
+// @Failure      400  {object}  common.Response
+// @Failure      403  {object}  common.Response
+// @Failure      404  {object}  common.Response
+// @Router       /groups/{id}/members/{user_id} [put]
+func AddGroupMember(c *gin.Context, s *service.UserService) {
+	groupID, ok := requireGroupManager(c, s)
+	if !ok {
+		return
+	}
+	userID, ok := userParam(c, s, "user_id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Role string `json:"role"`
+	}
+	// 请求体可省略，默认为普通成员
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			common.Fail(400, "参数错误", c)
+			return
+		}
+	}
+
+	if err := s.AddGroupMember(groupID, userID, req.Role); err != nil {
+		if failGroup(err, c) {
+			return
+		}
+		common.Fail(500, "添加失败: "+err.Error(), c)
+		return
+	}
+	common.Success(nil, "添加成功", c)
+}
+
+// RemoveGroupMember 移除组成员
+// @Summary      移除组成员
+// @Description  管理员或本组及上级组的 owner 可操作
+// @Tags         groups
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id       path      string  true  "Group ID"
+// @Param        user_id  path      string  true  "User public ID"
+// @Success      200  {object}  common.Response
+// @Failure      400  {object}  common.Response
+// @Failure      403  {object}  common.Response
+// @Failure      404  {object}  common.Response
+// @Router       /groups/{id}/members/{user_id} [delete]
+func RemoveGroupMember(c *gin.Context, s *service.UserService) {
+	groupID, ok := requireGroupManager(c, s)
+	if !ok {
+		return
+	}
+	userID, ok := userParam(c, s, "user_id")
+	if !ok {
+		return
+	}
+	if err := s.RemoveGroupMember(groupID, userID); err != nil {
+		if failGroup(err, c) {
+			return
+		}
+		common.Fail(500, "移除失败: "+err.Error(), c)
+		return
+	}
+	common.Success(nil, "移除成功", c)
+}
@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"errors"
+	"gin-crud/common"
+	"gin-crud/models"
+	"gin-crud/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// failRegistration 注册方式不允许时返回 403，返回值表示是否已处理
+func failRegistration(err error, c *gin.Context) bool {
+	if errors.Is(err, service.ErrRegistrationClosed) || errors.Is(err, service.ErrInviteOnly) {
+		common.Fail(403, err.Error(), c)
+		return true
+	}
+	return false
+}
+
+// CreateInvitation 创建邀请
+// @Summary      创建邀请
+// @Description  向指定邮箱发送一次性注册链接，邮箱和角色由邀请预先指定。管理员可以邀请任意角色；组 owner 只能邀请普通用户加入自己管理的组（group_id 必填）
+// @Tags         invitations
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      service.InvitationRequest  true  "Invitation Data"
+// @Success      200   {object}  common.Response{data=models.Invitation}
+// @Failure      400   {object}  common.Response
+// @Failure      403   {object}  common.Response
+// @Failure      404   {object}  common.Response
+// @Failure      409   {object}  common.Response{data=object{field=string}}
+// @Router       /invitations [post]
+func CreateInvitation(c *gin.Context, s *service.UserService) {
+	user, _ := currentUser(c)
+
+	var req service.InvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.Fail(400, "参数错误", c)
+		return
+	}
+
+	inv, err := s.CreateInvitation(user, req)
+	if err != nil {
+		if failConflict(err, c) || failRegistration(err, c) || failGroup(err, c) {
+			return
+		}
+		switch {
+		case errors.Is(err, service.ErrInvitationForbidden):
+			common.Fail(403, err.Error(), c)
+		case err.Error() == "无效的角色", err.Error() == "过期时间必须晚于当前时间":
+			common.Fail(400, err.Error(), c)
+		default:
+			common.Fail(500, "创建邀请失败: "+err.Error(), c)
+		}
+		return
+	}
+
+	common.Success(inv, "邀请已发送", c)
+}
+
+// ListInvitations 邀请列表
+// @Summary      邀请列表
+// @Description  管理员查看全部邀请，其他用户查看自己发出的邀请，按创建时间倒序
+// @Tags         invitations
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        page  query     int  false  "页码"  default(1)
+// @Param        size  query     int  false  "每页数量"  default(20)
+// @Success      200   {object}  common.Response{data=object{list=[]models.Invitation,total=int}}
+// @Failure      500   {object}  common.Response
+// @Router       /invitations [get]
+func ListInvitations(c *gin.Context, s *service.UserService) {
+	user, _ := currentUser(c)
+	page, size := parsePage(c)
+
+	invs, total, err := s.ListInvitations(user, page, size)
+	if err != nil {
+		common.Fail(500, "系统异常: "+err.Error(), c)
+		return
+	}
+
+	common.Success(gin.H{"list": invs, "total": total}, "获取成功", c)
+}
+
+// RevokeInvitation 撤销邀请
+// @Summary      撤销邀请
+// @Description  撤销尚未接受的邀请，管理员或邀请人可操作
+// @Tags         invitations
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "Invitation ID"
+// @Success      200  {object}  common.Response
+// @Failure      400  {object}  common.Response
+// @Failure      403  {object}  common.Response
+// @Failure      404  {object}  common.Response
+// @Failure      409  {object}  common.Response
+// @Router       /invitations/{id} [delete]
+func RevokeInvitation(c *gin.Context, s *service.UserService) {
+	user, _ := currentUser(c)
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := s.RevokeInvitation(user, id); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvitationForbidden):
+			common.Fail(403, err.Error(), c)
+		case err.Error() == "邀请不存在":
+			common.Fail(404, err.Error(), c)
+		case err.Error() == "邀请已被接受或撤销":
+			common.Fail(409, err.Error(), c)
+		default:
+			common.Fail(500, "撤销失败: "+err.Error(), c)
+		}
+		return
+	}
+
+	common.Success(nil, "邀请已撤销", c)
+}
+
+// GetInvitation 查看邀请
+// @Summary      查看邀请
+// @Description  受邀人打开邮件中的链接时查看邀请的邮箱、角色和有效期
+// @Tags         auth
+// @Produce      json
+// @Param        token  query     string  true  "邀请 token"
+// @Success      200    {object}  common.Response{data=models.Invitation}
+// @Failure      400    {object}  common.Response
+// @Router       /invitations/accept [get]
+func GetInvitation(c *gin.Context, s *service.UserService) {
+	inv, err := s.GetInvitation(c.Query("token"))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInvitation) {
+			common.Fail(400, err.Error(), c)
+		} else {
+			common.Fail(500, "系统异常: "+err.Error(), c)
+		}
+		return
+	}
+
+	common.Success(inv, "获取成功", c)
+}
+
+// AcceptInvitation 接受邀请
+// @Summary      接受邀请
+// @Description  使用邀请 token 设置用户名和密码完成注册，邮箱和角色以邀请为准，token 只能使用一次
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        data  body      object{token=string,username=string,password=string,attributes=object}  true  "Accept Data"
+// @Success      200   {object}  common.Response{data=models.User}
+// @Failure      400   {object}  common.Response
+// @Failure      403   {object}  common.Response
+// @Failure      409   {object}  common.Response{data=object{field=string}}
+// @Router       /invitations/accept [post]
+func AcceptInvitation(c *gin.Context, s *service.UserService) {
+	var req struct {
+		Token      string            `json:"token" binding:"required"`
+		Username   string            `json:"username" binding:"required"`
+		Password   string            `json:"password" binding:"required,min=6"`
+		Attributes models.Attributes `json:"attributes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.Fail(400, "参数错误", c)
+		return
+	}
+
+	user := &models.User{Username: req.Username, Password: req.Password, Attributes: req.Attributes}
+	if err := s.AcceptInvitation(req.Token, user); err != nil {
+		if failConflict(err, c) || failAttribute(err, c) || failRegistration(err, c) {
+			return
+		}
+		if errors.Is(err, service.ErrInvalidInvitation) {
+			common.Fail(400, err.Error(), c)
+		} else {
+			common.Fail(500, "注册失败: "+err.Error(), c)
+		}
+		return
+	}
+
+	common.Success(user, "注册成功", c)
+}
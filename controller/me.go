@@ -0,0 +1,205 @@
+package controller
+
+import (
+	"errors"
+	"gin-crud/common"
+	"gin-crud/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMe 获取当前用户
+// @Summary      获取当前用户
+// @Description  根据 Token 中的用户 ID 获取当前登录用户的信息
+// @Tags         me
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  common.Response{data=models.User}
+// @Failure      401  {object}  common.Response
+// @Failure      404  {object}  common.Response
+// @Router       /me [get]
+func GetMe(c *gin.Context, s *service.UserService) {
+	id, _ := currentUserID(c)
+
+	user, err := s.GetUser(id)
+	if err != nil {
+		if err.Error() == "用户不存在" {
+			common.Fail(404, err.Error(), c)
+		} else {
+			common.Fail(500, "系统异常: "+err.Error(), c)
+		}
+		return
+	}
+
+	setCacheHeaders(c, user)
+	common.Success(user, "获取成功", c)
+}
+
+// UpdateMe 修改当前用户资料
+// @Summary      修改当前用户资料
+// @Description  只允许修改 username、attributes，修改密码请使用 /me/password，修改邮箱请使用 /me/email。attributes 按属性合并，值为 null 删除该属性。携带 If-Match 时按版本号校验
+// @Tags         me
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        If-Match  header    string                            false  "GET 时获取的 ETag"
+// @Param        data      body      object{username=string,attributes=object}  true   "Profile Data"
+// @Success      200  {object}  common.Response
+// @Failure      400  {object}  common.Response
+// @Failure      409  {object}  common.Response{data=object{field=string}}
+// @Failure      412  {object}  common.Response
+// @Router       /me [patch]
+func UpdateMe(c *gin.Context, s *service.UserService) {
+	id, _ := currentUserID(c)
+
+	var data map[string]interface{}
+	if err := c.ShouldBindJSON(&data); err != nil {
+		common.Fail(400, "无效的 JSON: "+err.Error(), c)
+		return
+	}
+
+	versions, ok := parseIfMatch(c)
+	if !ok {
+		common.FailWithStatus(http.StatusPreconditionFailed, service.ErrPreconditionFailed.Error(), c)
+		return
+	}
+
+	err := s.UpdateProfile(id, data, versions)
+	if err != nil {
+		if failConflict(err, c) || failAttribute(err, c) {
+			return
+		}
+		switch {
+		case errors.Is(err, service.ErrPreconditionFailed):
+			common.FailWithStatus(http.StatusPreconditionFailed, err.Error(), c)
+		case err.Error() == "没有可更新的字段":
+			common.Fail(400, err.Error(), c)
+		case err.Error() == "用户不存在":
+			common.Fail(404, err.Error(), c)
+		default:
+			common.Fail(500, "更新失败: "+err.Error(), c)
+		}
+		return
+	}
+
+	if user, err := s.GetUser(id); err == nil {
+		setCacheHeaders(c, user)
+	}
+	common.Success(nil, "更新成功", c)
+}
+
+// ChangeMyPassword 修改当前用户密码
+// @Summary      修改密码
+// @Description  校验当前密码后修改密码，并注销除当前会话外的所有会话
+// @Tags         me
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      object{current_password=string,new_password=string}  true  "Password Data"
+// @Success      200   {object}  common.Response
+// @Failure      400   {object}  common.Response
+// @Failure      403   {object}  common.Response
+// @Router       /me/password [post]
+func ChangeMyPassword(c *gin.Context, s *service.UserService) {
+	id, _ := currentUserID(c)
+
+	var req struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required,min=6"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.Fail(400, "参数错误", c)
+		return
+	}
+
+	err := s.ChangePassword(id, req.CurrentPassword, req.NewPassword, c.GetString("session_id"))
+	if err != nil {
+		switch err.Error() {
+		case "密码错误":
+			common.Fail(403, "当前密码错误", c)
+		case "用户不存在":
+			common.Fail(404, err.Error(), c)
+		default:
+			common.Fail(500, "修改失败: "+err.Error(), c)
+		}
+		return
+	}
+
+	common.Success(nil, "密码修改成功，其它设备已下线", c)
+}
+
+// DeleteMe 注销当前账号
+// @Summary      注销账号
+// @Description  确认密码后申请注销账号。配置了冷静期时返回计划删除时间，期间可撤销；否则立即删除
+// @Tags         me
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      object{password=string}  true  "Password"
+// @Success      200   {object}  common.Response{data=object{deletion_scheduled_at=string}}
+// @Failure      400   {object}  common.Response
+// @Failure      403   {object}  common.Response
+// @Failure      409   {object}  common.Response
+// @Router       /me [delete]
+func DeleteMe(c *gin.Context, s *service.UserService) {
+	id, _ := currentUserID(c)
+
+	var req struct {
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.Fail(400, "参数错误", c)
+		return
+	}
+
+	scheduledAt, err := s.RequestDeletion(id, req.Password)
+	if err != nil {
+		switch err.Error() {
+		case "密码错误":
+			common.Fail(403, err.Error(), c)
+		case "已申请注销，请勿重复提交":
+			common.Fail(409, err.Error(), c)
+		case "用户不存在":
+			common.Fail(404, err.Error(), c)
+		default:
+			common.Fail(500, "注销失败: "+err.Error(), c)
+		}
+		return
+	}
+
+	if scheduledAt == nil {
+		common.Success(nil, "账号已注销", c)
+		return
+	}
+	common.Success(gin.H{"deletion_scheduled_at": scheduledAt}, "已申请注销，冷静期内可撤销", c)
+}
+
+// CancelMyDeletion 撤销注销申请
+// @Summary      撤销注销申请
+// @Description  冷静期内撤销账号注销申请
+// @Tags         me
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  common.Response
+// @Failure      400  {object}  common.Response
+// @Router       /me/deletion/cancel [post]
+func CancelMyDeletion(c *gin.Context, s *service.UserService) {
+	id, _ := currentUserID(c)
+
+	if err := s.CancelDeletion(id); err != nil {
+		switch err.Error() {
+		case "没有待执行的注销申请":
+			common.Fail(400, err.Error(), c)
+		case "用户不存在":
+			common.Fail(404, err.Error(), c)
+		default:
+			common.Fail(500, "撤销失败: "+err.Error(), c)
+		}
+		return
+	}
+
+	common.Success(nil, "已撤销注销申请", c)
+}
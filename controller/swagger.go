@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"encoding/json"
+	"gin-crud/common"
+
+	"github.com/swaggo/swag"
+)
+
+// SwaggerDoc 在 swag 生成的文档上补充配置中声明的自定义属性。
+// 生成的文档只知道 attributes 是一个对象，每次读取时按最新配置填充各属性的类型和约束
+type SwaggerDoc struct {
+	Base swag.Swagger
+}
+
+// attributeSchemaTypes 自定义属性类型对应的 JSON Schema 类型
+var attributeSchemaTypes = map[string]string{
+	"":       "string",
+	"string": "string",
+	"int":    "integer",
+	"number": "number",
+	"bool":   "boolean",
+}
+
+func (d SwaggerDoc) ReadDoc() string {
+	raw := d.Base.ReadDoc()
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+		return raw
+	}
+	definitions, _ := doc["definitions"].(map[string]interface{})
+	user, _ := definitions["models.User"].(map[string]interface{})
+	if user == nil {
+		return raw
+	}
+	props, _ := user["properties"].(map[string]interface{})
+	if props == nil {
+		props = map[string]interface{}{}
+		user["properties"] = props
+	}
+	props["attributes"] = attributesSchema()
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return raw
+	}
+	return string(out)
+}
+
+func attributesSchema() map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for _, def := range common.Conf.Attributes {
+		prop := map[string]interface{}{"type": attributeSchemaTypes[def.Type]}
+		if def.Description != "" {
+			prop["description"] = def.Description
+		}
+		if def.Pattern != "" {
+			prop["pattern"] = def.Pattern
+		}
+		if len(def.Enum) > 0 {
+			prop["enum"] = def.Enum
+		}
+		properties[def.Name] = prop
+		if def.Required {
+			required = append(required, def.Name)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":        "object",
+		"description": "自定义属性，由配置文件 attributes 声明",
+		"properties":  properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
@@ -1,33 +1,40 @@
 package controller
 
 import (
+	"errors"
 	"gin-crud/common"
+	"gin-crud/models"
 	"gin-crud/service"
+	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 // GetUser 获取用户详情
 // @Summary      获取用户详情
-// @Description  根据 ID 获取用户信息
+// @Description  根据 ID 获取用户信息，响应带 ETag 和 Last-Modified，支持 If-None-Match / If-Modified-Since 条件请求
 // @Tags         users
 // @Accept       json
 // @Produce      json
-// @Param        id   path      string  true  "User ID"
+// @Param        id                 path      string  true   "User public ID"
+// @Param        If-None-Match      header    string  false  "上次获取的 ETag"
+// @Param        If-Modified-Since  header    string  false  "上次获取的 Last-Modified"
 // @Success      200  {object}  common.Response{data=models.User}
+// @Success      304  "未修改"
 // @Failure      404  {object}  common.Response
 // @Failure      500  {object}  common.Response
 // @Router       /users/{id} [get]
 func GetUser(c *gin.Context, s *service.UserService) {
-	id := c.Param("id")
+	user := getUserParam(c, s, "id")
+	if user == nil {
+		return
+	}
 
-	user, err := s.GetUser(id)
-	if err != nil {
-		if err.Error() == "用户不存在" {
-			common.Fail(404, err.Error(), c)
-		} else {
-			common.Fail(500, "系统异常: "+err.Error(), c)
-		}
+	setCacheHeaders(c, user)
+	if notModified(c, userETag(user), user.UpdatedAt) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
@@ -36,21 +43,34 @@ func GetUser(c *gin.Context, s *service.UserService) {
 
 // DeleteUser 删除用户
 // @Summary      删除用户
-// @Description  根据 ID 删除用户
+// @Description  根据 ID 删除用户，携带 If-Match 时只有 ETag 与当前版本一致才删除
 // @Tags         users
 // @Accept       json
 // @Produce      json
-// @Param        id   path      string  true  "User ID"
+// @Param        id        path      string  true   "User public ID"
+// @Param        If-Match  header    string  false  "GET 时获取的 ETag"
 // @Success      200  {object}  common.Response
 // @Failure      404  {object}  common.Response
+// @Failure      412  {object}  common.Response
 // @Failure      500  {object}  common.Response
 // @Router       /users/{id} [delete]
 func DeleteUser(c *gin.Context, s *service.UserService) {
-	id := c.Param("id")
+	id, ok := userParam(c, s, "id")
+	if !ok {
+		return
+	}
+
+	versions, ok := parseIfMatch(c)
+	if !ok {
+		common.FailWithStatus(http.StatusPreconditionFailed, service.ErrPreconditionFailed.Error(), c)
+		return
+	}
 
-	err := s.DeleteUser(id)
+	err := s.DeleteUserIfMatch(id, versions)
 	if err != nil {
-		if err.Error() == "用户不存在" {
+		if errors.Is(err, service.ErrPreconditionFailed) {
+			common.FailWithStatus(http.StatusPreconditionFailed, err.Error(), c)
+		} else if err.Error() == "用户不存在" {
 			common.Fail(404, err.Error(), c)
 		} else {
 			common.Fail(500, "删除失败: "+err.Error(), c)
@@ -63,19 +83,29 @@ func DeleteUser(c *gin.Context, s *service.UserService) {
 
 // UpdateUser 更新用户
 // @Summary      更新用户
-// @Description  根据 ID 更新用户信息
+// @Description  只能修改自己的信息，管理员可以修改任意用户。携带 If-Match 时只有 ETag 与当前版本一致才更新，成功后响应头返回新的 ETag。
+// @Description  只能修改 username、attributes，其余字段被忽略，邮箱需通过 /me/email 验证后修改，密码需通过 /me/password 修改
 // @Tags         users
 // @Accept       json
 // @Produce      json
-// @Param        id    path      string                 true  "User ID"
-// @Param        data  body      map[string]interface{} true  "Update Data"
+// @Security     ApiKeyAuth
+// @Param        id        path      string                  true   "User public ID"
+// @Param        If-Match  header    string                  false  "GET 时获取的 ETag"
+// @Param        data      body      map[string]interface{}  true   "Update Data"
 // @Success      200   {object}  common.Response
 // @Failure      400   {object}  common.Response
+// @Failure      401   {object}  common.Response
+// @Failure      403   {object}  common.Response
 // @Failure      404   {object}  common.Response
+// @Failure      409   {object}  common.Response{data=object{field=string}}
+// @Failure      412   {object}  common.Response
 // @Failure      500   {object}  common.Response
 // @Router       /users/{id} [put]
 func UpdateUser(c *gin.Context, s *service.UserService) {
-	id := c.Param("id")
+	id, ok := userParam(c, s, "id")
+	if !ok || !requireSelfOrAdmin(c, id) {
+		return
+	}
 	var updateData map[string]interface{}
 
 	if err := c.ShouldBindJSON(&updateData); err != nil {
@@ -83,15 +113,186 @@ func UpdateUser(c *gin.Context, s *service.UserService) {
 		return
 	}
 
-	err := s.UpdateUser(id, updateData)
+	versions, ok := parseIfMatch(c)
+	if !ok {
+		common.FailWithStatus(http.StatusPreconditionFailed, service.ErrPreconditionFailed.Error(), c)
+		return
+	}
+
+	err := s.UpdateUserIfMatch(id, updateData, versions)
 	if err != nil {
-		if err.Error() == "用户不存在" {
+		if failConflict(err, c) || failAttribute(err, c) {
+			return
+		}
+		if errors.Is(err, service.ErrPreconditionFailed) {
+			common.FailWithStatus(http.StatusPreconditionFailed, err.Error(), c)
+		} else if err.Error() == "用户不存在" {
 			common.Fail(404, err.Error(), c)
+		} else if err.Error() == "没有可更新的字段" {
+			common.Fail(400, err.Error(), c)
 		} else {
 			common.Fail(500, "更新失败: "+err.Error(), c)
 		}
 		return
 	}
 
+	// 返回新的 ETag，便于客户端继续发起条件更新
+	if user, err := s.GetUser(id); err == nil {
+		setCacheHeaders(c, user)
+	}
+
 	common.Success(nil, "更新成功", c)
 }
+
+// userParam 将路径参数中的用户标识转换为内部 ID，失败时写入响应并返回 false
+func userParam(c *gin.Context, s *service.UserService, name string) (string, bool) {
+	id, err := s.ResolveUserID(c.Param(name))
+	if err != nil {
+		if err.Error() == "用户不存在" {
+			common.Fail(404, err.Error(), c)
+		} else {
+			common.Fail(500, "系统异常: "+err.Error(), c)
+		}
+		return "", false
+	}
+	return id, true
+}
+
+// requireSelfOrAdmin 要求操作的是当前用户自己，管理员不受限制，否则返回 403 并返回 false。需放在 AuthMiddleware 之后
+func requireSelfOrAdmin(c *gin.Context, id string) bool {
+	user, ok := currentUser(c)
+	if !ok {
+		common.Fail(401, "未登录，请先提供 Token", c)
+		return false
+	}
+	if user.Role != models.RoleAdmin && strconv.FormatUint(uint64(user.ID), 10) != id {
+		common.Fail(403, "无权限访问", c)
+		return false
+	}
+	return true
+}
+
+// idParam 读取自增 ID 形式的路径参数，不是正整数时返回 400 并返回 false
+func idParam(c *gin.Context, name string) (string, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil || id == 0 {
+		common.Fail(400, "无效的 ID", c)
+		return "", false
+	}
+	return strconv.FormatUint(id, 10), true
+}
+
+// getUserParam 按路径参数中的用户标识读取用户（走缓存），失败时写入响应并返回 nil
+func getUserParam(c *gin.Context, s *service.UserService, name string) *models.User {
+	ref := c.Param(name)
+	if !service.AcceptsUserRef(ref) {
+		common.Fail(404, "用户不存在", c)
+		return nil
+	}
+	user, err := s.GetUser(ref)
+	if err != nil {
+		if err.Error() == "用户不存在" {
+			common.Fail(404, err.Error(), c)
+		} else {
+			common.Fail(500, "系统异常: "+err.Error(), c)
+		}
+		return nil
+	}
+	return user
+}
+
+// failConflict 唯一约束冲突时返回 409 并在 data 中给出冲突字段，返回值表示是否已处理
+func failConflict(err error, c *gin.Context) bool {
+	var conflict *common.ConflictError
+	if !errors.As(err, &conflict) {
+		return false
+	}
+	common.Result(409, gin.H{"field": conflict.Field}, conflict.Error(), c)
+	return true
+}
+
+// failUnavailable 会话等状态所在的 Redis 不可用时返回 503，返回值表示是否已处理
+func failUnavailable(err error, c *gin.Context) bool {
+	if !errors.Is(err, service.ErrSessionsUnavailable) {
+		return false
+	}
+	common.FailWithStatus(http.StatusServiceUnavailable, service.ErrSessionsUnavailable.Error(), c)
+	return true
+}
+
+// failAttribute 自定义属性校验失败时返回 400 并在 data 中给出属性名，返回值表示是否已处理
+func failAttribute(err error, c *gin.Context) bool {
+	var attrErr *service.AttributeError
+	if !errors.As(err, &attrErr) {
+		return false
+	}
+	common.Result(400, gin.H{"field": attrErr.Field}, attrErr.Error(), c)
+	return true
+}
+
+// ListUsers 用户列表
+// @Summary      用户列表
+// @Description  需管理员或通过组获得 user:list 权限。分页查询用户，可用 attr.<属性名>=<值> 按配置中声明的自定义属性过滤，多个条件同时满足。
+// @Description  指定 ids 时按公开 ID 批量获取（最多 100 个，逗号分隔），按 ids 的顺序返回，忽略不存在的用户，此时不分页也不过滤
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        ids              query     string  false  "User public IDs, comma separated"
+// @Param        page             query     int     false  "页码"  default(1)
+// @Param        size             query     int     false  "每页数量"  default(20)
+// @Param        attr.department  query     string  false  "按自定义属性过滤（示例）"
+// @Success      200  {object}  common.Response{data=object{list=[]models.User,total=int}}
+// @Failure      400  {object}  common.Response{data=object{field=string}}
+// @Failure      403  {object}  common.Response
+// @Failure      500  {object}  common.Response
+// @Router       /users [get]
+func ListUsers(c *gin.Context, s *service.UserService) {
+	if ids, ok := c.GetQuery("ids"); ok {
+		getUsersByIDs(c, s, ids)
+		return
+	}
+	page, size := parsePage(c)
+
+	filters := make(map[string]string)
+	for key, values := range c.Request.URL.Query() {
+		if name, ok := strings.CutPrefix(key, "attr."); ok && len(values) > 0 {
+			filters[name] = values[0]
+		}
+	}
+
+	users, total, err := s.ListUsers(page, size, filters)
+	if err != nil {
+		if failAttribute(err, c) {
+			return
+		}
+		common.Fail(500, "系统异常: "+err.Error(), c)
+		return
+	}
+
+	common.Success(gin.H{"list": users, "total": total}, "获取成功", c)
+}
+
+// getUsersByIDs 按逗号分隔的公开 ID 批量获取用户
+func getUsersByIDs(c *gin.Context, s *service.UserService, ids string) {
+	refs := strings.Split(ids, ",")
+	for i, ref := range refs {
+		refs[i] = strings.TrimSpace(ref)
+		if !models.IsPublicID(refs[i]) {
+			common.Fail(400, "用户 ID 格式错误: "+refs[i], c)
+			return
+		}
+	}
+
+	users, err := s.GetUsers(refs)
+	if err != nil {
+		if errors.Is(err, service.ErrTooManyUsers) {
+			common.Fail(400, err.Error(), c)
+			return
+		}
+		common.Fail(500, "系统异常: "+err.Error(), c)
+		return
+	}
+
+	common.Success(gin.H{"list": users, "total": len(users)}, "获取成功", c)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"gin-crud/common"
+	"gin-crud/dao"
 	"gin-crud/models"
 	"gin-crud/service"
 	"net/http"
@@ -17,7 +18,7 @@ import (
 )
 
 // setupTestApp 初始化测试环境
-func setupTestApp() (*gin.Engine, *service.UserService) {
+func setupTestApp() (*gin.Engine, *service.UserService, *gorm.DB) {
 	// 1. 初始化配置（JWT 密钥等依赖它）
 	common.InitConfig()
 
@@ -27,29 +28,19 @@ func setupTestApp() (*gin.Engine, *service.UserService) {
 	db.AutoMigrate(&models.User{})
 
 	// 3. 组装 Service
-	userService := &service.UserService{DB: db}
+	userService := &service.UserService{Repo: dao.NewGormRepository(db)}
 
 	// 4. 初始化路由
 	r := gin.Default()
-	return r, userService
+	return r, userService, db
 }
 
 func TestUserWorkflow(t *testing.T) {
-	r, userService := setupTestApp()
-	db := userService.DB // 测试中可能需要直接操作 DB 清理数据
+	r, userService, db := setupTestApp() // 测试中可能需要直接操作 DB 清理数据
 
 	// 定义路由：现在全部通过 Service 调用
 	r.POST("/register", func(c *gin.Context) {
-		var user models.User
-		if err := c.ShouldBindJSON(&user); err != nil {
-			common.Fail(400, "参数错误", c)
-			return
-		}
-		if err := userService.Register(&user); err != nil {
-			common.Fail(500, err.Error(), c)
-			return
-		}
-		common.Success(user, "注册成功", c)
+		Register(c, userService)
 	})
 
 	r.POST("/login", func(c *gin.Context) {
@@ -58,7 +49,7 @@ func TestUserWorkflow(t *testing.T) {
 
 	// 受保护路由
 	auth := r.Group("/api")
-	auth.Use(AuthMiddleware())
+	auth.Use(AuthMiddleware(userService))
 	{
 		auth.GET("/profile/:id", func(c *gin.Context) {
 			// 这里演示如何在 Controller 直接调用 Service
@@ -76,7 +67,7 @@ func TestUserWorkflow(t *testing.T) {
 	// 先清理旧数据，保证测试可重复
 	db.Exec("DELETE FROM users WHERE username = ?", "tester")
 
-	regData := models.User{Username: "tester", Password: "password123", Email: "test@qq.com"}
+	regData := gin.H{"username": "tester", "password": "password123", "email": "test@qq.com"}
 	regJson, _ := json.Marshal(regData)
 	reqReg, _ := http.NewRequest("POST", "/register", bytes.NewBuffer(regJson))
 	wReg := httptest.NewRecorder()
@@ -116,3 +107,29 @@ func TestUserWorkflow(t *testing.T) {
 	assert.Equal(t, 200, wGet.Code)
 	assert.Contains(t, wGet.Body.String(), "tester")
 }
+
+func TestRequireSelfOrAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	serve := func(user *models.User, id string) int {
+		r := gin.New()
+		r.PUT("/users/:id", func(c *gin.Context) {
+			if user != nil {
+				c.Set("user", user)
+			}
+			if requireSelfOrAdmin(c, c.Param("id")) {
+				common.Success(nil, "ok", c)
+			}
+		})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPut, "/users/"+id, nil)
+		r.ServeHTTP(w, req)
+		var resp common.Response
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Code
+	}
+
+	assert.Equal(t, 401, serve(nil, "1"))
+	assert.Equal(t, 200, serve(&models.User{ID: 1, Role: models.RoleUser}, "1"))
+	assert.Equal(t, 403, serve(&models.User{ID: 1, Role: models.RoleUser}, "2"))
+	assert.Equal(t, 200, serve(&models.User{ID: 1, Role: models.RoleAdmin}, "2"))
+}
@@ -0,0 +1,41 @@
+package dao
+
+import (
+	"gin-crud/models"
+
+	"gorm.io/gorm"
+)
+
+// CreateAuditLog 写入审计记录
+func CreateAuditLog(log *models.AuditLog, db *gorm.DB) error {
+	return db.Create(log).Error
+}
+
+// ListAuditLogs 按时间倒序分页查询某个用户的审计记录
+func ListAuditLogs(userID string, page, size int, db *gorm.DB) ([]models.AuditLog, int64, error) {
+	var logs []models.AuditLog
+	var total int64
+	query := db.Model(&models.AuditLog{}).Where("user_id = ?", userID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("id DESC").Offset((page - 1) * size).Limit(size).Find(&logs).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
+
+// RedactAuditLogs 清空某个用户指定动作的审计记录详情，用于匿名化时删除详情中的个人信息
+func RedactAuditLogs(userID uint, actions []string, db *gorm.DB) error {
+	return db.Model(&models.AuditLog{}).
+		Where("user_id = ? AND action IN ?", userID, actions).
+		Update("detail", "").Error
+}
+
+// ListAllAuditLogsOf 查询与某个用户相关的全部审计记录（作为被操作人或操作人）
+func ListAllAuditLogsOf(userID uint, db *gorm.DB) ([]models.AuditLog, error) {
+	var logs []models.AuditLog
+	err := db.Where("user_id = ? OR actor_id = ?", userID, userID).Order("id").Find(&logs).Error
+	return logs, err
+}
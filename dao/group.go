@@ -0,0 +1,178 @@
+package dao
+
+import (
+	"gin-crud/common"
+	"gin-crud/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateGroup 创建组，组名冲突时返回 *common.ConflictError
+func CreateGroup(group *models.Group, db *gorm.DB) error {
+	return common.TranslateDBError(db.Create(group).Error)
+}
+
+// byID 按主键查询的条件，id 作为参数绑定。First(&x, id) 在 id 不是数字时会把它当作 SQL 条件原样拼接
+func byID(id string) clause.Expression {
+	return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: clause.PrimaryKey}, Value: id}
+}
+
+// GetGroupByID 根据 ID 获取组
+func GetGroupByID(id string, db *gorm.DB) (*models.Group, error) {
+	var group models.Group
+	if err := db.Where(byID(id)).First(&group).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// ListGroups 查询全部组
+func ListGroups(db *gorm.DB) ([]models.Group, error) {
+	var groups []models.Group
+	err := db.Order("id").Find(&groups).Error
+	return groups, err
+}
+
+// UpdateGroupByID 更新组，组名冲突时返回 *common.ConflictError
+func UpdateGroupByID(id string, data map[string]interface{}, db *gorm.DB) error {
+	result := db.Model(&models.Group{}).Where("id = ?", id).Updates(data)
+	if result.Error != nil {
+		return common.TranslateDBError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteGroupByID 删除组及其成员关系和权限
+func DeleteGroupByID(id uint, db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", id).Delete(&models.GroupMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", id).Delete(&models.GroupPermission{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&models.Group{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// CountChildGroups 统计直接子组数量
+func CountChildGroups(id uint, db *gorm.DB) (int64, error) {
+	var count int64
+	err := db.Model(&models.Group{}).Where("parent_id = ?", id).Count(&count).Error
+	return count, err
+}
+
+// FindParentGroupIDs 查询给定组的直接上级组 ID
+func FindParentGroupIDs(ids []uint, db *gorm.DB) ([]uint, error) {
+	var parents []uint
+	if len(ids) == 0 {
+		return parents, nil
+	}
+	err := db.Model(&models.Group{}).Where("id IN ? AND parent_id IS NOT NULL", ids).
+		Distinct().Pluck("parent_id", &parents).Error
+	return parents, err
+}
+
+// memberUserColumns 成员列表附带的用户字段，组 owner 不一定是管理员，不返回邮箱、密码哈希等
+var memberUserColumns = []string{"id", "public_id", "username", "status"}
+
+// ListGroupMembers 查询组的直接成员，附带用户的公开信息
+func ListGroupMembers(groupID uint, db *gorm.DB) ([]models.GroupMember, error) {
+	var members []models.GroupMember
+	err := db.Preload("User", func(db *gorm.DB) *gorm.DB {
+		return db.Select(memberUserColumns)
+	}).Where("group_id = ?", groupID).Order("user_id").Find(&members).Error
+	return members, err
+}
+
+// UpsertGroupMember 添加成员，已是成员时更新角色
+func UpsertGroupMember(member *models.GroupMember, db *gorm.DB) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "group_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role"}),
+	}).Create(member).Error
+}
+
+// DeleteGroupMember 移除成员
+func DeleteGroupMember(groupID, userID uint, db *gorm.DB) error {
+	result := db.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&models.GroupMember{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// FindMemberGroupIDs 查询用户直接所属的组，role 非空时只返回该角色的组
+func FindMemberGroupIDs(userID uint, role string, db *gorm.DB) ([]uint, error) {
+	var ids []uint
+	query := db.Model(&models.GroupMember{}).Where("user_id = ?", userID)
+	if role != "" {
+		query = query.Where("role = ?", role)
+	}
+	err := query.Pluck("group_id", &ids).Error
+	return ids, err
+}
+
+// ListMembershipsOfUser 查询用户直接加入的组及角色
+func ListMembershipsOfUser(userID uint, db *gorm.DB) ([]models.GroupMember, error) {
+	var members []models.GroupMember
+	err := db.Where("user_id = ?", userID).Order("group_id").Find(&members).Error
+	return members, err
+}
+
+// DeleteOrphanMemberships 删除已被永久删除的用户残留的成员关系
+func DeleteOrphanMemberships(db *gorm.DB) (int64, error) {
+	result := db.Where("user_id NOT IN (?)", db.Unscoped().Model(&models.User{}).Select("id")).
+		Delete(&models.GroupMember{})
+	return result.RowsAffected, result.Error
+}
+
+// ListGroupPermissions 查询组直接拥有的权限
+func ListGroupPermissions(groupID uint, db *gorm.DB) ([]string, error) {
+	var perms []string
+	err := db.Model(&models.GroupPermission{}).Where("group_id = ?", groupID).
+		Order("permission").Pluck("permission", &perms).Error
+	return perms, err
+}
+
+// FindPermissionsOfGroups 查询多个组拥有的权限（去重）
+func FindPermissionsOfGroups(groupIDs []uint, db *gorm.DB) ([]string, error) {
+	var perms []string
+	if len(groupIDs) == 0 {
+		return perms, nil
+	}
+	err := db.Model(&models.GroupPermission{}).Where("group_id IN ?", groupIDs).
+		Distinct().Order("permission").Pluck("permission", &perms).Error
+	return perms, err
+}
+
+// AddGroupPermission 授予组权限，已存在时忽略
+func AddGroupPermission(perm *models.GroupPermission, db *gorm.DB) error {
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(perm).Error
+}
+
+// RemoveGroupPermission 收回组权限
+func RemoveGroupPermission(groupID uint, permission string, db *gorm.DB) error {
+	result := db.Where("group_id = ? AND permission = ?", groupID, permission).Delete(&models.GroupPermission{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package dao
+
+import (
+	"gin-crud/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateInvitation 创建邀请
+func CreateInvitation(inv *models.Invitation, db *gorm.DB) error {
+	return db.Create(inv).Error
+}
+
+// GetInvitationByID 根据 ID 获取邀请
+func GetInvitationByID(id string, db *gorm.DB) (*models.Invitation, error) {
+	var inv models.Invitation
+	if err := db.Where(byID(id)).First(&inv).Error; err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// GetInvitationByTokenHash 根据 token 哈希获取邀请
+func GetInvitationByTokenHash(hash string, db *gorm.DB) (*models.Invitation, error) {
+	var inv models.Invitation
+	if err := db.Where("token_hash = ?", hash).First(&inv).Error; err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// ListInvitations 分页查询邀请，inviterID 非 0 时只查该用户发出的邀请
+func ListInvitations(inviterID uint, page, size int, db *gorm.DB) ([]models.Invitation, int64, error) {
+	var invs []models.Invitation
+	var total int64
+	query := db.Model(&models.Invitation{})
+	if inviterID != 0 {
+		query = query.Where("inviter_id = ?", inviterID)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("id DESC").Offset((page - 1) * size).Limit(size).Find(&invs).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return invs, total, nil
+}
+
+// MarkInvitationAccepted 将仍可使用的邀请标记为已接受，邀请已被使用、撤销或过期时返回 gorm.ErrRecordNotFound
+func MarkInvitationAccepted(id, userID uint, now time.Time, db *gorm.DB) error {
+	result := db.Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", id, now).
+		Updates(map[string]interface{}{"accepted_at": now, "user_id": userID})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// RevokeInvitation 撤销尚未接受的邀请，邀请不存在或已被接受时返回 gorm.ErrRecordNotFound
+func RevokeInvitation(id uint, now time.Time, db *gorm.DB) error {
+	result := db.Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).
+		Update("revoked_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// AnonymizeInvitations 覆盖发给该用户（按接受人或邮箱）的邀请中的邮箱
+func AnonymizeInvitations(userID uint, email, replacement string, db *gorm.DB) error {
+	return db.Model(&models.Invitation{}).
+		Where("user_id = ? OR email = ?", userID, email).
+		Update("email", replacement).Error
+}
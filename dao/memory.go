@@ -0,0 +1,944 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin-crud/common"
+	"gin-crud/models"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// MemoryRepository 进程内的 UserRepository，数据不持久化，用于单元测试和本地试用。
+// 所有操作互斥执行；事务在数据副本上执行，提交时整体替换，回滚时直接丢弃副本
+type MemoryRepository struct {
+	mu    *sync.RWMutex
+	state *memoryState
+	inTx  bool // 事务内的 repo 由外层持有锁
+}
+
+type memoryState struct {
+	users       map[uint]models.User
+	groups      map[uint]models.Group
+	members     map[[2]uint]models.GroupMember // {组 ID, 用户 ID}
+	permissions map[groupPermissionKey]models.GroupPermission
+	auditLogs   []models.AuditLog
+	invitations map[uint]models.Invitation
+
+	nextUserID, nextGroupID, nextAuditID, nextInvitationID uint
+}
+
+type groupPermissionKey struct {
+	groupID    uint
+	permission string
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		mu: &sync.RWMutex{},
+		state: &memoryState{
+			users:       make(map[uint]models.User),
+			groups:      make(map[uint]models.Group),
+			members:     make(map[[2]uint]models.GroupMember),
+			permissions: make(map[groupPermissionKey]models.GroupPermission),
+			invitations: make(map[uint]models.Invitation),
+		},
+	}
+}
+
+func (s *memoryState) clone() *memoryState {
+	c := *s
+	c.users = make(map[uint]models.User, len(s.users))
+	for k, v := range s.users {
+		c.users[k] = v
+	}
+	c.groups = make(map[uint]models.Group, len(s.groups))
+	for k, v := range s.groups {
+		c.groups[k] = v
+	}
+	c.members = make(map[[2]uint]models.GroupMember, len(s.members))
+	for k, v := range s.members {
+		c.members[k] = v
+	}
+	c.permissions = make(map[groupPermissionKey]models.GroupPermission, len(s.permissions))
+	for k, v := range s.permissions {
+		c.permissions[k] = v
+	}
+	c.auditLogs = append([]models.AuditLog(nil), s.auditLogs...)
+	c.invitations = make(map[uint]models.Invitation, len(s.invitations))
+	for k, v := range s.invitations {
+		c.invitations[k] = v
+	}
+	return &c
+}
+
+func (m *MemoryRepository) read() func() {
+	if m.inTx {
+		return func() {}
+	}
+	m.mu.RLock()
+	return m.mu.RUnlock
+}
+
+func (m *MemoryRepository) write() func() {
+	if m.inTx {
+		return func() {}
+	}
+	m.mu.Lock()
+	return m.mu.Unlock
+}
+
+// Transaction 在数据副本上执行 fn，成功后替换原数据。事务期间其他操作等待
+func (m *MemoryRepository) Transaction(fn func(repo UserRepository) error) error {
+	defer m.write()()
+	tx := &MemoryRepository{mu: m.mu, state: m.state.clone(), inTx: true}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	m.state = tx.state
+	return nil
+}
+
+// Primary 内存实现只有一份数据，返回自身
+func (m *MemoryRepository) Primary() UserRepository {
+	return m
+}
+
+// schemaCache 按列名写入字段时使用的 GORM 模型解析结果
+var schemaCache sync.Map
+
+// setColumns 按列名把 data 写入模型字段，与 GORM 的 Updates(map) 使用相同的列名和类型转换。
+// 表达式（如 version + 1）由调用方自行处理，这里跳过
+func setColumns(dst interface{}, data map[string]interface{}) error {
+	sch, err := schema.Parse(dst, &schemaCache, schema.NamingStrategy{})
+	if err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(dst).Elem()
+	for column, value := range data {
+		if _, ok := value.(clause.Expr); ok {
+			continue
+		}
+		field := sch.LookUpField(column)
+		if field == nil {
+			return fmt.Errorf("未知字段: %s", column)
+		}
+		if err := field.Set(context.Background(), rv, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseID(id string) (uint, error) {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return uint(n), nil
+}
+
+func paginate[T any](items []T, page, size int) []T {
+	start := (page - 1) * size
+	if start >= len(items) {
+		return []T{}
+	}
+	end := start + size
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end]
+}
+
+// copyUser 返回用户的副本，属性单独复制，调用方修改返回值不影响存储的数据
+func copyUser(u models.User) models.User {
+	if u.Attributes != nil {
+		attrs := make(models.Attributes, len(u.Attributes))
+		for k, v := range u.Attributes {
+			attrs[k] = v
+		}
+		u.Attributes = attrs
+	}
+	return u
+}
+
+// --- 用户 ---
+
+// sortedUsers 按 ID 顺序返回满足条件的用户副本
+func (s *memoryState) sortedUsers(match func(u *models.User) bool) []models.User {
+	users := make([]models.User, 0)
+	for _, u := range s.users {
+		if match(&u) {
+			users = append(users, copyUser(u))
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
+}
+
+func alive(u *models.User) bool { return !u.DeletedAt.Valid }
+
+// checkUserUnique 检查唯一键，对应数据库中的唯一索引
+func (s *memoryState) checkUserUnique(u *models.User) error {
+	for id, other := range s.users {
+		if id == u.ID {
+			continue
+		}
+		if u.UniqueUsername != nil && other.UniqueUsername != nil && *u.UniqueUsername == *other.UniqueUsername {
+			return &common.ConflictError{Field: "username"}
+		}
+		if u.UniqueEmail != nil && other.UniqueEmail != nil && *u.UniqueEmail == *other.UniqueEmail {
+			return &common.ConflictError{Field: "email"}
+		}
+		if u.PublicID != "" && u.PublicID == other.PublicID {
+			return &common.ConflictError{Field: "public_id"}
+		}
+	}
+	return nil
+}
+
+// insertUser 与 GORM 创建时一致：执行模型钩子、填充默认值和时间戳，并回写到 user
+func (s *memoryState) insertUser(user *models.User) error {
+	if err := user.BeforeSave(nil); err != nil {
+		return err
+	}
+	if err := user.BeforeCreate(nil); err != nil {
+		return err
+	}
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	if user.Status == "" {
+		user.Status = models.StatusActive
+	}
+	if user.Version == 0 {
+		user.Version = 1
+	}
+	now := time.Now()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	if user.UpdatedAt.IsZero() {
+		user.UpdatedAt = now
+	}
+	if err := s.checkUserUnique(user); err != nil {
+		return err
+	}
+	s.nextUserID++
+	user.ID = s.nextUserID
+	s.users[user.ID] = copyUser(*user)
+	return nil
+}
+
+func (m *MemoryRepository) InsertUser(user *models.User) error {
+	defer m.write()()
+	return m.state.insertUser(user)
+}
+
+func (m *MemoryRepository) CreateUsers(users []*models.User) error {
+	defer m.write()()
+	next := m.state.clone()
+	for _, u := range users {
+		if err := next.insertUser(u); err != nil {
+			return err
+		}
+	}
+	m.state = next
+	return nil
+}
+
+// findUser 按内部 ID 查找，unscoped 为 false 时不包括已软删除的用户
+func (s *memoryState) findUser(id string, unscoped bool) (models.User, error) {
+	n, err := parseID(id)
+	if err != nil {
+		return models.User{}, err
+	}
+	u, ok := s.users[n]
+	if !ok || (!unscoped && !alive(&u)) {
+		return models.User{}, gorm.ErrRecordNotFound
+	}
+	return u, nil
+}
+
+func (m *MemoryRepository) firstUser(match func(u *models.User) bool) (*models.User, error) {
+	defer m.read()()
+	users := m.state.sortedUsers(match)
+	if len(users) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &users[0], nil
+}
+
+func (m *MemoryRepository) GetUserByID(id string) (*models.User, error) {
+	defer m.read()()
+	u, err := m.state.findUser(id, false)
+	if err != nil {
+		return nil, err
+	}
+	u = copyUser(u)
+	return &u, nil
+}
+
+func (m *MemoryRepository) GetUserByIDUnscoped(id string) (*models.User, error) {
+	defer m.read()()
+	u, err := m.state.findUser(id, true)
+	if err != nil {
+		return nil, err
+	}
+	u = copyUser(u)
+	return &u, nil
+}
+
+func (m *MemoryRepository) GetUserByPublicID(publicID string) (*models.User, error) {
+	return m.firstUser(func(u *models.User) bool { return alive(u) && u.PublicID == publicID })
+}
+
+func (m *MemoryRepository) GetUserByUsername(username string) (*models.User, error) {
+	return m.firstUser(func(u *models.User) bool { return alive(u) && u.Username == username })
+}
+
+func (m *MemoryRepository) GetUserByEmail(email string) (*models.User, error) {
+	return m.firstUser(func(u *models.User) bool { return alive(u) && u.Email == email })
+}
+
+func (m *MemoryRepository) GetUsersByIDs(ids []uint) ([]models.User, error) {
+	set := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	defer m.read()()
+	return m.state.sortedUsers(func(u *models.User) bool { return alive(u) && set[u.ID] }), nil
+}
+
+func (m *MemoryRepository) GetUsersByPublicIDs(publicIDs []string) ([]models.User, error) {
+	set := make(map[string]bool, len(publicIDs))
+	for _, id := range publicIDs {
+		set[id] = true
+	}
+	defer m.read()()
+	return m.state.sortedUsers(func(u *models.User) bool { return alive(u) && set[u.PublicID] }), nil
+}
+
+func (m *MemoryRepository) GetUserVersion(id string) (uint, error) {
+	defer m.read()()
+	u, err := m.state.findUser(id, false)
+	return u.Version, err
+}
+
+func (m *MemoryRepository) FindUserIDByPublicID(publicID string) (uint, error) {
+	u, err := m.firstUser(func(u *models.User) bool { return u.PublicID == publicID })
+	if err != nil {
+		return 0, err
+	}
+	return u.ID, nil
+}
+
+// updateUser 在副本上修改并校验唯一键后写回，版本号加 1
+func (s *memoryState) updateUser(u models.User, change func(u *models.User) error) error {
+	u = copyUser(u)
+	if err := change(&u); err != nil {
+		return err
+	}
+	u.Version++
+	u.UpdatedAt = time.Now()
+	if err := s.checkUserUnique(&u); err != nil {
+		return err
+	}
+	s.users[u.ID] = u
+	return nil
+}
+
+// matchVersion 与 notFoundOrConflict 一致：未指定版本号时总是匹配
+func matchVersion(u *models.User, versions []uint) bool {
+	if len(versions) == 0 {
+		return true
+	}
+	for _, v := range versions {
+		if u.Version == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryRepository) UpdateUserByID(id string, versions []uint, updateData map[string]interface{}) error {
+	defer m.write()()
+	u, err := m.state.findUser(id, false)
+	if err != nil {
+		return err
+	}
+	if !matchVersion(&u, versions) {
+		return ErrVersionConflict
+	}
+	return m.state.updateUser(u, func(u *models.User) error { return setColumns(u, updateData) })
+}
+
+func (m *MemoryRepository) DeleteUserByID(id string, versions []uint) error {
+	defer m.write()()
+	u, err := m.state.findUser(id, false)
+	if err != nil {
+		return err
+	}
+	if !matchVersion(&u, versions) {
+		return ErrVersionConflict
+	}
+	return m.state.updateUser(u, func(u *models.User) error {
+		u.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		u.UniqueUsername, u.UniqueEmail = nil, nil
+		return nil
+	})
+}
+
+func (m *MemoryRepository) AnonymizeUserByID(id string, data map[string]interface{}) error {
+	defer m.write()()
+	u, err := m.state.findUser(id, true)
+	if err != nil {
+		return err
+	}
+	return m.state.updateUser(u, func(u *models.User) error { return setColumns(u, data) })
+}
+
+// attributeText 自定义属性的文本形式：字符串为原值，其他类型为 JSON 编码，
+// 与 MySQL 中 JSON_UNQUOTE(JSON_EXTRACT(...)) 的结果一致
+func attributeText(v interface{}) (string, bool) {
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+	if v == nil {
+		return "", false
+	}
+	b, err := json.Marshal(v)
+	return string(b), err == nil
+}
+
+func (m *MemoryRepository) ListUsers(page, size int, filters map[string]string) ([]models.User, int64, error) {
+	defer m.read()()
+	users := m.state.sortedUsers(func(u *models.User) bool {
+		if !alive(u) {
+			return false
+		}
+		for name, value := range filters {
+			if text, ok := attributeText(u.Attributes[name]); !ok || text != value {
+				return false
+			}
+		}
+		return true
+	})
+	return paginate(users, page, size), int64(len(users)), nil
+}
+
+func (m *MemoryRepository) FindExistingValues(column string, values []string) (map[string]bool, error) {
+	var get func(u *models.User) string
+	switch column {
+	case "username":
+		get = func(u *models.User) string { return u.Username }
+	case "email":
+		get = func(u *models.User) string { return u.Email }
+	default:
+		return nil, fmt.Errorf("未知字段: %s", column)
+	}
+	want := make(map[string]bool, len(values))
+	for _, v := range values {
+		want[v] = true
+	}
+
+	defer m.read()()
+	existing := make(map[string]bool)
+	for _, u := range m.state.users {
+		if alive(&u) && want[get(&u)] {
+			existing[get(&u)] = true
+		}
+	}
+	return existing, nil
+}
+
+// EachUserBatch 先取得快照再分批回调，回调中可以继续访问 repo
+func (m *MemoryRepository) EachUserBatch(batchSize int, fn func(users []models.User) error) error {
+	unlock := m.read()
+	users := m.state.sortedUsers(alive)
+	unlock()
+	for start := 0; start < len(users); start += batchSize {
+		end := start + batchSize
+		if end > len(users) {
+			end = len(users)
+		}
+		if err := fn(users[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryRepository) ListDeletedUsers(page, size int) ([]models.User, int64, error) {
+	defer m.read()()
+	users := m.state.sortedUsers(func(u *models.User) bool { return !alive(u) })
+	sort.SliceStable(users, func(i, j int) bool { return users[i].DeletedAt.Time.After(users[j].DeletedAt.Time) })
+	return paginate(users, page, size), int64(len(users)), nil
+}
+
+func (m *MemoryRepository) GetDeletedUserByID(id string) (*models.User, error) {
+	defer m.read()()
+	u, err := m.state.findUser(id, true)
+	if err != nil {
+		return nil, err
+	}
+	if alive(&u) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	u = copyUser(u)
+	return &u, nil
+}
+
+func (m *MemoryRepository) RestoreUserByID(id string) error {
+	defer m.write()()
+	u, err := m.state.findUser(id, true)
+	if err != nil {
+		return err
+	}
+	if alive(&u) {
+		return gorm.ErrRecordNotFound
+	}
+	return m.state.updateUser(u, func(u *models.User) error {
+		u.DeletedAt = gorm.DeletedAt{}
+		u.DeletionScheduledAt = nil
+		username, email := u.Username, u.Email
+		u.UniqueUsername, u.UniqueEmail = &username, &email
+		return nil
+	})
+}
+
+func (m *MemoryRepository) PurgeUserByID(id string) error {
+	defer m.write()()
+	u, err := m.state.findUser(id, true)
+	if err != nil {
+		return err
+	}
+	if alive(&u) {
+		return gorm.ErrRecordNotFound
+	}
+	delete(m.state.users, u.ID)
+	return nil
+}
+
+func deletedBefore(before time.Time) func(u *models.User) bool {
+	return func(u *models.User) bool { return !alive(u) && u.DeletedAt.Time.Before(before) }
+}
+
+func (m *MemoryRepository) PurgeUsersDeletedBefore(before time.Time) (int64, error) {
+	defer m.write()()
+	users := m.state.sortedUsers(deletedBefore(before))
+	for _, u := range users {
+		delete(m.state.users, u.ID)
+	}
+	return int64(len(users)), nil
+}
+
+func (m *MemoryRepository) FindAvatarsDeletedBefore(before time.Time) ([]string, error) {
+	defer m.read()()
+	var avatars []string
+	for _, u := range m.state.sortedUsers(deletedBefore(before)) {
+		if u.Avatar != "" {
+			avatars = append(avatars, u.Avatar)
+		}
+	}
+	return avatars, nil
+}
+
+func (m *MemoryRepository) FindUsersDueForDeletion(now time.Time) ([]models.User, error) {
+	defer m.read()()
+	return m.state.sortedUsers(func(u *models.User) bool {
+		return alive(u) && u.DeletionScheduledAt != nil && !u.DeletionScheduledAt.After(now)
+	}), nil
+}
+
+func (m *MemoryRepository) FindUsersWithExpiredStatus(now time.Time) ([]models.User, error) {
+	defer m.read()()
+	return m.state.sortedUsers(func(u *models.User) bool {
+		return alive(u) && (u.Status == models.StatusSuspended || u.Status == models.StatusBanned) &&
+			u.StatusExpiresAt != nil && !u.StatusExpiresAt.After(now)
+	}), nil
+}
+
+// --- 组 ---
+
+func (s *memoryState) checkGroupUnique(g *models.Group) error {
+	for id, other := range s.groups {
+		if id != g.ID && other.Name == g.Name {
+			return &common.ConflictError{Field: "name"}
+		}
+	}
+	return nil
+}
+
+func (m *MemoryRepository) CreateGroup(group *models.Group) error {
+	defer m.write()()
+	if err := m.state.checkGroupUnique(group); err != nil {
+		return err
+	}
+	now := time.Now()
+	group.CreatedAt, group.UpdatedAt = now, now
+	m.state.nextGroupID++
+	group.ID = m.state.nextGroupID
+	m.state.groups[group.ID] = *group
+	return nil
+}
+
+func (m *MemoryRepository) GetGroupByID(id string) (*models.Group, error) {
+	n, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	defer m.read()()
+	g, ok := m.state.groups[n]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &g, nil
+}
+
+func (m *MemoryRepository) ListGroups() ([]models.Group, error) {
+	defer m.read()()
+	groups := make([]models.Group, 0, len(m.state.groups))
+	for _, g := range m.state.groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	return groups, nil
+}
+
+func (m *MemoryRepository) UpdateGroupByID(id string, data map[string]interface{}) error {
+	n, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	defer m.write()()
+	g, ok := m.state.groups[n]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if err := setColumns(&g, data); err != nil {
+		return err
+	}
+	g.UpdatedAt = time.Now()
+	if err := m.state.checkGroupUnique(&g); err != nil {
+		return err
+	}
+	m.state.groups[n] = g
+	return nil
+}
+
+func (m *MemoryRepository) DeleteGroupByID(id uint) error {
+	defer m.write()()
+	if _, ok := m.state.groups[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	for key := range m.state.members {
+		if key[0] == id {
+			delete(m.state.members, key)
+		}
+	}
+	for key := range m.state.permissions {
+		if key.groupID == id {
+			delete(m.state.permissions, key)
+		}
+	}
+	delete(m.state.groups, id)
+	return nil
+}
+
+func (m *MemoryRepository) CountChildGroups(id uint) (int64, error) {
+	defer m.read()()
+	var count int64
+	for _, g := range m.state.groups {
+		if g.ParentID != nil && *g.ParentID == id {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryRepository) FindParentGroupIDs(ids []uint) ([]uint, error) {
+	defer m.read()()
+	seen := make(map[uint]bool)
+	parents := make([]uint, 0)
+	for _, id := range ids {
+		g, ok := m.state.groups[id]
+		if ok && g.ParentID != nil && !seen[*g.ParentID] {
+			seen[*g.ParentID] = true
+			parents = append(parents, *g.ParentID)
+		}
+	}
+	return parents, nil
+}
+
+// sortedMembers 按 (组 ID, 用户 ID) 顺序返回满足条件的成员关系
+func (s *memoryState) sortedMembers(match func(gm *models.GroupMember) bool) []models.GroupMember {
+	members := make([]models.GroupMember, 0)
+	for _, gm := range s.members {
+		if match(&gm) {
+			members = append(members, gm)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].GroupID != members[j].GroupID {
+			return members[i].GroupID < members[j].GroupID
+		}
+		return members[i].UserID < members[j].UserID
+	})
+	return members
+}
+
+func (m *MemoryRepository) ListGroupMembers(groupID uint) ([]models.GroupMember, error) {
+	defer m.read()()
+	members := m.state.sortedMembers(func(gm *models.GroupMember) bool { return gm.GroupID == groupID })
+	for i := range members {
+		// 与 Preload 一致，已软删除的用户不加载，只带 memberUserColumns 中的字段
+		if u, ok := m.state.users[members[i].UserID]; ok && alive(&u) {
+			members[i].User = &models.User{ID: u.ID, PublicID: u.PublicID, Username: u.Username, Status: u.Status}
+		}
+	}
+	return members, nil
+}
+
+func (m *MemoryRepository) UpsertGroupMember(member *models.GroupMember) error {
+	defer m.write()()
+	key := [2]uint{member.GroupID, member.UserID}
+	if member.Role == "" {
+		member.Role = models.GroupRoleMember
+	}
+	gm, ok := m.state.members[key]
+	if !ok {
+		gm = models.GroupMember{GroupID: member.GroupID, UserID: member.UserID, CreatedAt: time.Now()}
+	}
+	gm.Role = member.Role
+	m.state.members[key] = gm
+	return nil
+}
+
+func (m *MemoryRepository) DeleteGroupMember(groupID, userID uint) error {
+	defer m.write()()
+	key := [2]uint{groupID, userID}
+	if _, ok := m.state.members[key]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(m.state.members, key)
+	return nil
+}
+
+func (m *MemoryRepository) FindMemberGroupIDs(userID uint, role string) ([]uint, error) {
+	defer m.read()()
+	ids := make([]uint, 0)
+	for _, gm := range m.state.sortedMembers(func(gm *models.GroupMember) bool {
+		return gm.UserID == userID && (role == "" || gm.Role == role)
+	}) {
+		ids = append(ids, gm.GroupID)
+	}
+	return ids, nil
+}
+
+func (m *MemoryRepository) ListMembershipsOfUser(userID uint) ([]models.GroupMember, error) {
+	defer m.read()()
+	return m.state.sortedMembers(func(gm *models.GroupMember) bool { return gm.UserID == userID }), nil
+}
+
+func (m *MemoryRepository) DeleteOrphanMemberships() (int64, error) {
+	defer m.write()()
+	var n int64
+	for key, gm := range m.state.members {
+		if _, ok := m.state.users[gm.UserID]; !ok {
+			delete(m.state.members, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// sortedPermissions 按权限名排序、去重后返回满足条件的组权限
+func (s *memoryState) sortedPermissions(match func(groupID uint) bool) []string {
+	seen := make(map[string]bool)
+	perms := make([]string, 0)
+	for key := range s.permissions {
+		if match(key.groupID) && !seen[key.permission] {
+			seen[key.permission] = true
+			perms = append(perms, key.permission)
+		}
+	}
+	sort.Strings(perms)
+	return perms
+}
+
+func (m *MemoryRepository) ListGroupPermissions(groupID uint) ([]string, error) {
+	defer m.read()()
+	return m.state.sortedPermissions(func(id uint) bool { return id == groupID }), nil
+}
+
+func (m *MemoryRepository) FindPermissionsOfGroups(groupIDs []uint) ([]string, error) {
+	set := make(map[uint]bool, len(groupIDs))
+	for _, id := range groupIDs {
+		set[id] = true
+	}
+	defer m.read()()
+	return m.state.sortedPermissions(func(id uint) bool { return set[id] }), nil
+}
+
+func (m *MemoryRepository) AddGroupPermission(perm *models.GroupPermission) error {
+	defer m.write()()
+	key := groupPermissionKey{perm.GroupID, perm.Permission}
+	if _, ok := m.state.permissions[key]; ok {
+		return nil
+	}
+	perm.CreatedAt = time.Now()
+	m.state.permissions[key] = *perm
+	return nil
+}
+
+func (m *MemoryRepository) RemoveGroupPermission(groupID uint, permission string) error {
+	defer m.write()()
+	key := groupPermissionKey{groupID, permission}
+	if _, ok := m.state.permissions[key]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(m.state.permissions, key)
+	return nil
+}
+
+// --- 审计记录 ---
+
+func (m *MemoryRepository) CreateAuditLog(log *models.AuditLog) error {
+	defer m.write()()
+	m.state.nextAuditID++
+	log.ID = m.state.nextAuditID
+	log.CreatedAt = time.Now()
+	m.state.auditLogs = append(m.state.auditLogs, *log)
+	return nil
+}
+
+func (m *MemoryRepository) ListAuditLogs(userID string, page, size int) ([]models.AuditLog, int64, error) {
+	n, err := strconv.ParseUint(userID, 10, 64)
+	if err != nil {
+		return []models.AuditLog{}, 0, nil
+	}
+	defer m.read()()
+	logs := make([]models.AuditLog, 0)
+	for i := len(m.state.auditLogs) - 1; i >= 0; i-- {
+		if m.state.auditLogs[i].UserID == uint(n) {
+			logs = append(logs, m.state.auditLogs[i])
+		}
+	}
+	return paginate(logs, page, size), int64(len(logs)), nil
+}
+
+func (m *MemoryRepository) ListAllAuditLogsOf(userID uint) ([]models.AuditLog, error) {
+	defer m.read()()
+	logs := make([]models.AuditLog, 0)
+	for _, log := range m.state.auditLogs {
+		if log.UserID == userID || log.ActorID == userID {
+			logs = append(logs, log)
+		}
+	}
+	return logs, nil
+}
+
+func (m *MemoryRepository) RedactAuditLogs(userID uint, actions []string) error {
+	defer m.write()()
+	for i, log := range m.state.auditLogs {
+		if log.UserID == userID && slices.Contains(actions, log.Action) {
+			m.state.auditLogs[i].Detail = ""
+		}
+	}
+	return nil
+}
+
+// --- 邀请 ---
+
+func (m *MemoryRepository) CreateInvitation(inv *models.Invitation) error {
+	defer m.write()()
+	for _, other := range m.state.invitations {
+		if other.TokenHash == inv.TokenHash {
+			return errors.New("邀请 token 重复")
+		}
+	}
+	m.state.nextInvitationID++
+	inv.ID = m.state.nextInvitationID
+	inv.CreatedAt = time.Now()
+	m.state.invitations[inv.ID] = *inv
+	return nil
+}
+
+func (m *MemoryRepository) GetInvitationByID(id string) (*models.Invitation, error) {
+	n, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	defer m.read()()
+	inv, ok := m.state.invitations[n]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &inv, nil
+}
+
+func (m *MemoryRepository) GetInvitationByTokenHash(hash string) (*models.Invitation, error) {
+	defer m.read()()
+	for _, inv := range m.state.invitations {
+		if inv.TokenHash == hash {
+			return &inv, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *MemoryRepository) ListInvitations(inviterID uint, page, size int) ([]models.Invitation, int64, error) {
+	defer m.read()()
+	invs := make([]models.Invitation, 0)
+	for _, inv := range m.state.invitations {
+		if inviterID == 0 || inv.InviterID == inviterID {
+			invs = append(invs, inv)
+		}
+	}
+	sort.Slice(invs, func(i, j int) bool { return invs[i].ID > invs[j].ID })
+	return paginate(invs, page, size), int64(len(invs)), nil
+}
+
+func (m *MemoryRepository) MarkInvitationAccepted(id, userID uint, now time.Time) error {
+	defer m.write()()
+	inv, ok := m.state.invitations[id]
+	if !ok || !inv.Pending(now) {
+		return gorm.ErrRecordNotFound
+	}
+	inv.AcceptedAt, inv.UserID = &now, &userID
+	m.state.invitations[id] = inv
+	return nil
+}
+
+func (m *MemoryRepository) RevokeInvitation(id uint, now time.Time) error {
+	defer m.write()()
+	inv, ok := m.state.invitations[id]
+	if !ok || inv.AcceptedAt != nil || inv.RevokedAt != nil {
+		return gorm.ErrRecordNotFound
+	}
+	inv.RevokedAt = &now
+	m.state.invitations[id] = inv
+	return nil
+}
+
+func (m *MemoryRepository) AnonymizeInvitations(userID uint, email, replacement string) error {
+	defer m.write()()
+	for id, inv := range m.state.invitations {
+		if (inv.UserID != nil && *inv.UserID == userID) || inv.Email == email {
+			inv.Email = replacement
+			m.state.invitations[id] = inv
+		}
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+package dao
+
+import (
+	"gin-crud/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// UserRepository 服务层需要的全部数据访问。实现需与数据库行为一致：
+// 记录不存在时返回 gorm.ErrRecordNotFound，唯一键冲突时返回 *common.ConflictError，
+// 乐观锁校验失败时返回 ErrVersionConflict；按 ID 查询默认不包括已软删除的用户
+type UserRepository interface {
+	UserStore
+	GroupStore
+	AuditStore
+	InvitationStore
+
+	// Transaction 在事务中执行 fn，fn 返回错误时回滚。fn 内只能通过传入的 repo 访问数据
+	Transaction(fn func(repo UserRepository) error) error
+	// Primary 返回查询也使用主库的 repo，用于填充缓存和刚写入过的客户端，避免读到副本上尚未同步的旧数据
+	Primary() UserRepository
+}
+
+// UserStore 用户的读写
+type UserStore interface {
+	InsertUser(user *models.User) error
+	CreateUsers(users []*models.User) error
+	GetUserByID(id string) (*models.User, error)
+	GetUserByIDUnscoped(id string) (*models.User, error)
+	GetUserByPublicID(publicID string) (*models.User, error)
+	GetUserByUsername(username string) (*models.User, error)
+	GetUserByEmail(email string) (*models.User, error)
+	GetUsersByIDs(ids []uint) ([]models.User, error)
+	GetUsersByPublicIDs(publicIDs []string) ([]models.User, error)
+	GetUserVersion(id string) (uint, error)
+	FindUserIDByPublicID(publicID string) (uint, error)
+	UpdateUserByID(id string, versions []uint, updateData map[string]interface{}) error
+	DeleteUserByID(id string, versions []uint) error
+	AnonymizeUserByID(id string, data map[string]interface{}) error
+	ListUsers(page, size int, filters map[string]string) ([]models.User, int64, error)
+	FindExistingValues(column string, values []string) (map[string]bool, error)
+	EachUserBatch(batchSize int, fn func(users []models.User) error) error
+
+	ListDeletedUsers(page, size int) ([]models.User, int64, error)
+	GetDeletedUserByID(id string) (*models.User, error)
+	RestoreUserByID(id string) error
+	PurgeUserByID(id string) error
+	PurgeUsersDeletedBefore(before time.Time) (int64, error)
+	FindAvatarsDeletedBefore(before time.Time) ([]string, error)
+	FindUsersDueForDeletion(now time.Time) ([]models.User, error)
+	FindUsersWithExpiredStatus(now time.Time) ([]models.User, error)
+}
+
+// GroupStore 组、组成员和组权限的读写
+type GroupStore interface {
+	CreateGroup(group *models.Group) error
+	GetGroupByID(id string) (*models.Group, error)
+	ListGroups() ([]models.Group, error)
+	UpdateGroupByID(id string, data map[string]interface{}) error
+	DeleteGroupByID(id uint) error
+	CountChildGroups(id uint) (int64, error)
+	FindParentGroupIDs(ids []uint) ([]uint, error)
+
+	ListGroupMembers(groupID uint) ([]models.GroupMember, error)
+	UpsertGroupMember(member *models.GroupMember) error
+	DeleteGroupMember(groupID, userID uint) error
+	FindMemberGroupIDs(userID uint, role string) ([]uint, error)
+	ListMembershipsOfUser(userID uint) ([]models.GroupMember, error)
+	DeleteOrphanMemberships() (int64, error)
+
+	ListGroupPermissions(groupID uint) ([]string, error)
+	FindPermissionsOfGroups(groupIDs []uint) ([]string, error)
+	AddGroupPermission(perm *models.GroupPermission) error
+	RemoveGroupPermission(groupID uint, permission string) error
+}
+
+// AuditStore 审计记录的读写
+type AuditStore interface {
+	CreateAuditLog(log *models.AuditLog) error
+	ListAuditLogs(userID string, page, size int) ([]models.AuditLog, int64, error)
+	ListAllAuditLogsOf(userID uint) ([]models.AuditLog, error)
+	RedactAuditLogs(userID uint, actions []string) error
+}
+
+// InvitationStore 注册邀请的读写
+type InvitationStore interface {
+	CreateInvitation(inv *models.Invitation) error
+	GetInvitationByID(id string) (*models.Invitation, error)
+	GetInvitationByTokenHash(hash string) (*models.Invitation, error)
+	ListInvitations(inviterID uint, page, size int) ([]models.Invitation, int64, error)
+	MarkInvitationAccepted(id, userID uint, now time.Time) error
+	RevokeInvitation(id uint, now time.Time) error
+	AnonymizeInvitations(userID uint, email, replacement string) error
+}
+
+// GormRepository 基于 GORM 的 UserRepository，各方法直接调用本包中对应的函数。
+// 注册了读写分离时写入使用主库，查询由读写分离选择副本，Primary 返回的 repo 查询也使用主库
+type GormRepository struct {
+	db          *gorm.DB
+	readPrimary bool
+}
+
+func NewGormRepository(db *gorm.DB) *GormRepository {
+	return &GormRepository{db: db}
+}
+
+// primary 强制使用主库的连接，未注册读写分离时即为 r.db
+func (r *GormRepository) primary() *gorm.DB {
+	return r.db.Clauses(dbresolver.Write).Session(&gorm.Session{})
+}
+
+// reader 查询使用的连接
+func (r *GormRepository) reader() *gorm.DB {
+	if r.readPrimary {
+		return r.primary()
+	}
+	return r.db
+}
+
+func (r *GormRepository) Primary() UserRepository {
+	return &GormRepository{db: r.db, readPrimary: true}
+}
+
+func (r *GormRepository) Transaction(fn func(repo UserRepository) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&GormRepository{db: tx})
+	})
+}
+
+func (r *GormRepository) InsertUser(user *models.User) error {
+	return InsertUser(user, r.primary())
+}
+
+func (r *GormRepository) CreateUsers(users []*models.User) error {
+	return CreateUsers(users, r.primary())
+}
+
+func (r *GormRepository) GetUserByID(id string) (*models.User, error) {
+	return GetUserByID(id, r.reader())
+}
+
+func (r *GormRepository) GetUserByIDUnscoped(id string) (*models.User, error) {
+	return GetUserByIDUnscoped(id, r.reader())
+}
+
+func (r *GormRepository) GetUserByPublicID(publicID string) (*models.User, error) {
+	return GetUserByPublicID(publicID, r.reader())
+}
+
+func (r *GormRepository) GetUserByUsername(username string) (*models.User, error) {
+	return GetUserByUsername(username, r.reader())
+}
+
+func (r *GormRepository) GetUserByEmail(email string) (*models.User, error) {
+	return GetUserByEmail(email, r.reader())
+}
+
+func (r *GormRepository) GetUsersByIDs(ids []uint) ([]models.User, error) {
+	return GetUsersByIDs(ids, r.reader())
+}
+
+func (r *GormRepository) GetUsersByPublicIDs(publicIDs []string) ([]models.User, error) {
+	return GetUsersByPublicIDs(publicIDs, r.reader())
+}
+
+func (r *GormRepository) GetUserVersion(id string) (uint, error) {
+	return GetUserVersion(id, r.reader())
+}
+
+func (r *GormRepository) FindUserIDByPublicID(publicID string) (uint, error) {
+	return FindUserIDByPublicID(publicID, r.reader())
+}
+
+func (r *GormRepository) UpdateUserByID(id string, versions []uint, updateData map[string]interface{}) error {
+	return UpdateUserByID(id, versions, updateData, r.primary())
+}
+
+func (r *GormRepository) DeleteUserByID(id string, versions []uint) error {
+	return DeleteUserByID(id, versions, r.primary())
+}
+
+func (r *GormRepository) AnonymizeUserByID(id string, data map[string]interface{}) error {
+	return AnonymizeUserByID(id, data, r.primary())
+}
+
+func (r *GormRepository) ListUsers(page, size int, filters map[string]string) ([]models.User, int64, error) {
+	return ListUsers(page, size, filters, r.reader())
+}
+
+func (r *GormRepository) FindExistingValues(column string, values []string) (map[string]bool, error) {
+	return FindExistingValues(column, values, r.reader())
+}
+
+func (r *GormRepository) EachUserBatch(batchSize int, fn func(users []models.User) error) error {
+	return EachUserBatch(batchSize, r.reader(), fn)
+}
+
+func (r *GormRepository) ListDeletedUsers(page, size int) ([]models.User, int64, error) {
+	return ListDeletedUsers(page, size, r.reader())
+}
+
+func (r *GormRepository) GetDeletedUserByID(id string) (*models.User, error) {
+	return GetDeletedUserByID(id, r.reader())
+}
+
+func (r *GormRepository) RestoreUserByID(id string) error {
+	return RestoreUserByID(id, r.primary())
+}
+
+func (r *GormRepository) PurgeUserByID(id string) error {
+	return PurgeUserByID(id, r.primary())
+}
+
+func (r *GormRepository) PurgeUsersDeletedBefore(before time.Time) (int64, error) {
+	return PurgeUsersDeletedBefore(before, r.primary())
+}
+
+func (r *GormRepository) FindAvatarsDeletedBefore(before time.Time) ([]string, error) {
+	return FindAvatarsDeletedBefore(before, r.reader())
+}
+
+func (r *GormRepository) FindUsersDueForDeletion(now time.Time) ([]models.User, error) {
+	return FindUsersDueForDeletion(now, r.reader())
+}
+
+func (r *GormRepository) FindUsersWithExpiredStatus(now time.Time) ([]models.User, error) {
+	return FindUsersWithExpiredStatus(now, r.reader())
+}
+
+func (r *GormRepository) CreateGroup(group *models.Group) error {
+	return CreateGroup(group, r.primary())
+}
+
+func (r *GormRepository) GetGroupByID(id string) (*models.Group, error) {
+	return GetGroupByID(id, r.reader())
+}
+
+func (r *GormRepository) ListGroups() ([]models.Group, error) { return ListGroups(r.reader()) }
+
+func (r *GormRepository) UpdateGroupByID(id string, data map[string]interface{}) error {
+	return UpdateGroupByID(id, data, r.primary())
+}
+
+func (r *GormRepository) DeleteGroupByID(id uint) error {
+	return DeleteGroupByID(id, r.primary())
+}
+
+func (r *GormRepository) CountChildGroups(id uint) (int64, error) {
+	return CountChildGroups(id, r.reader())
+}
+
+func (r *GormRepository) FindParentGroupIDs(ids []uint) ([]uint, error) {
+	return FindParentGroupIDs(ids, r.reader())
+}
+
+func (r *GormRepository) ListGroupMembers(groupID uint) ([]models.GroupMember, error) {
+	return ListGroupMembers(groupID, r.reader())
+}
+
+func (r *GormRepository) UpsertGroupMember(member *models.GroupMember) error {
+	return UpsertGroupMember(member, r.primary())
+}
+
+func (r *GormRepository) DeleteGroupMember(groupID, userID uint) error {
+	return DeleteGroupMember(groupID, userID, r.primary())
+}
+
+func (r *GormRepository) FindMemberGroupIDs(userID uint, role string) ([]uint, error) {
+	return FindMemberGroupIDs(userID, role, r.reader())
+}
+
+func (r *GormRepository) ListMembershipsOfUser(userID uint) ([]models.GroupMember, error) {
+	return ListMembershipsOfUser(userID, r.reader())
+}
+
+func (r *GormRepository) DeleteOrphanMemberships() (int64, error) {
+	return DeleteOrphanMemberships(r.primary())
+}
+
+func (r *GormRepository) ListGroupPermissions(groupID uint) ([]string, error) {
+	return ListGroupPermissions(groupID, r.reader())
+}
+
+func (r *GormRepository) FindPermissionsOfGroups(groupIDs []uint) ([]string, error) {
+	return FindPermissionsOfGroups(groupIDs, r.reader())
+}
+
+func (r *GormRepository) AddGroupPermission(perm *models.GroupPermission) error {
+	return AddGroupPermission(perm, r.primary())
+}
+
+func (r *GormRepository) RemoveGroupPermission(groupID uint, permission string) error {
+	return RemoveGroupPermission(groupID, permission, r.primary())
+}
+
+func (r *GormRepository) CreateAuditLog(log *models.AuditLog) error {
+	return CreateAuditLog(log, r.primary())
+}
+
+func (r *GormRepository) ListAuditLogs(userID string, page, size int) ([]models.AuditLog, int64, error) {
+	return ListAuditLogs(userID, page, size, r.reader())
+}
+
+func (r *GormRepository) ListAllAuditLogsOf(userID uint) ([]models.AuditLog, error) {
+	return ListAllAuditLogsOf(userID, r.reader())
+}
+
+func (r *GormRepository) RedactAuditLogs(userID uint, actions []string) error {
+	return RedactAuditLogs(userID, actions, r.primary())
+}
+
+func (r *GormRepository) CreateInvitation(inv *models.Invitation) error {
+	return CreateInvitation(inv, r.primary())
+}
+
+func (r *GormRepository) GetInvitationByID(id string) (*models.Invitation, error) {
+	return GetInvitationByID(id, r.reader())
+}
+
+func (r *GormRepository) GetInvitationByTokenHash(hash string) (*models.Invitation, error) {
+	return GetInvitationByTokenHash(hash, r.reader())
+}
+
+func (r *GormRepository) ListInvitations(inviterID uint, page, size int) ([]models.Invitation, int64, error) {
+	return ListInvitations(inviterID, page, size, r.reader())
+}
+
+func (r *GormRepository) MarkInvitationAccepted(id, userID uint, now time.Time) error {
+	return MarkInvitationAccepted(id, userID, now, r.primary())
+}
+
+func (r *GormRepository) RevokeInvitation(id uint, now time.Time) error {
+	return RevokeInvitation(id, now, r.primary())
+}
+
+func (r *GormRepository) AnonymizeInvitations(userID uint, email, replacement string) error {
+	return AnonymizeInvitations(userID, email, replacement, r.primary())
+}
+
+var (
+	_ UserRepository = (*GormRepository)(nil)
+	_ UserRepository = (*MemoryRepository)(nil)
+)
@@ -1,56 +1,254 @@
 package dao
 
 import (
+	"errors"
 	"gin-crud/common"
 	"gin-crud/models"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-// CreateUser 创建用户 (暂时保留旧写法，后续可重构)
-func CreateUser(c *gin.Context, db *gorm.DB) {
+// GetUserByIDUnscoped 根据 ID 获取用户，包括已软删除的用户
+func GetUserByIDUnscoped(id string, db *gorm.DB) (*models.User, error) {
 	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		common.Fail(400, "参数校验失败: "+err.Error(), c)
-		return
-	}
-	if err := db.Create(&user).Error; err != nil {
-		common.Fail(500, "存储失败", c)
-		return
+	if err := db.Unscoped().Where(byID(id)).First(&user).Error; err != nil {
+		return nil, err
 	}
-	common.Success(user, "创建成功", c)
+	return &user, nil
+}
+
+// InsertUser 创建用户，唯一键冲突时返回 *common.ConflictError
+func InsertUser(user *models.User, db *gorm.DB) error {
+	return common.TranslateDBError(db.Create(user).Error)
 }
 
 // GetUserByID 根据 ID 获取用户
 func GetUserByID(id string, db *gorm.DB) (*models.User, error) {
 	var user models.User
-	if err := db.First(&user, id).Error; err != nil {
+	if err := db.Where(byID(id)).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserByPublicID 根据公开 ID 获取用户
+func GetUserByPublicID(publicID string, db *gorm.DB) (*models.User, error) {
+	var user models.User
+	if err := db.Where("public_id = ?", publicID).First(&user).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-// DeleteUserByID 根据 ID 删除用户
-func DeleteUserByID(id string, db *gorm.DB) error {
+// GetUserByUsername 根据规范化后的用户名获取用户
+func GetUserByUsername(username string, db *gorm.DB) (*models.User, error) {
 	var user models.User
-	// GORM 的 Delete 需要传入模型实例或带 Where 条件
-	// 这里我们先查一下是否存在，或者直接根据 ID 删除
-	// 直接删除更高效，但无法知道 ID 是否存在（除非检查 RowsAffected）
-	result := db.Where("id = ?", id).Delete(&user)
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserByEmail 根据规范化后的邮箱获取用户
+func GetUserByEmail(email string, db *gorm.DB) (*models.User, error) {
+	var user models.User
+	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUsersByIDs 根据 ID 批量获取未删除的用户，不保证顺序
+func GetUsersByIDs(ids []uint, db *gorm.DB) ([]models.User, error) {
+	var users []models.User
+	if len(ids) == 0 {
+		return users, nil
+	}
+	err := db.Where("id IN ?", ids).Find(&users).Error
+	return users, err
+}
+
+// GetUsersByPublicIDs 根据公开 ID 批量获取未删除的用户，不保证顺序
+func GetUsersByPublicIDs(publicIDs []string, db *gorm.DB) ([]models.User, error) {
+	var users []models.User
+	if len(publicIDs) == 0 {
+		return users, nil
+	}
+	err := db.Where("public_id IN ?", publicIDs).Find(&users).Error
+	return users, err
+}
+
+// GetUserVersion 查询用户当前的版本号
+func GetUserVersion(id string, db *gorm.DB) (uint, error) {
+	var user models.User
+	err := db.Select("version").Where("id = ?", id).First(&user).Error
+	return user.Version, err
+}
+
+// FindUserIDByPublicID 根据公开 ID 查询内部 ID，包括已软删除的用户
+func FindUserIDByPublicID(publicID string, db *gorm.DB) (uint, error) {
+	var user models.User
+	err := db.Unscoped().Select("id").Where("public_id = ?", publicID).First(&user).Error
+	return user.ID, err
+}
+
+// DeleteUserByID 根据 ID 软删除用户，同时清空唯一键以释放用户名和邮箱。
+// versions 非空时按乐观锁校验版本号，不匹配返回 ErrVersionConflict
+func DeleteUserByID(id string, versions []uint, db *gorm.DB) error {
+	// 直接更新比先查询更高效，通过 RowsAffected 判断 ID 是否存在
+	query := db.Model(&models.User{}).Where("id = ?", id)
+	if len(versions) > 0 {
+		query = query.Where("version IN ?", versions)
+	}
+	result := query.Updates(map[string]interface{}{
+		"deleted_at":      time.Now(),
+		"unique_username": nil,
+		"unique_email":    nil,
+		"version":         gorm.Expr("version + 1"),
+	})
 	if result.Error != nil {
 		return result.Error
 	}
 	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
+		return notFoundOrConflict(id, versions, db)
 	}
 	return nil
 }
 
-// UpdateUserByID 根据 ID 更新用户
-func UpdateUserByID(id string, updateData map[string]interface{}, db *gorm.DB) error {
+// ErrVersionConflict 乐观锁校验失败：记录存在但版本号不匹配
+var ErrVersionConflict = errors.New("version conflict")
+
+// UpdateUserByID 根据 ID 更新用户并将版本号加 1。
+// versions 非空时只有当前版本号属于其中之一才会更新（乐观锁），否则返回 ErrVersionConflict
+func UpdateUserByID(id string, versions []uint, updateData map[string]interface{}, db *gorm.DB) error {
+	updateData["version"] = gorm.Expr("version + 1")
+
 	// Updates 方法会自动忽略零值，非常适合 PATCH/PUT 操作
-	result := db.Model(&models.User{}).Where("id = ?", id).Updates(updateData)
+	query := db.Model(&models.User{}).Where("id = ?", id)
+	if len(versions) > 0 {
+		query = query.Where("version IN ?", versions)
+	}
+	result := query.Updates(updateData)
+	if result.Error != nil {
+		return common.TranslateDBError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return notFoundOrConflict(id, versions, db)
+	}
+	return nil
+}
+
+// notFoundOrConflict 条件更新未命中时区分记录不存在与版本号不匹配
+func notFoundOrConflict(id string, versions []uint, db *gorm.DB) error {
+	if len(versions) == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	var count int64
+	if err := db.Model(&models.User{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return ErrVersionConflict
+}
+
+// AnonymizeUserByID 原地覆盖用户的个人信息（包括已软删除的用户），版本号加 1
+func AnonymizeUserByID(id string, data map[string]interface{}, db *gorm.DB) error {
+	data["version"] = gorm.Expr("version + 1")
+	result := db.Unscoped().Model(&models.User{}).Where("id = ?", id).Updates(data)
+	if result.Error != nil {
+		return common.TranslateDBError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ListDeletedUsers 分页查询已软删除的用户（回收站）
+func ListDeletedUsers(page, size int, db *gorm.DB) ([]models.User, int64, error) {
+	var users []models.User
+	var total int64
+	query := db.Unscoped().Model(&models.User{}).Where("deleted_at IS NOT NULL")
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("deleted_at DESC").Offset((page - 1) * size).Limit(size).Find(&users).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// attributeCondition 自定义属性等于 value（文本形式）的查询条件，各数据库的 JSON 函数不同
+func attributeCondition(db *gorm.DB, name, value string) (string, []interface{}) {
+	path := `$."` + name + `"`
+	switch db.Dialector.Name() {
+	case "postgres":
+		return "attributes::jsonb ->> ? = ?", []interface{}{name, value}
+	case "sqlite":
+		// -> 返回属性的 JSON 文本，字符串带引号，数字和布尔值与文本形式相同
+		return "attributes -> ? IN (?, json_quote(?))", []interface{}{path, value, value}
+	default:
+		return "JSON_UNQUOTE(JSON_EXTRACT(attributes, ?)) = ?", []interface{}{path, value}
+	}
+}
+
+// ListUsers 分页查询未删除的用户，filters 为自定义属性名到值（文本形式）的等值条件。
+// 属性名必须已在上层按配置校验过，JSON 路径作为参数传入
+func ListUsers(page, size int, filters map[string]string, db *gorm.DB) ([]models.User, int64, error) {
+	var users []models.User
+	var total int64
+	query := db.Model(&models.User{})
+	for name, value := range filters {
+		cond, args := attributeCondition(db, name, value)
+		query = query.Where(cond, args...)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("id").Offset((page - 1) * size).Limit(size).Find(&users).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// GetDeletedUserByID 根据 ID 获取已软删除的用户
+func GetDeletedUserByID(id string, db *gorm.DB) (*models.User, error) {
+	var user models.User
+	if err := db.Unscoped().Where("deleted_at IS NOT NULL").Where(byID(id)).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// RestoreUserByID 恢复已软删除的用户并重新写入唯一键，用户名或邮箱已被占用时返回 *common.ConflictError
+func RestoreUserByID(id string, db *gorm.DB) error {
+	result := db.Unscoped().Model(&models.User{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Updates(map[string]interface{}{
+			"deleted_at":            nil,
+			"deletion_scheduled_at": nil,
+			"unique_username":       gorm.Expr("username"),
+			"unique_email":          gorm.Expr("email"),
+			"version":               gorm.Expr("version + 1"),
+		})
+	if result.Error != nil {
+		return common.TranslateDBError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// PurgeUserByID 永久删除已软删除的用户（只允许清除回收站中的记录）
+func PurgeUserByID(id string, db *gorm.DB) error {
+	result := db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).Delete(&models.User{})
 	if result.Error != nil {
 		return result.Error
 	}
@@ -60,6 +258,68 @@ func UpdateUserByID(id string, updateData map[string]interface{}, db *gorm.DB) e
 	return nil
 }
 
+// PurgeUsersDeletedBefore 永久删除在指定时间之前被软删除的用户，返回清除数量
+func PurgeUsersDeletedBefore(before time.Time, db *gorm.DB) (int64, error) {
+	result := db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", before).Delete(&models.User{})
+	return result.RowsAffected, result.Error
+}
+
+// FindAvatarsDeletedBefore 查询在指定时间之前被软删除、且设置了头像的用户的头像前缀
+func FindAvatarsDeletedBefore(before time.Time, db *gorm.DB) ([]string, error) {
+	var avatars []string
+	err := db.Unscoped().Model(&models.User{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ? AND avatar <> ''", before).
+		Pluck("avatar", &avatars).Error
+	return avatars, err
+}
+
+// FindUsersDueForDeletion 查询计划删除时间已到的用户
+func FindUsersDueForDeletion(now time.Time, db *gorm.DB) ([]models.User, error) {
+	var users []models.User
+	err := db.Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", now).Find(&users).Error
+	return users, err
+}
+
+// FindUsersWithExpiredStatus 查询暂停或封禁已到期、需要恢复正常的用户
+func FindUsersWithExpiredStatus(now time.Time, db *gorm.DB) ([]models.User, error) {
+	var users []models.User
+	err := db.Where("status IN ? AND status_expires_at IS NOT NULL AND status_expires_at <= ?",
+		[]string{models.StatusSuspended, models.StatusBanned}, now).Find(&users).Error
+	return users, err
+}
+
+// FindExistingValues 返回给定值中已被未删除用户占用的部分，column 为 username 或 email
+func FindExistingValues(column string, values []string, db *gorm.DB) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	if len(values) == 0 {
+		return existing, nil
+	}
+	var found []string
+	if err := db.Model(&models.User{}).Where(column+" IN ?", values).Pluck(column, &found).Error; err != nil {
+		return nil, err
+	}
+	for _, v := range found {
+		existing[v] = true
+	}
+	return existing, nil
+}
+
+// CreateUsers 在同一事务中批量创建用户，任一失败则整体回滚
+func CreateUsers(users []*models.User, db *gorm.DB) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return tx.Create(&users).Error
+	})
+	return common.TranslateDBError(err)
+}
+
+// EachUserBatch 按主键顺序分批遍历所有未删除用户
+func EachUserBatch(batchSize int, db *gorm.DB, fn func(users []models.User) error) error {
+	var users []models.User
+	return db.Order("id").FindInBatches(&users, batchSize, func(tx *gorm.DB, batch int) error {
+		return fn(users)
+	}).Error
+}
+
 // --- 以下旧方法已废弃，待 main.go 彻底移除引用后可删除 ---
 
 // GetUser (旧)
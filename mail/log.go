@@ -0,0 +1,20 @@
+package mail
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// LogMailer 只把邮件写入日志，用于开发环境
+type LogMailer struct {
+	Logger *zap.Logger
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.Logger.Info("发送邮件",
+		zap.String("to", msg.To),
+		zap.String("subject", msg.Subject),
+		zap.String("body", msg.Body))
+	return nil
+}
@@ -0,0 +1,15 @@
+package mail
+
+import "context"
+
+// Message 一封纯文本邮件
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer 邮件发送
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
@@ -1,16 +1,26 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"gin-crud/cache"
 	"gin-crud/common"
 	"gin-crud/controller"
+	"gin-crud/dao"
 	"gin-crud/models"
+	"gin-crud/search"
 	"gin-crud/service"
+	"gin-crud/storage"
+	"net/http"
+	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"github.com/swaggo/swag"
 
-	_ "gin-crud/docs" // 必须导入生成的 docs 包
+	"gin-crud/docs"
 )
 
 // @title           Gin CRUD API
@@ -18,26 +28,68 @@ import (
 // @description     这是一个基于 Gin 的 CRUD 示例项目
 // @host            localhost:8080
 // @BasePath        /
+// @securityDefinitions.apikey  ApiKeyAuth
+// @in                          header
+// @name                        Authorization
 func main() {
 	common.InitConfig()
 	common.InitLogger()        // 初始化日志
 	defer common.Logger.Sync() // 刷新缓冲
 
-	common.InitDB()    // 初始化数据库
-	common.InitRedis() // 初始化 Redis
+	// go run . migrate up|down|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
+	common.InitDB()      // 初始化数据库
+	common.InitRedis()   // 初始化 Redis
+	common.InitCache()   // 初始化缓存
+	common.InitStorage() // 初始化对象存储
+	common.InitMailer()  // 初始化邮件发送
+	common.InitSearch()  // 初始化用户检索
 
 	// 使用自定义的 Logger 和 Recovery
 	r := gin.New()
 	r.Use(common.GinLogger(), common.GinRecovery(true))
 
 	// 注入 DB 和 Redis
+	repo := dao.NewGormRepository(common.DB)
 	userService := &service.UserService{
-		DB:  common.DB,
-		RDB: common.RDB,
+		Repo:   repo,
+		RDB:    common.RDB,
+		Cache:  common.CacheStore,
+		Blobs:  common.Blob,
+		Mailer: common.Mailer,
+		Search: common.SearchIndex,
+	}
+	if size := common.Conf.Cache.Local.Size; size > 0 {
+		userService.Local = cache.NewLRU(size)
+	}
+
+	// 进程内索引不持久化，启动时全量重建
+	if _, ok := common.SearchIndex.(*search.MemoryIndex); ok {
+		n, err := userService.RebuildSearchIndex()
+		if err != nil {
+			panic("用户检索索引重建失败: " + err.Error())
+		}
+		common.Logger.Info(fmt.Sprintf("用户检索索引重建完成，共 %d 个用户", n))
+	}
+
+	// 后台定时任务：执行到期的自助注销、清理回收站
+	go userService.RunMaintenance(context.Background())
+	// 接收其他实例的缓存失效通知
+	go userService.RunCacheInvalidation(context.Background())
+
+	// 写请求后 stickyWindow 内同一客户端的查询使用主库，处理函数通过 scoped 取得当前请求使用的服务
+	r.Use(controller.ReadYourWrites(time.Duration(common.Conf.Datasource.StickyWindow)*time.Millisecond, []byte(common.Conf.Jwt.Secret)))
+	scoped := func(c *gin.Context) *service.UserService {
+		return controller.ServiceFor(c, userService)
 	}
 
-	// Swagger 路由
-	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	// Swagger 路由，文档中的自定义属性按配置动态生成
+	swag.Register("api", controller.SwaggerDoc{Base: docs.SwaggerInfo})
+	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.InstanceName("api")))
 
 	// 配置热更新测试接口
 	r.GET("/config-test", func(c *gin.Context) {
@@ -47,41 +99,201 @@ func main() {
 		})
 	})
 
+	// 本地存储的文件通过签名 URL 访问，S3 存储直接使用预签名地址
+	if local, ok := common.Blob.(*storage.LocalStore); ok {
+		r.GET("/blobs/*key", gin.WrapH(http.StripPrefix("/blobs", local.Handler())))
+	}
+
 	// 公开接口
 	r.POST("/login", func(c *gin.Context) {
-		controller.Login(c, userService)
+		controller.Login(c, scoped(c))
 	})
 	r.POST("/refresh", func(c *gin.Context) {
-		controller.RefreshToken(c, userService)
+		controller.RefreshToken(c, scoped(c))
 	})
 	r.POST("/logout", func(c *gin.Context) {
-		controller.Logout(c, userService)
+		controller.Logout(c, scoped(c))
 	})
 
 	r.POST("/register", func(c *gin.Context) {
-		// 你也可以在这里把 dao.CreateUser 重构进 service
-		var user models.User
-		if err := c.ShouldBindJSON(&user); err != nil {
-			common.Fail(400, "参数错误", c)
-			return
-		}
-		if err := userService.Register(&user); err != nil {
-			common.Fail(500, err.Error(), c)
-			return
-		}
-		common.Success(user, "注册成功", c)
+		controller.Register(c, scoped(c))
+	})
+	// 修改邮箱的确认和撤销链接，通过邮件中的 token 鉴权；链接打开确认页，页面提交后才修改
+	r.GET("/email-change/confirm", func(c *gin.Context) {
+		controller.ConfirmEmailChangePage(c)
+	})
+	r.POST("/email-change/confirm", func(c *gin.Context) {
+		controller.ConfirmEmailChange(c, scoped(c))
+	})
+	r.GET("/email-change/cancel", func(c *gin.Context) {
+		controller.CancelEmailChangePage(c)
+	})
+	r.POST("/email-change/cancel", func(c *gin.Context) {
+		controller.CancelEmailChange(c, scoped(c))
+	})
+	// 邀请注册，通过邮件中的 token 鉴权
+	r.GET("/invitations/accept", func(c *gin.Context) {
+		controller.GetInvitation(c, scoped(c))
+	})
+	r.POST("/invitations/accept", func(c *gin.Context) {
+		controller.AcceptInvitation(c, scoped(c))
 	})
 	// 路由分组1
 	userGroup := r.Group("/users")
 	{
+		// 列表和批量查询可遍历全部用户，需管理员或通过组获得 user:list 权限
+		userGroup.GET("", controller.AuthMiddleware(userService), controller.RequirePermission(userService, models.PermissionUserList), func(c *gin.Context) {
+			controller.ListUsers(c, scoped(c))
+		})
 		userGroup.GET("/:id", func(c *gin.Context) {
-			controller.GetUser(c, userService)
+			controller.GetUser(c, scoped(c))
 		})
-		userGroup.PUT("/:id", func(c *gin.Context) {
-			controller.UpdateUser(c, userService)
+		// 只能修改自己的信息，管理员可以修改任意用户
+		userGroup.PUT("/:id", controller.AuthMiddleware(userService), func(c *gin.Context) {
+			controller.UpdateUser(c, scoped(c))
 		})
 		userGroup.DELETE("/:id", func(c *gin.Context) {
-			controller.DeleteUser(c, userService)
+			controller.DeleteUser(c, scoped(c))
+		})
+		userGroup.GET("/:id/avatar", func(c *gin.Context) {
+			controller.GetUserAvatar(c, scoped(c))
+		})
+	}
+	// 当前用户接口
+	meGroup := r.Group("/me")
+	meGroup.Use(controller.AuthMiddleware(userService))
+	{
+		meGroup.GET("", func(c *gin.Context) {
+			controller.GetMe(c, scoped(c))
+		})
+		meGroup.PATCH("", func(c *gin.Context) {
+			controller.UpdateMe(c, scoped(c))
+		})
+		meGroup.DELETE("", func(c *gin.Context) {
+			controller.DeleteMe(c, scoped(c))
+		})
+		meGroup.POST("/password", func(c *gin.Context) {
+			controller.ChangeMyPassword(c, scoped(c))
+		})
+		meGroup.POST("/email", func(c *gin.Context) {
+			controller.ChangeMyEmail(c, scoped(c))
+		})
+		meGroup.POST("/deletion/cancel", func(c *gin.Context) {
+			controller.CancelMyDeletion(c, scoped(c))
+		})
+		meGroup.GET("/groups", func(c *gin.Context) {
+			controller.GetMyGroups(c, scoped(c))
+		})
+		meGroup.PUT("/avatar", func(c *gin.Context) {
+			controller.UploadMyAvatar(c, scoped(c))
+		})
+		meGroup.DELETE("/avatar", func(c *gin.Context) {
+			controller.DeleteMyAvatar(c, scoped(c))
+		})
+	}
+	// 组成员管理，管理员或组 owner 可操作
+	groupGroup := r.Group("/groups")
+	groupGroup.Use(controller.AuthMiddleware(userService))
+	{
+		groupGroup.GET("/:id/members", func(c *gin.Context) {
+			controller.ListGroupMembers(c, scoped(c))
+		})
+		groupGroup.PUT("/:id/members/:user_id", func(c *gin.Context) {
+			controller.AddGroupMember(c, scoped(c))
+		})
+		groupGroup.DELETE("/:id/members/:user_id", func(c *gin.Context) {
+			controller.RemoveGroupMember(c, scoped(c))
+		})
+	}
+	// 邀请管理，管理员或组 owner 可创建
+	invitationGroup := r.Group("/invitations")
+	invitationGroup.Use(controller.AuthMiddleware(userService))
+	{
+		invitationGroup.GET("", func(c *gin.Context) {
+			controller.ListInvitations(c, scoped(c))
+		})
+		invitationGroup.POST("", func(c *gin.Context) {
+			controller.CreateInvitation(c, scoped(c))
+		})
+		invitationGroup.DELETE("/:id", func(c *gin.Context) {
+			controller.RevokeInvitation(c, scoped(c))
+		})
+	}
+	// 管理员接口
+	adminGroup := r.Group("/admin")
+	adminGroup.Use(controller.AuthMiddleware(userService), controller.AdminMiddleware())
+	{
+		adminGroup.GET("/cache/stats", func(c *gin.Context) {
+			controller.GetCacheStats(c, scoped(c))
+		})
+		adminGroup.GET("/db/stats", func(c *gin.Context) {
+			controller.GetDBStats(c)
+		})
+		adminGroup.GET("/users/search", func(c *gin.Context) {
+			controller.SearchUsers(c, scoped(c))
+		})
+		adminGroup.GET("/users/trash", func(c *gin.Context) {
+			controller.ListDeletedUsers(c, scoped(c))
+		})
+		adminGroup.POST("/users/trash/:id/restore", func(c *gin.Context) {
+			controller.RestoreUser(c, scoped(c))
+		})
+		adminGroup.DELETE("/users/trash/:id", func(c *gin.Context) {
+			controller.PurgeUser(c, scoped(c))
+		})
+		adminGroup.POST("/users/import", func(c *gin.Context) {
+			controller.ImportUsers(c, scoped(c))
+		})
+		adminGroup.GET("/users/export", func(c *gin.Context) {
+			controller.ExportUsers(c, scoped(c))
+		})
+		adminGroup.POST("/users/:id/suspend", func(c *gin.Context) {
+			controller.SuspendUser(c, scoped(c))
+		})
+		adminGroup.POST("/users/:id/ban", func(c *gin.Context) {
+			controller.BanUser(c, scoped(c))
+		})
+		adminGroup.POST("/users/:id/activate", func(c *gin.Context) {
+			controller.ActivateUser(c, scoped(c))
+		})
+		adminGroup.GET("/users/:id/audit-logs", func(c *gin.Context) {
+			controller.ListAuditLogs(c, scoped(c))
+		})
+		adminGroup.POST("/users/:id/data-export", func(c *gin.Context) {
+			controller.StartDataExport(c, scoped(c))
+		})
+		adminGroup.POST("/users/:id/erase", func(c *gin.Context) {
+			controller.EraseUser(c, scoped(c))
+		})
+		adminGroup.GET("/users/:id/groups", func(c *gin.Context) {
+			controller.GetUserGroups(c, scoped(c))
+		})
+		adminGroup.GET("/groups", func(c *gin.Context) {
+			controller.ListGroups(c, scoped(c))
+		})
+		adminGroup.POST("/groups", func(c *gin.Context) {
+			controller.CreateGroup(c, scoped(c))
+		})
+		adminGroup.PUT("/groups/:id", func(c *gin.Context) {
+			controller.UpdateGroup(c, scoped(c))
+		})
+		adminGroup.DELETE("/groups/:id", func(c *gin.Context) {
+			controller.DeleteGroup(c, scoped(c))
+		})
+		adminGroup.GET("/groups/:id/permissions", func(c *gin.Context) {
+			controller.ListGroupPermissions(c, scoped(c))
+		})
+		adminGroup.POST("/groups/:id/permissions", func(c *gin.Context) {
+			controller.GrantGroupPermission(c, scoped(c))
+		})
+		adminGroup.DELETE("/groups/:id/permissions/:permission", func(c *gin.Context) {
+			controller.RevokeGroupPermission(c, scoped(c))
+		})
+		adminGroup.GET("/data-exports/:job", func(c *gin.Context) {
+			controller.GetDataExport(c, scoped(c))
+		})
+		adminGroup.GET("/data-exports/:job/download", func(c *gin.Context) {
+			controller.DownloadDataExport(c, scoped(c))
 		})
 	}
 
@@ -0,0 +1,79 @@
+package migrate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// schemaObject 迁移脚本创建的表、列或索引，Column 与 Index 都为空时表示表本身
+type schemaObject struct {
+	Table  string
+	Column string
+	Index  string
+}
+
+func (o schemaObject) String() string {
+	switch {
+	case o.Column != "":
+		return fmt.Sprintf("列 %s.%s", o.Table, o.Column)
+	case o.Index != "":
+		return fmt.Sprintf("索引 %s.%s", o.Table, o.Index)
+	}
+	return "表 " + o.Table
+}
+
+func (o schemaObject) exists(db *gorm.DB) bool {
+	switch {
+	case o.Column != "":
+		return db.Migrator().HasColumn(o.Table, o.Column)
+	case o.Index != "":
+		return db.Migrator().HasIndex(o.Table, o.Index)
+	}
+	return db.Migrator().HasTable(o.Table)
+}
+
+// 标识符可以用反引号、双引号或不加引号
+const ident = "[`\"]?(\\w+)[`\"]?"
+
+var (
+	createTable = regexp.MustCompile(`(?i)^CREATE TABLE ` + ident + ` \(`)
+	createIndex = regexp.MustCompile(`(?i)^CREATE (?:UNIQUE |FULLTEXT )?INDEX ` + ident + ` ON ` + ident)
+	addColumn   = regexp.MustCompile(`(?i)^ALTER TABLE ` + ident + ` ADD (?:COLUMN )?` + ident)
+	// CREATE TABLE 中的列定义和内联索引，每行一个
+	columnDef   = regexp.MustCompile("^[`\"](\\w+)[`\"] ")
+	inlineIndex = regexp.MustCompile(`(?i)^(?:UNIQUE |FULLTEXT )?INDEX ` + ident)
+)
+
+// schemaObjects 从脚本中识别 CREATE TABLE、CREATE INDEX 和 ALTER TABLE ADD COLUMN 创建的对象，
+// 用于设置基线前核对表结构。其它语句（如数据更新）不产生对象
+func schemaObjects(script string) []schemaObject {
+	var objects []schemaObject
+	for _, stmt := range splitStatements(script) {
+		if m := createIndex.FindStringSubmatch(stmt); m != nil {
+			objects = append(objects, schemaObject{Table: m[2], Index: m[1]})
+			continue
+		}
+		if m := addColumn.FindStringSubmatch(stmt); m != nil {
+			objects = append(objects, schemaObject{Table: m[1], Column: m[2]})
+			continue
+		}
+		m := createTable.FindStringSubmatch(stmt)
+		if m == nil {
+			continue
+		}
+		table := m[1]
+		objects = append(objects, schemaObject{Table: table})
+		for _, line := range strings.Split(stmt, "\n")[1:] {
+			line = strings.TrimSpace(line)
+			if c := columnDef.FindStringSubmatch(line); c != nil {
+				objects = append(objects, schemaObject{Table: table, Column: c[1]})
+			} else if i := inlineIndex.FindStringSubmatch(line); i != nil {
+				objects = append(objects, schemaObject{Table: table, Index: i[1]})
+			}
+		}
+	}
+	return objects
+}
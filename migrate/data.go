@@ -0,0 +1,63 @@
+package migrate
+
+import (
+	"fmt"
+	"gin-crud/models"
+
+	"gorm.io/gorm"
+)
+
+// dataMigrations 各数据库共用的数据迁移，按版本号与 SQL 脚本合并。
+// 回填的数据在回滚后仍然有效，DownFunc 只删除执行记录
+var dataMigrations = []Migration{
+	{Version: 3, Name: "backfill_user_unique_keys", UpFunc: backfillUserUniqueKeys, DownFunc: keepData},
+	{Version: 4, Name: "backfill_user_public_ids", UpFunc: backfillUserPublicIDs, DownFunc: keepData},
+}
+
+func keepData(tx *gorm.DB) error {
+	return nil
+}
+
+// backfillUserUniqueKeys 为唯一键尚未填充的存量用户规范化用户名、邮箱并写入唯一键。
+// 存量数据中有重复时迁移失败并回滚，需要人工处理重复的用户后重新执行
+func backfillUserUniqueKeys(tx *gorm.DB) error {
+	var users []models.User
+	if err := tx.Where("unique_username IS NULL OR unique_email IS NULL").Find(&users).Error; err != nil {
+		return err
+	}
+	for _, u := range users {
+		username := models.NormalizeUsername(u.Username)
+		email := models.NormalizeEmail(u.Email)
+		err := tx.Model(&models.User{}).Where("id = ?", u.ID).UpdateColumns(map[string]interface{}{
+			"username":        username,
+			"email":           email,
+			"unique_username": username,
+			"unique_email":    email,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("用户 %d 的唯一键回填失败: %w", u.ID, err)
+		}
+	}
+	return nil
+}
+
+// backfillUserPublicIDs 为存量用户（含已软删除的）按注册时间生成公开 ID，分批处理
+func backfillUserPublicIDs(tx *gorm.DB) error {
+	var users []models.User
+	return tx.Unscoped().Select("id", "created_at").
+		Where("public_id IS NULL OR public_id = ''").
+		FindInBatches(&users, 500, func(batch *gorm.DB, n int) error {
+			for _, u := range users {
+				publicID, err := models.NewPublicID(u.CreatedAt)
+				if err != nil {
+					return err
+				}
+				err = tx.Unscoped().Model(&models.User{}).Where("id = ?", u.ID).
+					UpdateColumn("public_id", publicID).Error
+				if err != nil {
+					return fmt.Errorf("用户 %d 的公开 ID 回填失败: %w", u.ID, err)
+				}
+			}
+			return nil
+		}).Error
+}
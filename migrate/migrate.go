@@ -0,0 +1,413 @@
+package migrate
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// sqlFiles 各数据库的迁移脚本，按数据库名分目录，随二进制文件发布
+//
+//go:embed sql
+var sqlFiles embed.FS
+
+var (
+	// ErrLocked 等待迁移锁超时，通常是另一个实例正在执行迁移
+	ErrLocked = errors.New("迁移锁被占用")
+	// ErrIrreversible 迁移没有对应的 down 脚本
+	ErrIrreversible = errors.New("迁移不支持回滚")
+	// ErrNoBaseline 数据库已有业务表但没有迁移记录，需要核对表结构后执行 migrate baseline
+	ErrNoBaseline = errors.New("数据库已有表但没有迁移记录，请先执行 migrate baseline")
+)
+
+// Migration 一个版本的结构变更，Up / Down 为以分号结尾的若干条 SQL 语句。
+// 无法用 SQL 表达的数据迁移由 UpFunc / DownFunc 实现，与脚本在同一事务中执行
+type Migration struct {
+	Version  uint
+	Name     string
+	Up       string
+	Down     string
+	UpFunc   func(tx *gorm.DB) error
+	DownFunc func(tx *gorm.DB) error
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Status 迁移及其执行时间，AppliedAt 为空表示尚未执行
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// fileName 迁移文件名，例: 0002_add_user_phone.up.sql
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load 读取 dir 下的迁移脚本并按版本号排序。每个版本必须有 up 脚本，down 脚本可选
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[uint]*Migration)
+	for _, entry := range entries {
+		m := fileName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("无法识别的迁移文件: %s", entry.Name())
+		}
+		v, _ := strconv.ParseUint(m[1], 10, 32)
+		if v == 0 {
+			return nil, fmt.Errorf("迁移版本号必须大于 0: %s", entry.Name())
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[uint(v)]
+		if !ok {
+			mig = &Migration{Version: uint(v), Name: m[2]}
+			byVersion[uint(v)] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("迁移版本号重复: %s 与 %s", mig, entry.Name())
+		}
+		if m[3] == "up" {
+			mig.Up = string(data)
+		} else {
+			mig.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if strings.TrimSpace(mig.Up) == "" && mig.UpFunc == nil {
+			return nil, fmt.Errorf("迁移缺少 up 脚本: %s", mig)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Embedded 内置的指定数据库（mysql / postgres / sqlite）的迁移，包括各数据库共用的数据迁移
+func Embedded(dialect string) ([]Migration, error) {
+	migrations, err := Load(sqlFiles, path.Join("sql", dialect))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("没有 %s 数据库的迁移脚本", dialect)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range dataMigrations {
+		for _, mig := range migrations {
+			if mig.Version == data.Version {
+				return nil, fmt.Errorf("迁移版本号重复: %s 与 %s", mig, data)
+			}
+		}
+		migrations = append(migrations, data)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// splitStatements 按行尾分号拆分脚本，忽略 -- 开头的注释行。脚本中的字符串不应包含行尾分号
+func splitStatements(script string) []string {
+	var stmts []string
+	var b strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSuffix(strings.TrimSpace(b.String()), ";"))
+			b.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(b.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+	return stmts
+}
+
+// schemaMigration 已执行的迁移，每个版本一行
+type schemaMigration struct {
+	Version   uint   `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:255"`
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrator 按版本号顺序执行迁移，执行记录保存在 schema_migrations 表中。
+// MySQL 的 DDL 会隐式提交，失败的迁移可能已执行了一部分，需要人工处理后重试，
+// 因此每个迁移应尽量只做一件事
+type Migrator struct {
+	db          *gorm.DB
+	migrations  []Migration
+	LockTimeout time.Duration // 等待迁移锁的时长，默认 30 秒
+}
+
+// New 使用内置迁移创建 Migrator，数据库类型由连接决定
+func New(db *gorm.DB) (*Migrator, error) {
+	migrations, err := Embedded(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	return NewWithMigrations(db, migrations), nil
+}
+
+// NewWithMigrations 使用指定的迁移创建 Migrator，migrations 须已按版本号排序
+func NewWithMigrations(db *gorm.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations, LockTimeout: 30 * time.Second}
+}
+
+// applied 已执行的版本及执行时间，记录表不存在时为空
+func (m *Migrator) applied(db *gorm.DB) (map[uint]time.Time, error) {
+	versions := make(map[uint]time.Time)
+	if !db.Migrator().HasTable(&schemaMigration{}) {
+		return versions, nil
+	}
+	var rows []schemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		versions[row.Version] = row.AppliedAt
+	}
+	return versions, nil
+}
+
+// Status 全部迁移的执行情况
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied(m.db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := Status{Migration: mig}
+		if at, ok := applied[mig.Version]; ok {
+			s.AppliedAt = &at
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// Pending 尚未执行的迁移
+func (m *Migrator) Pending() ([]Migration, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up 依次执行版本号不超过 target 的未执行迁移，target 为 0 时执行全部，返回本次执行的迁移。
+// 数据库已有由 AutoMigrate 创建的表而没有迁移记录时返回 ErrNoBaseline，需要先执行 Baseline
+func (m *Migrator) Up(target uint) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(func(db *gorm.DB) error {
+		if err := m.ensureTable(db); err != nil {
+			return err
+		}
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if target > 0 && mig.Version > target {
+				break
+			}
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := m.apply(db, mig, true); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down 按版本号倒序回滚最近执行的 steps 个迁移，返回本次回滚的迁移
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(func(db *gorm.DB) error {
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if strings.TrimSpace(mig.Down) == "" && mig.DownFunc == nil {
+				return fmt.Errorf("%s: %w", mig, ErrIrreversible)
+			}
+			if err := m.apply(db, mig, false); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// ensureTable 创建记录表；已有业务表说明数据库此前由 AutoMigrate 维护，
+// 表结构不一定与迁移一致，不自动设置基线
+func (m *Migrator) ensureTable(db *gorm.DB) error {
+	if db.Migrator().HasTable(&schemaMigration{}) {
+		return nil
+	}
+	if db.Migrator().HasTable("users") {
+		return ErrNoBaseline
+	}
+	return db.Migrator().CreateTable(&schemaMigration{})
+}
+
+// Baseline 将版本号不超过 target 的迁移记为已执行而不实际执行，用于此前由 AutoMigrate 维护的数据库，
+// target 为 0 时只包括第一个迁移。记录前逐一检查这些迁移创建的表、列和索引在数据库中都已存在，
+// 缺少时返回错误并列出缺少的对象；数据迁移必须实际执行，不能包括在基线中
+func (m *Migrator) Baseline(target uint) ([]Migration, error) {
+	if target == 0 && len(m.migrations) > 0 {
+		target = m.migrations[0].Version
+	}
+	var done []Migration
+	err := m.withLock(func(db *gorm.DB) error {
+		if db.Migrator().HasTable(&schemaMigration{}) {
+			return errors.New("数据库已有迁移记录，不需要设置基线")
+		}
+		var missing []string
+		for _, mig := range m.migrations {
+			if mig.Version > target {
+				break
+			}
+			if mig.UpFunc != nil {
+				return fmt.Errorf("基线不能包括数据迁移 %s", mig)
+			}
+			for _, obj := range schemaObjects(mig.Up) {
+				if !obj.exists(db) {
+					missing = append(missing, obj.String())
+				}
+			}
+			done = append(done, mig)
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("表结构与迁移不一致，缺少: %s", strings.Join(missing, ", "))
+		}
+		if err := db.Migrator().CreateTable(&schemaMigration{}); err != nil {
+			return err
+		}
+		for _, mig := range done {
+			if err := db.Create(&schemaMigration{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// apply 在事务中执行脚本并更新记录表
+func (m *Migrator) apply(db *gorm.DB, mig Migration, up bool) error {
+	script, fn := mig.Up, mig.UpFunc
+	if !up {
+		script, fn = mig.Down, mig.DownFunc
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range splitStatements(script) {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("执行迁移 %s 失败: %w", mig, err)
+			}
+		}
+		if fn != nil {
+			if err := fn(tx); err != nil {
+				return fmt.Errorf("执行迁移 %s 失败: %w", mig, err)
+			}
+		}
+		if up {
+			return tx.Create(&schemaMigration{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()}).Error
+		}
+		return tx.Delete(&schemaMigration{}, mig.Version).Error
+	})
+}
+
+// lockName 迁移锁的名称，MySQL 使用命名锁，PostgreSQL 使用由名称得到的 advisory lock key
+const lockName = "gin-crud:schema_migrations"
+
+// withLock 在同一个连接上持有迁移锁执行 fn，防止多个实例同时迁移。
+// SQLite 没有会话级的锁，依靠每个迁移的事务和记录表主键避免重复执行
+func (m *Migrator) withLock(fn func(db *gorm.DB) error) error {
+	switch m.db.Dialector.Name() {
+	case "mysql", "postgres":
+	default:
+		return fn(m.db)
+	}
+	return m.db.Connection(func(conn *gorm.DB) error {
+		unlock, err := m.lock(conn)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		return fn(conn)
+	})
+}
+
+// lock 获取会话级的锁，锁随连接关闭自动释放，进程异常退出不会留下死锁
+func (m *Migrator) lock(conn *gorm.DB) (func(), error) {
+	if conn.Dialector.Name() == "mysql" {
+		var ok *int
+		timeout := int(m.LockTimeout / time.Second)
+		if err := conn.Raw("SELECT GET_LOCK(?, ?)", lockName, timeout).Scan(&ok).Error; err != nil {
+			return nil, err
+		}
+		if ok == nil || *ok != 1 {
+			return nil, ErrLocked
+		}
+		return func() { conn.Exec("SELECT RELEASE_LOCK(?)", lockName) }, nil
+	}
+
+	deadline := time.Now().Add(m.LockTimeout)
+	for {
+		var ok bool
+		if err := conn.Raw("SELECT pg_try_advisory_lock(hashtext(?))", lockName).Scan(&ok).Error; err != nil {
+			return nil, err
+		}
+		if ok {
+			return func() { conn.Exec("SELECT pg_advisory_unlock(hashtext(?))", lockName) }, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrLocked
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
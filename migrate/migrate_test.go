@@ -0,0 +1,196 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openSQLite(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	return db
+}
+
+// 各数据库的迁移必须一一对应，否则切换数据库后表结构不一致
+func TestEmbedded(t *testing.T) {
+	var versions []string
+	for _, dialect := range []string{"mysql", "postgres", "sqlite"} {
+		migrations, err := Embedded(dialect)
+		if !assert.NoError(t, err, dialect) {
+			continue
+		}
+		names := []string{}
+		for _, m := range migrations {
+			if m.DownFunc == nil {
+				assert.NotEmpty(t, splitStatements(m.Down), "%s %s 缺少 down 脚本", dialect, m)
+			}
+			names = append(names, m.String())
+		}
+		if versions == nil {
+			versions = names
+		}
+		assert.Equal(t, versions, names, dialect)
+	}
+
+	_, err := Embedded("oracle")
+	assert.Error(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	_, err := Load(fstest.MapFS{"m/0001_init.down.sql": {Data: []byte("DROP TABLE a;")}}, "m")
+	assert.ErrorContains(t, err, "缺少 up 脚本")
+
+	_, err = Load(fstest.MapFS{"m/init.sql": {}}, "m")
+	assert.ErrorContains(t, err, "无法识别")
+
+	_, err = Load(fstest.MapFS{
+		"m/0001_a.up.sql": {Data: []byte("SELECT 1;")},
+		"m/0001_b.up.sql": {Data: []byte("SELECT 1;")},
+	}, "m")
+	assert.ErrorContains(t, err, "版本号重复")
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := "-- 注释\nCREATE TABLE a (\n  id integer\n);\n\nCREATE INDEX i ON a (id);\nSELECT 1"
+	assert.Equal(t, []string{"CREATE TABLE a (\n  id integer\n)", "CREATE INDEX i ON a (id)", "SELECT 1"}, splitStatements(script))
+}
+
+func TestMigrator(t *testing.T) {
+	db := openSQLite(t)
+	fsys := fstest.MapFS{
+		"m/0001_init.up.sql":     {Data: []byte("CREATE TABLE users (id integer PRIMARY KEY);")},
+		"m/0001_init.down.sql":   {Data: []byte("DROP TABLE users;")},
+		"m/0002_phone.up.sql":    {Data: []byte("ALTER TABLE users ADD COLUMN phone text;")},
+		"m/0002_phone.down.sql":  {Data: []byte("ALTER TABLE users DROP COLUMN phone;")},
+		"m/0003_backfill.up.sql": {Data: []byte("UPDATE users SET phone = '' WHERE phone IS NULL;")},
+		"m/0004_broken.up.sql":   {Data: []byte("ALTER TABLE users ADD COLUMN level integer;\nALTER TABLE missing ADD COLUMN x text;")},
+		"m/0004_broken.down.sql": {Data: []byte("ALTER TABLE users DROP COLUMN level;")},
+	}
+	migrations, err := Load(fsys, "m")
+	if !assert.NoError(t, err) {
+		return
+	}
+	m := NewWithMigrations(db, migrations)
+
+	t.Run("UpToTarget", func(t *testing.T) {
+		done, err := m.Up(2)
+		assert.NoError(t, err)
+		assert.Len(t, done, 2)
+		assert.True(t, db.Migrator().HasColumn("users", "phone"))
+
+		pending, err := m.Pending()
+		assert.NoError(t, err)
+		assert.Len(t, pending, 2)
+	})
+
+	t.Run("FailedMigrationRollsBack", func(t *testing.T) {
+		done, err := m.Up(0)
+		assert.ErrorContains(t, err, "0004_broken")
+		assert.Len(t, done, 1)
+		// SQLite 的 DDL 可以回滚，失败的迁移不留下部分修改
+		assert.False(t, db.Migrator().HasColumn("users", "level"))
+
+		statuses, err := m.Status()
+		assert.NoError(t, err)
+		assert.NotNil(t, statuses[2].AppliedAt)
+		assert.Nil(t, statuses[3].AppliedAt)
+	})
+
+	t.Run("Down", func(t *testing.T) {
+		_, err := m.Down(1)
+		assert.ErrorIs(t, err, ErrIrreversible)
+
+		m := NewWithMigrations(db, migrations[:2])
+		done, err := m.Down(2)
+		assert.NoError(t, err)
+		assert.Len(t, done, 2)
+		assert.False(t, db.Migrator().HasTable("users"))
+	})
+}
+
+func TestSchemaObjects(t *testing.T) {
+	migrations, err := Embedded("mysql")
+	if !assert.NoError(t, err) {
+		return
+	}
+	objects := schemaObjects(migrations[0].Up)
+	assert.Contains(t, objects, schemaObject{Table: "users"})
+	assert.Contains(t, objects, schemaObject{Table: "users", Column: "unique_email"})
+	assert.Contains(t, objects, schemaObject{Table: "users", Index: "uk_users_public_id"})
+	assert.Contains(t, objects, schemaObject{Table: "invitations", Column: "token_hash"})
+	assert.NotContains(t, objects, schemaObject{Table: "users", Column: "PRIMARY"})
+
+	assert.Equal(t, []schemaObject{{Table: "users", Index: "ft_users_search"}}, schemaObjects(migrations[1].Up))
+	assert.Equal(t, []schemaObject{{Table: "users", Column: "phone"}}, schemaObjects("ALTER TABLE users ADD COLUMN phone text;"))
+	assert.Empty(t, schemaObjects("UPDATE users SET phone = '';"))
+}
+
+// 已有业务表但没有迁移记录的数据库不自动设置基线，由 Baseline 核对表结构后记录
+func TestMigrator_Baseline(t *testing.T) {
+	migrations, err := Embedded("sqlite")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t.Run("SchemaMismatch", func(t *testing.T) {
+		db := openSQLite(t)
+		assert.NoError(t, db.Exec("CREATE TABLE users (id integer PRIMARY KEY)").Error)
+		m := NewWithMigrations(db, migrations)
+
+		_, err := m.Up(0)
+		assert.ErrorIs(t, err, ErrNoBaseline)
+		_, err = m.Baseline(0)
+		assert.ErrorContains(t, err, "列 users.public_id")
+		assert.ErrorContains(t, err, "表 audit_logs")
+		assert.False(t, db.Migrator().HasTable(&schemaMigration{}))
+	})
+
+	t.Run("Matching", func(t *testing.T) {
+		// 按第一个迁移建表，模拟此前由 AutoMigrate 创建的数据库，其中有未回填的存量用户
+		db := openSQLite(t)
+		for _, stmt := range splitStatements(migrations[0].Up) {
+			assert.NoError(t, db.Exec(stmt).Error)
+		}
+		assert.NoError(t, db.Exec("INSERT INTO users (username, email, created_at) VALUES (' Alice ', 'Alice@Example.com', CURRENT_TIMESTAMP)").Error)
+		m := NewWithMigrations(db, migrations)
+
+		_, err := m.Baseline(3)
+		assert.ErrorContains(t, err, "数据迁移")
+		done, err := m.Baseline(0)
+		assert.NoError(t, err)
+		assert.Len(t, done, 1)
+		_, err = m.Baseline(0)
+		assert.Error(t, err)
+
+		done, err = m.Up(0)
+		assert.NoError(t, err)
+		assert.Len(t, done, len(migrations)-1)
+
+		var user struct {
+			Username       string
+			UniqueUsername string
+			UniqueEmail    string
+			PublicID       string
+		}
+		assert.NoError(t, db.Table("users").Take(&user).Error)
+		assert.Equal(t, "alice", user.Username)
+		assert.Equal(t, "alice", user.UniqueUsername)
+		assert.Equal(t, "alice@example.com", user.UniqueEmail)
+		assert.Len(t, user.PublicID, 36)
+
+		// 数据迁移回滚时只删除执行记录
+		done, err = m.Down(len(migrations))
+		assert.NoError(t, err)
+		assert.Len(t, done, len(migrations))
+		assert.False(t, db.Migrator().HasTable("users"))
+	})
+}
@@ -0,0 +1,86 @@
+-- 初始表结构，与此前 AutoMigrate 创建的结构一致
+CREATE TABLE `users` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `public_id` varchar(36),
+  `username` longtext,
+  `email` longtext,
+  `password` longtext,
+  `role` varchar(20) DEFAULT 'user',
+  `version` bigint unsigned NOT NULL DEFAULT 1,
+  `status` varchar(20) DEFAULT 'active',
+  `status_reason` varchar(255),
+  `status_expires_at` datetime(3) NULL,
+  `deletion_scheduled_at` datetime(3) NULL,
+  `attributes` json,
+  `avatar` varchar(255),
+  `erased_at` datetime(3) NULL,
+  `unique_username` varchar(191),
+  `unique_email` varchar(191),
+  PRIMARY KEY (`id`),
+  INDEX `idx_users_deleted_at` (`deleted_at`),
+  UNIQUE INDEX `uk_users_public_id` (`public_id`),
+  INDEX `idx_users_status` (`status`),
+  UNIQUE INDEX `uk_users_username` (`unique_username`),
+  UNIQUE INDEX `uk_users_email` (`unique_email`)
+);
+
+CREATE TABLE `audit_logs` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `user_id` bigint unsigned,
+  `actor_id` bigint unsigned,
+  `action` varchar(50),
+  `detail` text,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_audit_logs_user_id` (`user_id`)
+);
+
+CREATE TABLE `groups` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `name` varchar(100),
+  `description` varchar(255),
+  `parent_id` bigint unsigned,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uk_groups_name` (`name`),
+  INDEX `idx_groups_parent_id` (`parent_id`)
+);
+
+CREATE TABLE `group_members` (
+  `group_id` bigint unsigned,
+  `user_id` bigint unsigned,
+  `role` varchar(20) DEFAULT 'member',
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`group_id`, `user_id`),
+  INDEX `idx_group_members_user_id` (`user_id`),
+  CONSTRAINT `fk_group_members_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+);
+
+CREATE TABLE `group_permissions` (
+  `group_id` bigint unsigned,
+  `permission` varchar(100),
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`group_id`, `permission`)
+);
+
+CREATE TABLE `invitations` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `token_hash` varchar(64),
+  `email` varchar(191),
+  `role` varchar(20),
+  `group_id` bigint unsigned,
+  `inviter_id` bigint unsigned,
+  `expires_at` datetime(3) NULL,
+  `accepted_at` datetime(3) NULL,
+  `revoked_at` datetime(3) NULL,
+  `user_id` bigint unsigned,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_invitations_token_hash` (`token_hash`),
+  INDEX `idx_invitations_email` (`email`),
+  INDEX `idx_invitations_inviter_id` (`inviter_id`)
+);
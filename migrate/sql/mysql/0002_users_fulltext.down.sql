@@ -0,0 +1 @@
+DROP INDEX `ft_users_search` ON `users`;
@@ -0,0 +1,2 @@
+-- 用户检索使用的 FULLTEXT 索引，ngram 分词支持中文
+CREATE FULLTEXT INDEX `ft_users_search` ON `users` (`username`, `email`) WITH PARSER ngram;
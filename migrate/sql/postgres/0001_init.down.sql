@@ -0,0 +1,6 @@
+DROP TABLE "invitations";
+DROP TABLE "group_permissions";
+DROP TABLE "group_members";
+DROP TABLE "groups";
+DROP TABLE "audit_logs";
+DROP TABLE "users";
@@ -0,0 +1,86 @@
+-- 初始表结构，与此前 AutoMigrate 创建的结构一致
+CREATE TABLE "users" (
+  "id" bigserial,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  "deleted_at" timestamptz,
+  "public_id" varchar(36),
+  "username" text,
+  "email" text,
+  "password" text,
+  "role" varchar(20) DEFAULT 'user',
+  "version" bigint NOT NULL DEFAULT 1,
+  "status" varchar(20) DEFAULT 'active',
+  "status_reason" varchar(255),
+  "status_expires_at" timestamptz,
+  "deletion_scheduled_at" timestamptz,
+  "attributes" json,
+  "avatar" varchar(255),
+  "erased_at" timestamptz,
+  "unique_username" varchar(191),
+  "unique_email" varchar(191),
+  PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_users_deleted_at" ON "users" ("deleted_at");
+CREATE UNIQUE INDEX "uk_users_public_id" ON "users" ("public_id");
+CREATE INDEX "idx_users_status" ON "users" ("status");
+CREATE UNIQUE INDEX "uk_users_username" ON "users" ("unique_username");
+CREATE UNIQUE INDEX "uk_users_email" ON "users" ("unique_email");
+
+CREATE TABLE "audit_logs" (
+  "id" bigserial,
+  "user_id" bigint,
+  "actor_id" bigint,
+  "action" varchar(50),
+  "detail" text,
+  "created_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_audit_logs_user_id" ON "audit_logs" ("user_id");
+
+CREATE TABLE "groups" (
+  "id" bigserial,
+  "name" varchar(100),
+  "description" varchar(255),
+  "parent_id" bigint,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX "uk_groups_name" ON "groups" ("name");
+CREATE INDEX "idx_groups_parent_id" ON "groups" ("parent_id");
+
+CREATE TABLE "group_members" (
+  "group_id" bigint,
+  "user_id" bigint,
+  "role" varchar(20) DEFAULT 'member',
+  "created_at" timestamptz,
+  PRIMARY KEY ("group_id", "user_id"),
+  CONSTRAINT "fk_group_members_user" FOREIGN KEY ("user_id") REFERENCES "users" ("id")
+);
+CREATE INDEX "idx_group_members_user_id" ON "group_members" ("user_id");
+
+CREATE TABLE "group_permissions" (
+  "group_id" bigint,
+  "permission" varchar(100),
+  "created_at" timestamptz,
+  PRIMARY KEY ("group_id", "permission")
+);
+
+CREATE TABLE "invitations" (
+  "id" bigserial,
+  "token_hash" varchar(64),
+  "email" varchar(191),
+  "role" varchar(20),
+  "group_id" bigint,
+  "inviter_id" bigint,
+  "expires_at" timestamptz,
+  "accepted_at" timestamptz,
+  "revoked_at" timestamptz,
+  "user_id" bigint,
+  "created_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX "idx_invitations_token_hash" ON "invitations" ("token_hash");
+CREATE INDEX "idx_invitations_email" ON "invitations" ("email");
+CREATE INDEX "idx_invitations_inviter_id" ON "invitations" ("inviter_id");
@@ -0,0 +1,82 @@
+-- 初始表结构，与此前 AutoMigrate 创建的结构一致
+CREATE TABLE `users` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `public_id` text,
+  `username` text,
+  `email` text,
+  `password` text,
+  `role` text DEFAULT 'user',
+  `version` integer NOT NULL DEFAULT 1,
+  `status` text DEFAULT 'active',
+  `status_reason` text,
+  `status_expires_at` datetime,
+  `deletion_scheduled_at` datetime,
+  `attributes` json,
+  `avatar` text,
+  `erased_at` datetime,
+  `unique_username` text,
+  `unique_email` text
+);
+CREATE INDEX `idx_users_deleted_at` ON `users` (`deleted_at`);
+CREATE UNIQUE INDEX `uk_users_public_id` ON `users` (`public_id`);
+CREATE INDEX `idx_users_status` ON `users` (`status`);
+CREATE UNIQUE INDEX `uk_users_username` ON `users` (`unique_username`);
+CREATE UNIQUE INDEX `uk_users_email` ON `users` (`unique_email`);
+
+CREATE TABLE `audit_logs` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `user_id` integer,
+  `actor_id` integer,
+  `action` text,
+  `detail` text,
+  `created_at` datetime
+);
+CREATE INDEX `idx_audit_logs_user_id` ON `audit_logs` (`user_id`);
+
+CREATE TABLE `groups` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `name` text,
+  `description` text,
+  `parent_id` integer,
+  `created_at` datetime,
+  `updated_at` datetime
+);
+CREATE UNIQUE INDEX `uk_groups_name` ON `groups` (`name`);
+CREATE INDEX `idx_groups_parent_id` ON `groups` (`parent_id`);
+
+CREATE TABLE `group_members` (
+  `group_id` integer,
+  `user_id` integer,
+  `role` text DEFAULT 'member',
+  `created_at` datetime,
+  PRIMARY KEY (`group_id`, `user_id`),
+  CONSTRAINT `fk_group_members_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+);
+CREATE INDEX `idx_group_members_user_id` ON `group_members` (`user_id`);
+
+CREATE TABLE `group_permissions` (
+  `group_id` integer,
+  `permission` text,
+  `created_at` datetime,
+  PRIMARY KEY (`group_id`, `permission`)
+);
+
+CREATE TABLE `invitations` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `token_hash` text,
+  `email` text,
+  `role` text,
+  `group_id` integer,
+  `inviter_id` integer,
+  `expires_at` datetime,
+  `accepted_at` datetime,
+  `revoked_at` datetime,
+  `user_id` integer,
+  `created_at` datetime
+);
+CREATE UNIQUE INDEX `idx_invitations_token_hash` ON `invitations` (`token_hash`);
+CREATE INDEX `idx_invitations_email` ON `invitations` (`email`);
+CREATE INDEX `idx_invitations_inviter_id` ON `invitations` (`inviter_id`);
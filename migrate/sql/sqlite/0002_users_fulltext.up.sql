@@ -0,0 +1,2 @@
+-- 只有 MySQL 使用 FULLTEXT 索引检索用户，其它数据库保留版本号以与 MySQL 的迁移一一对应
+SELECT 1;
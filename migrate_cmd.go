@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"gin-crud/common"
+	"gin-crud/migrate"
+	"os"
+	"strconv"
+)
+
+const migrateUsage = `用法:
+  migrate up [版本号]    执行未执行的迁移，指定版本号时只执行到该版本
+  migrate down [步数]    回滚最近执行的迁移，默认 1 步
+  migrate status         查看迁移执行情况
+  migrate baseline [版本号]
+                         已由 AutoMigrate 建表的数据库核对表结构后，将迁移记为已执行，默认只包括第一个迁移`
+
+// runMigrate 执行 migrate 子命令，出错时以非零状态退出
+func runMigrate(args []string) {
+	if err := migrateCommand(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func migrateCommand(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("%s", migrateUsage)
+	}
+	n := 0
+	if len(args) == 2 {
+		v, err := strconv.Atoi(args[1])
+		if err != nil || v <= 0 {
+			return fmt.Errorf("无效的参数: %s\n%s", args[1], migrateUsage)
+		}
+		n = v
+	}
+
+	db, err := common.OpenDB(common.Conf.Datasource)
+	if err != nil {
+		return fmt.Errorf("数据库连接失败: %w", err)
+	}
+	m, err := migrate.New(db)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		done, err := m.Up(uint(n))
+		for _, mig := range done {
+			fmt.Println("已执行", mig)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("没有需要执行的迁移")
+		}
+		return err
+	case "down":
+		if n == 0 {
+			n = 1
+		}
+		done, err := m.Down(n)
+		for _, mig := range done {
+			fmt.Println("已回滚", mig)
+		}
+		return err
+	case "baseline":
+		done, err := m.Baseline(uint(n))
+		for _, mig := range done {
+			fmt.Println("已记为执行", mig)
+		}
+		return err
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "未执行"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-40s %s\n", s.Migration, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("未知的子命令: %s\n%s", args[0], migrateUsage)
+	}
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Attributes 用户自定义属性，属性定义见配置文件 attributes 部分，以 JSON 形式存储
+type Attributes map[string]interface{}
+
+// Value 实现 driver.Valuer，空属性存为 NULL
+func (a Attributes) Value() (driver.Value, error) {
+	if len(a) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(a)
+	return string(b), err
+}
+
+// Scan 实现 sql.Scanner
+func (a *Attributes) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("无法解析 attributes 列")
+	}
+	if len(data) == 0 {
+		*a = nil
+		return nil
+	}
+	return json.Unmarshal(data, a)
+}
+
+// EncodeMsgpack 缓存使用 MessagePack 时仍以 JSON 保存属性，
+// 使读回的数字与从数据库读取时一样是 float64，属性校验不受缓存格式影响
+func (a Attributes) EncodeMsgpack(enc *msgpack.Encoder) error {
+	if a == nil {
+		return enc.EncodeNil()
+	}
+	b, err := json.Marshal(map[string]interface{}(a))
+	if err != nil {
+		return err
+	}
+	return enc.EncodeBytes(b)
+}
+
+// DecodeMsgpack 见 EncodeMsgpack
+func (a *Attributes) DecodeMsgpack(dec *msgpack.Decoder) error {
+	b, err := dec.DecodeBytes()
+	if err != nil {
+		return err
+	}
+	if b == nil {
+		*a = nil
+		return nil
+	}
+	return json.Unmarshal(b, (*map[string]interface{})(a))
+}
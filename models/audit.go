@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// 审计动作
+const (
+	AuditStatusChange = "status_change"
+	AuditDataExport   = "data_export"
+	AuditErase        = "erase"
+	AuditEmailChange  = "email_change"
+	AuditInvite       = "invite" // 通过邀请注册，操作人为邀请人
+)
+
+// AuditLog 用户相关操作的审计记录
+type AuditLog struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	UserID    uint      `json:"user_id" gorm:"index"` // 被操作的用户
+	ActorID   uint      `json:"actor_id"`             // 操作人，0 表示系统自动执行
+	Action    string    `json:"action" gorm:"size:50"`
+	Detail    string    `json:"detail" gorm:"type:text"` // JSON 格式的操作详情
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// 组内角色
+const (
+	GroupRoleMember = "member"
+	GroupRoleOwner  = "owner" // 可管理本组及子组成员
+)
+
+// 内置权限，授予组后组成员（含子组成员）可访问对应接口，管理员始终拥有
+const (
+	PermissionUserList = "user:list" // 用户列表和批量查询
+)
+
+// Group 用户组，通过 ParentID 组成树形结构。
+// 子组成员同时视为所有上级组的成员，授予上级组的权限对子组成员同样生效
+type Group struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	Name        string    `json:"name" gorm:"size:100;uniqueIndex:uk_groups_name"`
+	Description string    `json:"description" gorm:"size:255"`
+	ParentID    *uint     `json:"parent_id,omitempty" gorm:"index"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// GroupMember 组成员关系（用户与组多对多）
+type GroupMember struct {
+	GroupID   uint      `json:"group_id" gorm:"primaryKey"`
+	UserID    uint      `json:"-" gorm:"primaryKey;index"` // 内部 ID，成员的公开 ID 见 User
+	Role      string    `json:"role" gorm:"size:20;default:member"`
+	CreatedAt time.Time `json:"created_at"`
+	User      *User     `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// GroupPermission 授予组的权限，权限名为任意字符串，如 report:read
+type GroupPermission struct {
+	GroupID    uint      `json:"group_id" gorm:"primaryKey"`
+	Permission string    `json:"permission" gorm:"primaryKey;size:100"`
+	CreatedAt  time.Time `json:"created_at"`
+}
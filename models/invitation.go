@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// 注册方式
+const (
+	RegistrationOpen   = "open"   // 开放注册
+	RegistrationInvite = "invite" // 仅限受邀注册
+	RegistrationClosed = "closed" // 关闭注册
+)
+
+// Invitation 注册邀请。受邀人使用一次性 token 设置用户名和密码，邮箱和角色由邀请预先指定
+type Invitation struct {
+	ID        uint   `json:"id" gorm:"primarykey"`
+	TokenHash string `json:"-" gorm:"size:64;uniqueIndex"` // token 的 SHA-256，token 本身只在邮件中出现
+	Email     string `json:"email" gorm:"size:191;index"`
+	Role      string `json:"role" gorm:"size:20"`
+	GroupID   *uint  `json:"group_id,omitempty"` // 接受邀请后自动加入的组
+	InviterID uint   `json:"-" gorm:"index"`
+
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	UserID     *uint      `json:"-"` // 接受邀请后创建的用户
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Pending 邀请是否仍可使用
+func (i *Invitation) Pending(now time.Time) bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && now.Before(i.ExpiresAt)
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalize 去除首尾空白后按 NFKC_Casefold 规范化：NFKC -> 大小写折叠 -> NFKC
+func normalize(s string) string {
+	s = norm.NFKC.String(strings.TrimSpace(s))
+	// Caser 有内部状态，不能在 goroutine 间共享，每次新建
+	return norm.NFKC.String(cases.Fold().String(s))
+}
+
+// NormalizeUsername 规范化用户名，存储和查询前都必须调用，保证唯一性判断不受大小写、全半角影响
+func NormalizeUsername(username string) string {
+	return normalize(username)
+}
+
+// NormalizeEmail 规范化邮箱地址
+func NormalizeEmail(email string) string {
+	return normalize(email)
+}
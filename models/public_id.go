@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NewPublicID 生成 UUIDv7 作为用户的公开 ID。前 48 位为毫秒时间戳，
+// 回填存量用户时传入注册时间，使公开 ID 的顺序与注册顺序一致
+func NewPublicID(t time.Time) (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+	ms := uint64(t.UnixMilli())
+	for i := 0; i < 6; i++ {
+		id[i] = byte(ms >> (40 - 8*i))
+	}
+	return id.String(), nil
+}
+
+// IsPublicID 判断字符串是否为公开 ID 格式（标准 36 位 UUID）
+func IsPublicID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	_, err := uuid.Parse(s)
+	return err == nil
+}
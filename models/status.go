@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// 账号状态
+const (
+	StatusActive    = "active"    // 正常
+	StatusPending   = "pending"   // 待激活
+	StatusSuspended = "suspended" // 暂停使用，可设置到期时间
+	StatusBanned    = "banned"    // 封禁，可设置到期时间
+)
+
+// statusTransitions 允许的状态流转
+var statusTransitions = map[string][]string{
+	StatusPending:   {StatusActive, StatusBanned},
+	StatusActive:    {StatusSuspended, StatusBanned},
+	StatusSuspended: {StatusActive, StatusBanned},
+	StatusBanned:    {StatusActive},
+}
+
+// CanTransition 判断账号状态能否从 from 变更为 to
+func CanTransition(from, to string) bool {
+	for _, s := range statusTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveStatus 返回当前实际生效的状态：暂停或封禁到期后视为正常；
+// 旧缓存中没有状态字段时也视为正常
+func (u *User) EffectiveStatus(now time.Time) string {
+	if u.Status == "" {
+		return StatusActive
+	}
+	if (u.Status == StatusSuspended || u.Status == StatusBanned) &&
+		u.StatusExpiresAt != nil && !now.Before(*u.StatusExpiresAt) {
+		return StatusActive
+	}
+	return u.Status
+}
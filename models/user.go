@@ -1,21 +1,78 @@
 package models
 
 import (
+	"time"
+
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+// 用户角色
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
-	gorm.Model
-	Username string `json:"username" binding:"required"` // Gin 参数校验
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	// ID 内部自增主键，不对外暴露；对外统一使用 PublicID
+	ID        uint `json:"-" gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	// PublicID 对外的用户标识（UUIDv7），用于路由、Token 和响应
+	PublicID string `json:"id" gorm:"size:36;uniqueIndex:uk_users_public_id"`
+
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"-"`                                 // bcrypt 哈希，不出现在任何响应中；请求参数使用各接口自己的结构
+	Role     string `json:"role" gorm:"size:20;default:user"`  // 角色：user / admin
+	Version  uint   `json:"version" gorm:"not null;default:1"` // 乐观锁版本号，每次更新加 1，用作 ETag
+
+	// 账号状态，见 status.go
+	Status          string     `json:"status" gorm:"size:20;default:active;index"`
+	StatusReason    string     `json:"status_reason,omitempty" gorm:"size:255"`
+	StatusExpiresAt *time.Time `json:"status_expires_at,omitempty"` // 暂停/封禁到期时间，为空表示永久
+
+	// DeletionScheduledAt 用户申请注销后的计划删除时间，冷静期内可撤销
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+
+	// Attributes 配置中声明的自定义属性
+	Attributes Attributes `json:"attributes,omitempty" gorm:"type:json"`
+
+	// Avatar 头像在对象存储中的 key 前缀，原图和缩略图都在该前缀下，为空表示未设置头像
+	Avatar string `json:"-" gorm:"size:255"`
+
+	// ErasedAt 按数据主体请求匿名化的时间，匿名化后行保留以维持引用完整性
+	ErasedAt *time.Time `json:"erased_at,omitempty"`
+
+	// UniqueUsername / UniqueEmail 仅在用户未删除时等于 Username / Email，软删除后置为 NULL，
+	// 由于唯一索引不约束 NULL，已删除用户不会占用用户名和邮箱
+	UniqueUsername *string `json:"-" gorm:"size:191;uniqueIndex:uk_users_username"`
+	UniqueEmail    *string `json:"-" gorm:"size:191;uniqueIndex:uk_users_email"`
+
+	// PasswordHashed 为 true 时表示 Password 已是 bcrypt 哈希（如批量导入），保存时不再加密
+	PasswordHashed bool `json:"-" gorm:"-"`
+}
+
+// BeforeCreate 创建前生成公开 ID，规范化用户名和邮箱，并写入唯一键
+func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
+	if u.PublicID == "" {
+		if u.PublicID, err = NewPublicID(time.Now()); err != nil {
+			return err
+		}
+	}
+	u.Username = NormalizeUsername(u.Username)
+	u.Email = NormalizeEmail(u.Email)
+	u.UniqueUsername = &u.Username
+	u.UniqueEmail = &u.Email
+	return nil
 }
 
 // BeforeSave 加密逻辑：在创建或更新数据前自动执行
 func (u *User) BeforeSave(tx *gorm.DB) (err error) {
 	// 只有当密码字段不为空时才加密（防止更新其他字段时把已加密的密码再次加密）
-	if u.Password != "" {
+	if u.Password != "" && !u.PasswordHashed {
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
 		if err != nil {
 			return err
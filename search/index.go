@@ -0,0 +1,102 @@
+package search
+
+import (
+	"context"
+	"html"
+	"sort"
+	"strings"
+)
+
+// Document 参与检索的用户字段，ID 为内部 ID
+type Document struct {
+	ID       uint
+	Username string
+	Email    string
+}
+
+// Hit 一条检索结果
+type Hit struct {
+	ID         uint
+	Score      float64
+	Highlights map[string]string // 字段名到高亮文本，命中部分用 <em></em> 包裹，其余部分已做 HTML 转义
+}
+
+// Result 一页检索结果，Total 为匹配的总数
+type Result struct {
+	Hits  []Hit
+	Total int64
+}
+
+// Index 用户全文检索。查询按空白拆分为多个检索词，每个词都需命中用户名或邮箱的一部分
+type Index interface {
+	// Index 新增或覆盖文档
+	Index(ctx context.Context, doc Document) error
+	// Delete 删除文档，文档不存在时不报错
+	Delete(ctx context.Context, id uint) error
+	// Search 按相关度从高到低分页返回结果，page 从 1 开始
+	Search(ctx context.Context, query string, page, size int) (*Result, error)
+}
+
+// Terms 将查询拆分为小写、去重的检索词
+func Terms(query string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, t := range strings.Fields(strings.ToLower(query)) {
+		if !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// Highlight 用 <em></em> 标出 text 中命中检索词的部分，忽略大小写，重叠的命中合并为一段
+func Highlight(text string, terms []string) string {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		// 大小写转换改变了字节长度时无法对应位置，退回区分大小写匹配
+		lower = text
+	}
+
+	type span struct{ start, end int }
+	var spans []span
+	for _, term := range terms {
+		for from := 0; from < len(lower); {
+			i := strings.Index(lower[from:], term)
+			if i < 0 {
+				break
+			}
+			start := from + i
+			spans = append(spans, span{start, start + len(term)})
+			from = start + 1
+		}
+	}
+	if len(spans) == 0 {
+		return html.EscapeString(text)
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	var b strings.Builder
+	pos := 0
+	for i := 0; i < len(spans); {
+		start, end := spans[i].start, spans[i].end
+		for i++; i < len(spans) && spans[i].start <= end; i++ {
+			end = max(end, spans[i].end)
+		}
+		b.WriteString(html.EscapeString(text[pos:start]))
+		b.WriteString("<em>")
+		b.WriteString(html.EscapeString(text[start:end]))
+		b.WriteString("</em>")
+		pos = end
+	}
+	b.WriteString(html.EscapeString(text[pos:]))
+	return b.String()
+}
+
+// highlights 生成文档各字段的高亮文本
+func highlights(doc Document, terms []string) map[string]string {
+	return map[string]string{
+		"username": Highlight(doc.Username, terms),
+		"email":    Highlight(doc.Email, terms),
+	}
+}
@@ -0,0 +1,176 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryIndex 进程内的倒排索引，以单字和相邻两字为词项，支持任意位置的部分匹配。
+// 数据不持久化，适合测试和单实例部署，启动时需要全量重建
+type MemoryIndex struct {
+	mu       sync.RWMutex
+	docs     map[uint]Document
+	postings map[string]map[uint]struct{}
+}
+
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{
+		docs:     make(map[uint]Document),
+		postings: make(map[string]map[uint]struct{}),
+	}
+}
+
+// grams 返回文本的全部单字和相邻两字
+func grams(text string) []string {
+	runes := []rune(strings.ToLower(text))
+	out := make([]string, 0, 2*len(runes))
+	for i := range runes {
+		out = append(out, string(runes[i]))
+		if i+1 < len(runes) {
+			out = append(out, string(runes[i:i+2]))
+		}
+	}
+	return out
+}
+
+// termGrams 检索词对应的词项：单字词直接使用，多字词取全部相邻两字
+func termGrams(term string) []string {
+	runes := []rune(term)
+	if len(runes) == 1 {
+		return []string{term}
+	}
+	out := make([]string, 0, len(runes)-1)
+	for i := 0; i+1 < len(runes); i++ {
+		out = append(out, string(runes[i:i+2]))
+	}
+	return out
+}
+
+func (m *MemoryIndex) Index(ctx context.Context, doc Document) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(doc.ID)
+	m.docs[doc.ID] = doc
+	for _, g := range append(grams(doc.Username), grams(doc.Email)...) {
+		ids := m.postings[g]
+		if ids == nil {
+			ids = make(map[uint]struct{})
+			m.postings[g] = ids
+		}
+		ids[doc.ID] = struct{}{}
+	}
+	return nil
+}
+
+func (m *MemoryIndex) Delete(ctx context.Context, id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(id)
+	return nil
+}
+
+// remove 删除文档及其词项，调用方持有写锁
+func (m *MemoryIndex) remove(id uint) {
+	doc, ok := m.docs[id]
+	if !ok {
+		return
+	}
+	delete(m.docs, id)
+	for _, g := range append(grams(doc.Username), grams(doc.Email)...) {
+		if ids := m.postings[g]; ids != nil {
+			delete(ids, id)
+			if len(ids) == 0 {
+				delete(m.postings, g)
+			}
+		}
+	}
+}
+
+// candidates 返回同时包含检索词全部词项的文档，词项只能缩小范围，是否真正命中由调用方确认
+func (m *MemoryIndex) candidates(term string) map[uint]struct{} {
+	var result map[uint]struct{}
+	for _, g := range termGrams(term) {
+		ids := m.postings[g]
+		if len(ids) == 0 {
+			return nil
+		}
+		if result == nil {
+			result = make(map[uint]struct{}, len(ids))
+			for id := range ids {
+				result[id] = struct{}{}
+			}
+			continue
+		}
+		for id := range result {
+			if _, ok := ids[id]; !ok {
+				delete(result, id)
+			}
+		}
+	}
+	return result
+}
+
+// fieldScore 检索词在字段中的得分：完全相同 > 前缀 > 包含，未命中为 0
+func fieldScore(field, term string, weight float64) float64 {
+	switch {
+	case field == term:
+		return 3 * weight
+	case strings.HasPrefix(field, term):
+		return 2 * weight
+	case strings.Contains(field, term):
+		return weight
+	}
+	return 0
+}
+
+func (m *MemoryIndex) Search(ctx context.Context, query string, page, size int) (*Result, error) {
+	terms := Terms(query)
+	if len(terms) == 0 {
+		return &Result{}, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	scores := make(map[uint]float64)
+	for i, term := range terms {
+		next := make(map[uint]float64)
+		for id := range m.candidates(term) {
+			if _, ok := scores[id]; i > 0 && !ok {
+				continue
+			}
+			doc := m.docs[id]
+			// 用户名命中比邮箱命中更相关
+			score := fieldScore(strings.ToLower(doc.Username), term, 2) + fieldScore(strings.ToLower(doc.Email), term, 1)
+			if score > 0 {
+				next[id] = scores[id] + score
+			}
+		}
+		scores = next
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+
+	result := &Result{Total: int64(len(hits))}
+	start := (page - 1) * size
+	if start >= len(hits) {
+		return result, nil
+	}
+	hits = hits[start:min(start+size, len(hits))]
+	for i := range hits {
+		hits[i].Highlights = highlights(m.docs[hits[i].ID], terms)
+	}
+	result.Hits = hits
+	return result, nil
+}
@@ -0,0 +1,55 @@
+package search
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryIndex(t *testing.T) {
+	ctx := context.Background()
+	idx := NewMemoryIndex()
+	idx.Index(ctx, Document{ID: 1, Username: "alice", Email: "alice@example.com"})
+	idx.Index(ctx, Document{ID: 2, Username: "malice", Email: "m@corp.com"})
+	idx.Index(ctx, Document{ID: 3, Username: "bob", Email: "bob.alison@example.com"})
+
+	t.Run("RankedPartialMatch", func(t *testing.T) {
+		res, err := idx.Search(ctx, "ali", 1, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), res.Total)
+		// 用户名前缀 > 用户名包含 > 仅邮箱包含
+		ids := []uint{res.Hits[0].ID, res.Hits[1].ID, res.Hits[2].ID}
+		assert.Equal(t, []uint{1, 2, 3}, ids)
+		assert.Equal(t, "<em>ali</em>ce", res.Hits[0].Highlights["username"])
+		assert.Equal(t, "bob.<em>ali</em>son@example.com", res.Hits[2].Highlights["email"])
+	})
+
+	t.Run("AllTermsRequired", func(t *testing.T) {
+		res, _ := idx.Search(ctx, "ALI example", 1, 10)
+		assert.Equal(t, int64(2), res.Total)
+	})
+
+	t.Run("Paginated", func(t *testing.T) {
+		res, _ := idx.Search(ctx, "ali", 2, 2)
+		assert.Equal(t, int64(3), res.Total)
+		if assert.Len(t, res.Hits, 1) {
+			assert.Equal(t, uint(3), res.Hits[0].ID)
+		}
+	})
+
+	t.Run("Reindexed", func(t *testing.T) {
+		idx.Index(ctx, Document{ID: 2, Username: "mallory", Email: "m@corp.com"})
+		idx.Delete(ctx, 3)
+		res, _ := idx.Search(ctx, "ali", 1, 10)
+		assert.Equal(t, int64(1), res.Total)
+		res, _ = idx.Search(ctx, "llo", 1, 10)
+		assert.Equal(t, int64(1), res.Total)
+	})
+}
+
+func TestHighlight(t *testing.T) {
+	assert.Equal(t, "<em>abc</em>d", Highlight("abcd", []string{"ab", "bc"}))
+	assert.Equal(t, "<em>Al</em>ice &lt;<em>al</em>&gt;", Highlight("Alice <al>", []string{"al"}))
+	assert.Equal(t, "bob", Highlight("bob", []string{"x"}))
+}
@@ -0,0 +1,82 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const fulltextIndexName = "ft_users_search"
+
+// MySQLIndex 基于 users 表上 ngram 分词的 FULLTEXT 索引，索引由 MySQL 随数据同步维护。
+// ngram 默认按两个字切分，检索词至少需要两个字
+type MySQLIndex struct {
+	db *gorm.DB
+}
+
+// NewMySQLIndex 创建检索实现。FULLTEXT 索引由迁移 0002_users_fulltext 创建，不存在时返回错误
+func NewMySQLIndex(db *gorm.DB) (*MySQLIndex, error) {
+	if !db.Migrator().HasIndex("users", fulltextIndexName) {
+		return nil, fmt.Errorf("FULLTEXT 索引 %s 不存在，请先执行 migrate up", fulltextIndexName)
+	}
+	return &MySQLIndex{db: db}, nil
+}
+
+// Index 数据已在 users 表中，无需单独写入
+func (m *MySQLIndex) Index(ctx context.Context, doc Document) error {
+	return nil
+}
+
+// Delete 软删除的用户在查询时排除，无需单独删除
+func (m *MySQLIndex) Delete(ctx context.Context, id uint) error {
+	return nil
+}
+
+// booleanQuery 将检索词转换为布尔模式查询，每个词作为必须命中的短语
+func booleanQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = `+"` + strings.ReplaceAll(t, `"`, "") + `"`
+	}
+	return strings.Join(parts, " ")
+}
+
+const matchExpr = "MATCH(username, email) AGAINST(? IN BOOLEAN MODE)"
+
+func (m *MySQLIndex) Search(ctx context.Context, query string, page, size int) (*Result, error) {
+	terms := Terms(query)
+	if len(terms) == 0 {
+		return &Result{}, nil
+	}
+	against := booleanQuery(terms)
+	base := func() *gorm.DB {
+		return m.db.WithContext(ctx).Table("users").Where("deleted_at IS NULL").Where(matchExpr, against)
+	}
+
+	result := &Result{}
+	if err := base().Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		ID       uint
+		Username string
+		Email    string
+		Score    float64
+	}
+	err := base().Select("id, username, email, "+matchExpr+" AS score", against).
+		Order("score DESC, id").Offset((page - 1) * size).Limit(size).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		result.Hits = append(result.Hits, Hit{
+			ID:         r.ID,
+			Score:      r.Score,
+			Highlights: highlights(Document{ID: r.ID, Username: r.Username, Email: r.Email}, terms),
+		})
+	}
+	return result, nil
+}
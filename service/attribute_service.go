@@ -0,0 +1,201 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"gin-crud/common"
+	"gin-crud/models"
+	"math"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// 自定义属性类型
+const (
+	AttrString = "string"
+	AttrInt    = "int"
+	AttrNumber = "number"
+	AttrBool   = "bool"
+)
+
+// AttributeError 自定义属性校验失败
+type AttributeError struct {
+	Field  string
+	Reason string
+}
+
+func (e *AttributeError) Error() string {
+	return fmt.Sprintf("属性 %s %s", e.Field, e.Reason)
+}
+
+// patternCache 已编译的属性正则，配置热更新后按新的表达式重新编译
+var patternCache sync.Map
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patternCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patternCache.Store(pattern, re)
+	return re, nil
+}
+
+// attributeDefs 返回当前配置中的属性定义，以名称为 key
+func attributeDefs() map[string]common.Attribute {
+	defs := make(map[string]common.Attribute, len(common.Conf.Attributes))
+	for _, def := range common.Conf.Attributes {
+		defs[def.Name] = def
+	}
+	return defs
+}
+
+// normalizeAttribute 按定义检查单个属性值的类型、格式和可选值，返回规范化后的值
+func normalizeAttribute(def common.Attribute, value interface{}) (interface{}, error) {
+	var text string
+	switch def.Type {
+	case AttrString, "":
+		v, ok := value.(string)
+		if !ok {
+			return nil, &AttributeError{Field: def.Name, Reason: "必须是字符串"}
+		}
+		if def.Pattern != "" {
+			re, err := compilePattern(def.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("属性 %s 的正则配置错误: %w", def.Name, err)
+			}
+			if !re.MatchString(v) {
+				return nil, &AttributeError{Field: def.Name, Reason: "格式不正确"}
+			}
+		}
+		value, text = v, v
+	case AttrInt:
+		// JSON 数字解码为 float64，要求是整数
+		v, ok := value.(float64)
+		if !ok || v != math.Trunc(v) {
+			return nil, &AttributeError{Field: def.Name, Reason: "必须是整数"}
+		}
+		value, text = int64(v), strconv.FormatInt(int64(v), 10)
+	case AttrNumber:
+		v, ok := value.(float64)
+		if !ok {
+			return nil, &AttributeError{Field: def.Name, Reason: "必须是数字"}
+		}
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	case AttrBool:
+		v, ok := value.(bool)
+		if !ok {
+			return nil, &AttributeError{Field: def.Name, Reason: "必须是布尔值"}
+		}
+		text = strconv.FormatBool(v)
+	default:
+		return nil, fmt.Errorf("属性 %s 的类型配置错误: %s", def.Name, def.Type)
+	}
+
+	if len(def.Enum) > 0 {
+		for _, option := range def.Enum {
+			if option == text {
+				return value, nil
+			}
+		}
+		return nil, &AttributeError{Field: def.Name, Reason: "不在可选值范围内"}
+	}
+	return value, nil
+}
+
+// validateAttributes 校验 changes 中的属性并合并到 current 上，值为 null 表示删除该属性。
+// 只校验本次提交的属性，配置中已移除的旧属性原样保留；合并后检查必填属性
+func validateAttributes(current, changes models.Attributes) (models.Attributes, error) {
+	defs := attributeDefs()
+	merged := make(models.Attributes, len(current)+len(changes))
+	for k, v := range current {
+		merged[k] = v
+	}
+
+	for name, value := range changes {
+		def, ok := defs[name]
+		if !ok {
+			return nil, &AttributeError{Field: name, Reason: "未定义"}
+		}
+		if value == nil {
+			delete(merged, name)
+			continue
+		}
+		v, err := normalizeAttribute(def, value)
+		if err != nil {
+			return nil, err
+		}
+		merged[name] = v
+	}
+
+	for _, def := range common.Conf.Attributes {
+		if _, ok := merged[def.Name]; def.Required && !ok {
+			return nil, &AttributeError{Field: def.Name, Reason: "为必填项"}
+		}
+	}
+	if len(merged) == 0 {
+		return nil, nil
+	}
+	return merged, nil
+}
+
+// mergeUserAttributes 将更新请求中的 attributes 合并到用户当前的属性上，null 表示清空全部属性。
+// 当前属性从主库读取，避免基于副本上的旧值合并后覆盖刚写入的属性
+func (s *UserService) mergeUserAttributes(id string, raw interface{}) (models.Attributes, error) {
+	user, err := s.Repo.Primary().GetUserByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("用户不存在")
+		}
+		return nil, err
+	}
+
+	switch changes := raw.(type) {
+	case nil:
+		return validateAttributes(nil, nil)
+	case map[string]interface{}:
+		return validateAttributes(user.Attributes, changes)
+	default:
+		return nil, &AttributeError{Field: "attributes", Reason: "必须是对象"}
+	}
+}
+
+// ListUsers 分页查询用户，filters 为自定义属性的等值过滤条件
+func (s *UserService) ListUsers(page, size int, filters map[string]string) ([]models.User, int64, error) {
+	defs := attributeDefs()
+	normalized := make(map[string]string, len(filters))
+	for name, value := range filters {
+		def, ok := defs[name]
+		if !ok {
+			return nil, 0, &AttributeError{Field: name, Reason: "未定义"}
+		}
+		// 与 JSON_UNQUOTE 后的文本形式比较，数值和布尔值需要规范化
+		switch def.Type {
+		case AttrInt:
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, 0, &AttributeError{Field: name, Reason: "必须是整数"}
+			}
+			value = strconv.FormatInt(n, 10)
+		case AttrNumber:
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, 0, &AttributeError{Field: name, Reason: "必须是数字"}
+			}
+			value = strconv.FormatFloat(f, 'f', -1, 64)
+		case AttrBool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, 0, &AttributeError{Field: name, Reason: "必须是布尔值"}
+			}
+			value = strconv.FormatBool(b)
+		}
+		normalized[name] = value
+	}
+	return s.Repo.ListUsers(page, size, normalized)
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"errors"
+	"gin-crud/common"
+	"gin-crud/models"
+	"testing"
+)
+
+func withAttributes(t *testing.T, defs []common.Attribute) {
+	old := common.Conf.Attributes
+	common.Conf.Attributes = defs
+	t.Cleanup(func() { common.Conf.Attributes = old })
+}
+
+func TestValidateAttributes(t *testing.T) {
+	withAttributes(t, []common.Attribute{
+		{Name: "phone", Type: "string", Required: true, Pattern: `^[0-9]{6,15}$`},
+		{Name: "department", Type: "string", Enum: []string{"engineering", "sales"}},
+		{Name: "level", Type: "int"},
+		{Name: "remote", Type: "bool"},
+	})
+
+	tests := []struct {
+		name    string
+		current models.Attributes
+		changes models.Attributes
+		field   string // 期望出错的属性，为空表示校验通过
+	}{
+		{"合法", nil, models.Attributes{"phone": "13800000000", "level": float64(3), "remote": true}, ""},
+		{"缺少必填", nil, models.Attributes{"department": "sales"}, "phone"},
+		{"正则不匹配", nil, models.Attributes{"phone": "abc"}, "phone"},
+		{"不在可选值内", nil, models.Attributes{"phone": "13800000000", "department": "hr"}, "department"},
+		{"整数类型", nil, models.Attributes{"phone": "13800000000", "level": 1.5}, "level"},
+		{"布尔类型", nil, models.Attributes{"phone": "13800000000", "remote": "yes"}, "remote"},
+		{"未定义属性", nil, models.Attributes{"phone": "13800000000", "foo": "bar"}, "foo"},
+		{"合并已有属性", models.Attributes{"phone": "13800000000"}, models.Attributes{"department": "sales"}, ""},
+		{"删除必填属性", models.Attributes{"phone": "13800000000"}, models.Attributes{"phone": nil}, "phone"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validateAttributes(tt.current, tt.changes)
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("不应出错: %v", err)
+				}
+				return
+			}
+			var attrErr *AttributeError
+			if !errors.As(err, &attrErr) || attrErr.Field != tt.field {
+				t.Fatalf("期望属性 %s 校验失败，实际 %v", tt.field, err)
+			}
+		})
+	}
+}
+
+func TestValidateAttributes_Normalize(t *testing.T) {
+	withAttributes(t, []common.Attribute{{Name: "level", Type: "int"}})
+
+	attrs, err := validateAttributes(models.Attributes{"legacy": "x"}, models.Attributes{"level": float64(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs["level"] != int64(2) {
+		t.Errorf("整数属性应规范化为 int64，实际 %T", attrs["level"])
+	}
+	if attrs["legacy"] != "x" {
+		t.Error("配置中已移除的旧属性应原样保留")
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// jpegWithOrientation 生成一张 w×h 的 JPEG，并插入带 Orientation 的 EXIF 段
+func jpegWithOrientation(t *testing.T, w, h, orientation int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1,
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, byte(orientation), 0, 0,
+		0, 0, 0, 0}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	n := len(payload) + 2
+	app1 := append([]byte{0xFF, 0xE1, byte(n >> 8), byte(n)}, payload...)
+
+	data := buf.Bytes()
+	return append(append([]byte{0xFF, 0xD8}, app1...), data[2:]...)
+}
+
+func TestDecodeAvatar_Orientation(t *testing.T) {
+	data := jpegWithOrientation(t, 40, 20, 6)
+	if o := jpegOrientation(data); o != 6 {
+		t.Fatalf("应读取到 Orientation 6，实际 %d", o)
+	}
+
+	img, err := decodeAvatar(data, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 20 || b.Dy() != 40 {
+		t.Errorf("旋转 90° 后应为 20x40，实际 %dx%d", b.Dx(), b.Dy())
+	}
+
+	out, err := encodeJPEG(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(out, []byte("Exif")) {
+		t.Error("重新编码后不应包含 EXIF")
+	}
+}
+
+func TestDecodeAvatar_Resize(t *testing.T) {
+	img, err := decodeAvatar(jpegWithOrientation(t, 300, 150, 1), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Errorf("应等比缩小到 100x50，实际 %dx%d", b.Dx(), b.Dy())
+	}
+
+	thumb := squareThumbnail(img, 32)
+	if b := thumb.Bounds(); b.Dx() != 32 || b.Dy() != 32 {
+		t.Errorf("缩略图应为 32x32，实际 %dx%d", b.Dx(), b.Dy())
+	}
+}
+
+func TestDecodeAvatar_RejectsNonImage(t *testing.T) {
+	_, err := decodeAvatar([]byte("<html><body>not an image</body></html>"), 1024)
+	if _, ok := err.(*InvalidAvatarError); !ok {
+		t.Errorf("非图片应返回 InvalidAvatarError，实际 %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gin-crud/common"
+	"gin-crud/models"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrNoAvatar 用户未设置头像
+var ErrNoAvatar = errors.New("用户未设置头像")
+
+// InvalidAvatarError 上传的文件不是可接受的头像图片
+type InvalidAvatarError struct {
+	Reason string
+}
+
+func (e *InvalidAvatarError) Error() string {
+	return e.Reason
+}
+
+// AvatarURLs 头像的签名访问地址，thumbnails 以边长为 key
+type AvatarURLs struct {
+	Original   string            `json:"original"`
+	Thumbnails map[string]string `json:"thumbnails"`
+	ExpiresAt  time.Time         `json:"expires_at"`
+}
+
+// AvatarMaxSize 上传头像允许的最大字节数，控制器据此限制请求体
+func AvatarMaxSize() int64 {
+	if n := common.Conf.Avatar.MaxSize; n > 0 {
+		return n
+	}
+	return 5 << 20
+}
+
+func avatarURLExpire() time.Duration {
+	if n := common.Conf.Storage.URLExpire; n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	return time.Hour
+}
+
+func avatarKey(prefix string, size int) string {
+	if size == 0 {
+		return prefix + "/original.jpg"
+	}
+	return fmt.Sprintf("%s/%d.jpg", prefix, size)
+}
+
+// UploadAvatar 校验图片、去除元数据并生成缩略图后写入对象存储，成功后删除旧头像。
+// 每次上传使用新的 key 前缀，旧的签名 URL 和 CDN 缓存不会返回新图片
+func (s *UserService) UploadAvatar(id string, data []byte) (*AvatarURLs, error) {
+	if s.Blobs == nil {
+		return nil, errors.New("未配置对象存储")
+	}
+	if int64(len(data)) > AvatarMaxSize() {
+		return nil, &InvalidAvatarError{Reason: fmt.Sprintf("头像文件不能超过 %d 字节", AvatarMaxSize())}
+	}
+	user, err := s.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := decodeAvatar(data, common.Conf.Avatar.MaxDimension)
+	if err != nil {
+		return nil, err
+	}
+	files := map[int][]byte{}
+	if files[0], err = encodeJPEG(img); err != nil {
+		return nil, err
+	}
+	for _, size := range common.Conf.Avatar.ThumbnailSizes {
+		if size <= 0 {
+			continue
+		}
+		if files[size], err = encodeJPEG(squareThumbnail(img, size)); err != nil {
+			return nil, err
+		}
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	prefix := fmt.Sprintf("avatars/%d/%s", user.ID, hex.EncodeToString(b))
+	ctx := context.Background()
+	for size, content := range files {
+		if err := s.Blobs.Put(ctx, avatarKey(prefix, size), bytes.NewReader(content), int64(len(content)), "image/jpeg"); err != nil {
+			s.deleteAvatarBlobs(prefix)
+			return nil, err
+		}
+	}
+
+	if err := s.applyUpdate(id, nil, map[string]interface{}{"avatar": prefix}); err != nil {
+		s.deleteAvatarBlobs(prefix)
+		return nil, err
+	}
+	if user.Avatar != "" {
+		s.deleteAvatarBlobs(user.Avatar)
+	}
+
+	user.Avatar = prefix
+	return s.AvatarURLs(user)
+}
+
+// DeleteAvatar 删除用户头像
+func (s *UserService) DeleteAvatar(id string) error {
+	user, err := s.GetUser(id)
+	if err != nil {
+		return err
+	}
+	if user.Avatar == "" {
+		return ErrNoAvatar
+	}
+	if err := s.applyUpdate(id, nil, map[string]interface{}{"avatar": ""}); err != nil {
+		return err
+	}
+	s.deleteAvatarBlobs(user.Avatar)
+	return nil
+}
+
+// AvatarURL 生成指定尺寸头像的签名地址，size 为 0 表示原图，其它值必须是配置中的缩略图尺寸
+func (s *UserService) AvatarURL(user *models.User, size int) (string, error) {
+	if user.Avatar == "" || s.Blobs == nil {
+		return "", ErrNoAvatar
+	}
+	if size != 0 && !isThumbnailSize(size) {
+		return "", errors.New("不支持的头像尺寸")
+	}
+	return s.Blobs.SignedURL(context.Background(), avatarKey(user.Avatar, size), avatarURLExpire())
+}
+
+// AvatarURLs 生成原图和全部缩略图的签名地址
+func (s *UserService) AvatarURLs(user *models.User) (*AvatarURLs, error) {
+	expiresAt := time.Now().Add(avatarURLExpire())
+	original, err := s.AvatarURL(user, 0)
+	if err != nil {
+		return nil, err
+	}
+	urls := &AvatarURLs{Original: original, Thumbnails: map[string]string{}, ExpiresAt: expiresAt}
+	for _, size := range common.Conf.Avatar.ThumbnailSizes {
+		if size <= 0 {
+			continue
+		}
+		u, err := s.AvatarURL(user, size)
+		if err != nil {
+			return nil, err
+		}
+		urls.Thumbnails[strconv.Itoa(size)] = u
+	}
+	return urls, nil
+}
+
+func isThumbnailSize(size int) bool {
+	for _, s := range common.Conf.Avatar.ThumbnailSizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteAvatarBlobs 删除一个头像前缀下的原图和缩略图，失败只记录日志。
+// 按当前配置的尺寸删除，修改尺寸配置前上传的旧缩略图需要手动清理
+func (s *UserService) deleteAvatarBlobs(prefix string) {
+	if s.deferred(func(s *UserService) { s.deleteAvatarBlobs(prefix) }) {
+		return
+	}
+	if s.Blobs == nil || prefix == "" {
+		return
+	}
+	ctx := context.Background()
+	sizes := append([]int{0}, common.Conf.Avatar.ThumbnailSizes...)
+	for _, size := range sizes {
+		if err := s.Blobs.Delete(ctx, avatarKey(prefix, size)); err != nil {
+			common.Logger.Error("删除头像文件失败", zap.String("key", avatarKey(prefix, size)), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gin-crud/cache"
+	"gin-crud/common"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// cachePolicy 单类缓存生效的策略
+type cachePolicy struct {
+	TTL          time.Duration
+	NegativeTTL  time.Duration // 0 表示不缓存空值
+	Jitter       float64
+	EarlyRefresh float64 // 0 表示不提前刷新
+}
+
+// defaultCachePolicies 各类缓存的默认策略，配置中为 0 的项取这里的值
+var defaultCachePolicies = map[string]cachePolicy{
+	"user":        {TTL: 10 * time.Minute, NegativeTTL: 30 * time.Second, Jitter: 0.1, EarlyRefresh: 1},
+	"user_pid":    {TTL: 24 * time.Hour, NegativeTTL: time.Minute, Jitter: 0.1},
+	"user_groups": {TTL: 10 * time.Minute, Jitter: 0.1, EarlyRefresh: 1},
+}
+
+// cachePolicyFor 合并默认策略和配置，每次读取最新配置，支持热更新
+func cachePolicyFor(entity string) cachePolicy {
+	p := defaultCachePolicies[entity]
+	if p.TTL == 0 {
+		p.TTL = 10 * time.Minute
+	}
+	c, ok := common.Conf.Cache.Policies[entity]
+	if !ok {
+		return p
+	}
+	if c.TTL > 0 {
+		p.TTL = time.Duration(c.TTL) * time.Second
+	}
+	switch {
+	case c.NegativeTTL > 0:
+		p.NegativeTTL = time.Duration(c.NegativeTTL) * time.Second
+	case c.NegativeTTL < 0:
+		p.NegativeTTL = 0
+	}
+	switch {
+	case c.Jitter > 0:
+		p.Jitter = c.Jitter
+	case c.Jitter < 0:
+		p.Jitter = 0
+	}
+	switch {
+	case c.EarlyRefresh > 0:
+		p.EarlyRefresh = c.EarlyRefresh
+	case c.EarlyRefresh < 0:
+		p.EarlyRefresh = 0
+	}
+	return p
+}
+
+// jittered 在 ttl 上加随机浮动，避免同一时间写入的大量 key 同时过期
+func (p cachePolicy) jittered(ttl time.Duration) time.Duration {
+	if p.Jitter <= 0 {
+		return ttl
+	}
+	return time.Duration(float64(ttl) * (1 + p.Jitter*(2*rand.Float64()-1)))
+}
+
+// maxTTL 加上浮动后可能的最长有效期，与缓存配套的辅助 key 用它保证不早于缓存过期
+func (p cachePolicy) maxTTL() time.Duration {
+	return time.Duration(float64(p.TTL) * (1 + p.Jitter))
+}
+
+// cacheSchemas 各类缓存值的结构版本，写入时记录在缓存值头部，读取时版本不一致的旧值会被清除。
+// 缓存的结构（包括 cacheEnvelope 本身）发生不兼容的变化时，递增对应类别的版本号
+var cacheSchemas = map[string]uint16{
+	"user":        3, // 2: 缓存中保存头像；3: 不再保存密码哈希
+	"user_pid":    1,
+	"user_groups": 1,
+}
+
+// cacheCodec 按最新配置构造编解码方式，只影响新写入的值
+func cacheCodec() cache.Codec {
+	c := common.Conf.Cache
+	return cache.Codec{Format: c.Codec, Compression: c.Compression, MinCompress: c.CompressMinSize}
+}
+
+// cacheEnvelope 写入共享缓存的值
+type cacheEnvelope struct {
+	Missing bool   `json:"missing,omitempty"` // 空值：记录不存在
+	Value   []byte `json:"value,omitempty"`   // 按 codec 编码的缓存对象
+	Delta   int64  `json:"delta"`             // 回源耗时（微秒）
+	Expiry  int64  `json:"expiry"`            // 过期时间（Unix 毫秒）
+
+	codec cache.Codec // 写入时使用的编解码方式
+}
+
+// shouldRefresh 按 XFetch 算法判断是否提前回源：越临近过期、回源越慢，提前刷新的概率越高，
+// 使热点 key 通常由单个请求在过期前刷新，而不是过期后所有请求同时回源
+func (e *cacheEnvelope) shouldRefresh(beta float64, now time.Time) bool {
+	if beta <= 0 || e.Missing {
+		return false
+	}
+	delta := float64(e.Delta) / 1000 // 毫秒
+	return float64(now.UnixMilli())-delta*beta*math.Log(rand.Float64()) >= float64(e.Expiry)
+}
+
+// store 返回共享缓存，未配置时不缓存
+func (s *UserService) store() cache.Cache {
+	if s.Cache == nil {
+		return cache.Noop{}
+	}
+	return s.Cache
+}
+
+// logCacheError 记录缓存操作失败。未命中是正常情况；不可用时已在进入降级状态时记录过
+func logCacheError(msg string, err error, fields ...zap.Field) {
+	if err == nil || errors.Is(err, cache.ErrMiss) || errors.Is(err, cache.ErrUnavailable) {
+		return
+	}
+	common.Logger.Error(msg, append(fields, zap.Error(err))...)
+}
+
+// fetchCached 带击穿保护的两级缓存读取，先查进程内缓存，再查共享缓存；共享缓存不可用时直接回源。同一 key 的并发回源合并为一次；
+// 记录不存在时按策略短期缓存空值；TTL 加随机浮动；临近过期时按概率提前回源。load 返回 found=false 表示记录不存在
+func fetchCached[T any](s *UserService, entity, key string, load func() (T, bool, error)) (T, bool, error) {
+	return fetchCachedWith(s, entity, key, load, nil)
+}
+
+// fetchCachedWith 同 fetchCached，回源找到记录时 related 返回的条目（如反向索引）与缓存值一次写入，
+// 并排在缓存值之前，保证缓存值存在时这些条目也已写入
+func fetchCachedWith[T any](s *UserService, entity, key string, load func() (T, bool, error), related func(v T) []cache.Entry) (T, bool, error) {
+	ctx := context.Background()
+	policy := cachePolicyFor(entity)
+
+	if s.Local != nil {
+		if v, ok := s.Local.Get(key); ok {
+			return decodeEnvelope[T](v.(*cacheEnvelope))
+		}
+	}
+
+	var zero T
+	if val, err := s.store().Get(ctx, key); err == nil {
+		if env, v, found, ok := openShared[T](s, ctx, entity, key, val); ok && !env.shouldRefresh(policy.EarlyRefresh, time.Now()) {
+			common.Logger.Info("Cache Hit: " + key)
+			s.root().cacheStats.sharedHits.Add(1)
+			s.setLocal(key, env)
+			return v, found, nil
+		}
+	} else {
+		logCacheError("读取缓存失败", err, zap.String("key", key))
+	}
+	common.Logger.Info("Cache Miss: " + key)
+	s.root().cacheStats.sharedMisses.Add(1)
+
+	// 合并的请求共享同一份序列化结果，各自解码，互不影响
+	res, err, _ := s.root().flight.Do(key, func() (interface{}, error) {
+		start := time.Now()
+		v, found, err := load()
+		if err != nil {
+			return nil, err
+		}
+		env, data, ttl, err := sealEnvelope(entity, policy, v, found, time.Since(start))
+		if err != nil {
+			return nil, err
+		}
+		if ttl > 0 {
+			var entries []cache.Entry
+			if found && related != nil {
+				entries = related(v)
+			}
+			entries = append(entries, cache.Entry{Key: key, Value: data, TTL: ttl})
+			logCacheError("写入缓存失败", s.store().SetMany(ctx, entries), zap.String("key", key))
+			s.setLocal(key, env)
+		}
+		return env, nil
+	})
+	if err != nil {
+		return zero, false, err
+	}
+	return decodeEnvelope[T](res.(*cacheEnvelope))
+}
+
+// sealEnvelope 按策略将回源结果编码为缓存值，delta 为回源耗时。ttl 为 0 表示按策略不缓存，此时 data 为空
+func sealEnvelope(entity string, policy cachePolicy, v interface{}, found bool, delta time.Duration) (env *cacheEnvelope, data []byte, ttl time.Duration, err error) {
+	env = &cacheEnvelope{Missing: !found, Delta: delta.Microseconds(), codec: cacheCodec()}
+	if found {
+		if env.Value, err = env.codec.Marshal(v); err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	ttl = policy.NegativeTTL
+	if found {
+		ttl = policy.jittered(policy.TTL)
+	}
+	if ttl <= 0 {
+		return env, nil, 0, nil
+	}
+	env.Expiry = time.Now().Add(ttl).UnixMilli()
+	if data, err = env.codec.Encode(cacheSchemas[entity], env); err != nil {
+		return nil, nil, 0, err
+	}
+	return env, data, ttl, nil
+}
+
+// openShared 解码共享缓存中的值。先解码一次缓存对象，确认与当前结构兼容后才能放入本地缓存；
+// 无法解码时清除该值，返回 ok=false
+func openShared[T any](s *UserService, ctx context.Context, entity, key string, data []byte) (env *cacheEnvelope, v T, found, ok bool) {
+	env = &cacheEnvelope{}
+	var err error
+	if env.codec, err = cache.Decode(data, cacheSchemas[entity], env); err == nil {
+		if v, found, err = decodeEnvelope[T](env); err == nil {
+			return env, v, found, true
+		}
+	}
+	s.discardCached(ctx, key, err)
+	return nil, v, false, false
+}
+
+func decodeEnvelope[T any](env *cacheEnvelope) (T, bool, error) {
+	var v T
+	if env.Missing {
+		return v, false, nil
+	}
+	if err := env.codec.Unmarshal(env.Value, &v); err != nil {
+		return v, false, fmt.Errorf("%w: %v", cache.ErrCorrupt, err)
+	}
+	return v, true, nil
+}
+
+// discardCached 清除无法解码的缓存值并计数，随后按未命中处理
+func (s *UserService) discardCached(ctx context.Context, key string, err error) {
+	if errors.Is(err, cache.ErrSchemaMismatch) {
+		s.root().cacheStats.schemaMismatches.Add(1)
+	} else {
+		s.root().cacheStats.corrupt.Add(1)
+		common.Logger.Warn("缓存值无法解码，已清除", zap.String("key", key), zap.Error(err))
+	}
+	logCacheError("清除缓存失败", s.store().Delete(ctx, key), zap.String("key", key))
+}
+
+// cacheInvalidateChannel 缓存失效通知的频道，消息内容为换行分隔的 key
+const cacheInvalidateChannel = "cache_invalidate"
+
+// localCacheTTL 本地副本有效期，每次读取最新配置
+func localCacheTTL() time.Duration {
+	if ttl := common.Conf.Cache.Local.TTL; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return 30 * time.Second
+}
+
+// setLocal 写入本地缓存，有效期不超过 Redis 中的剩余有效期。
+// 本地保存的是信封本身，读取时各自解码，调用方拿到的值互不共享
+func (s *UserService) setLocal(key string, env *cacheEnvelope) {
+	if s.Local == nil {
+		return
+	}
+	ttl := localCacheTTL()
+	if remaining := time.Until(time.UnixMilli(env.Expiry)); remaining < ttl {
+		ttl = remaining
+	}
+	s.Local.Set(key, env, ttl)
+}
+
+// evictCache 删除共享缓存和本地缓存，并通知其他实例清除各自的本地副本
+func (s *UserService) evictCache(ctx context.Context, keys ...string) {
+	logCacheError("清除缓存失败", s.store().Delete(ctx, keys...), zap.Strings("keys", keys))
+	s.evictLocal(ctx, keys...)
+}
+
+// evictLocal 删除本地缓存并通知其他实例，用于共享缓存中的值已被改写的情况
+func (s *UserService) evictLocal(ctx context.Context, keys ...string) {
+	if s.Local == nil {
+		return
+	}
+	s.Local.Delete(keys...)
+	if b, ok := s.store().(cache.Broadcaster); ok {
+		err := b.Publish(ctx, cacheInvalidateChannel, strings.Join(keys, "\n"))
+		logCacheError("发布缓存失效通知失败", err, zap.Strings("keys", keys))
+	}
+}
+
+// RunCacheInvalidation 订阅其他实例的缓存失效通知并清除本地副本，直到 ctx 取消。
+// 共享缓存不支持广播时直接返回；断线期间的通知会丢失，此时依靠本地副本的短有效期兜底
+func (s *UserService) RunCacheInvalidation(ctx context.Context) {
+	b, ok := s.store().(cache.Broadcaster)
+	if s.Local == nil || !ok {
+		return
+	}
+	for msg := range b.Subscribe(ctx, cacheInvalidateChannel) {
+		s.Local.Delete(strings.Split(msg, "\n")...)
+	}
+}
+
+// cacheCounters 共享缓存层的命中统计，本地层的统计由 cache.LRU 维护
+type cacheCounters struct {
+	sharedHits, sharedMisses  atomic.Int64
+	schemaMismatches, corrupt atomic.Int64
+}
+
+// TierStats 单层缓存的命中统计
+type TierStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// DecodeFailureStats 共享缓存中无法解码而被清除的值的数量
+type DecodeFailureStats struct {
+	SchemaMismatch int64 `json:"schema_mismatch"` // 由其他结构版本写入，通常出现在升级部署期间
+	Corrupt        int64 `json:"corrupt"`         // 格式无法识别或数据损坏
+}
+
+// CacheStats 各层缓存的命中统计，未启用本地缓存时 Local 为空。
+// Available 为 false 表示共享缓存处于降级状态，请求直接查库
+type CacheStats struct {
+	Local          *cache.LRUStats    `json:"local"`
+	Shared         TierStats          `json:"shared"`
+	DecodeFailures DecodeFailureStats `json:"decode_failures"`
+	Available      bool               `json:"available"`
+}
+
+// CacheStats 返回本实例启动以来的缓存命中统计
+func (s *UserService) CacheStats() CacheStats {
+	stats := CacheStats{
+		Shared: TierStats{
+			Hits:   s.root().cacheStats.sharedHits.Load(),
+			Misses: s.root().cacheStats.sharedMisses.Load(),
+		},
+		DecodeFailures: DecodeFailureStats{
+			SchemaMismatch: s.root().cacheStats.schemaMismatches.Load(),
+			Corrupt:        s.root().cacheStats.corrupt.Load(),
+		},
+		Available: true,
+	}
+	if r, ok := s.store().(*cache.Redis); ok {
+		stats.Available = r.Available()
+	}
+	if s.Local != nil {
+		local := s.Local.Stats()
+		stats.Local = &local
+	}
+	return stats
+}
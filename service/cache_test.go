@@ -0,0 +1,354 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"gin-crud/cache"
+	"gin-crud/common"
+	"gin-crud/dao"
+	"gin-crud/models"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestUserService_GetUserStampede(t *testing.T) {
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+	rdb, mr := mockRedis(t)
+	userService := &UserService{Repo: dao.NewGormRepository(db), RDB: rdb, Cache: cache.NewRedis(rdb)}
+	selectSQL := "^SELECT \\* FROM `users` WHERE public_id = \\?"
+
+	t.Run("Coalesced", func(t *testing.T) {
+		pid := "0192f5a8-7c00-7000-8000-000000000011"
+		// 只允许一次查询，回源期间到达的请求等待同一结果
+		mock.ExpectQuery(selectSQL).WithArgs(pid, 1).
+			WillDelayFor(50 * time.Millisecond).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "public_id", "username"}).AddRow(11, pid, "hot"))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				user, err := userService.GetUser(pid)
+				if assert.NoError(t, err) {
+					assert.Equal(t, uint(11), user.ID)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("NegativeCached", func(t *testing.T) {
+		pid := "0192f5a8-7c00-7000-8000-000000000012"
+		mock.ExpectQuery(selectSQL).WithArgs(pid, 1).WillReturnError(gorm.ErrRecordNotFound)
+
+		for i := 0; i < 3; i++ {
+			_, err := userService.GetUser(pid)
+			assert.EqualError(t, err, "用户不存在")
+		}
+		ttl := mr.TTL(userCacheKey(pid))
+		assert.True(t, ttl > 0 && ttl <= 30*time.Second)
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserService_TwoTierCache(t *testing.T) {
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+	rdb, mr := mockRedis(t)
+	// 两个实例共享数据库和 Redis，各自有进程内缓存
+	a := &UserService{Repo: dao.NewGormRepository(db), RDB: rdb, Cache: cache.NewRedis(rdb), Local: cache.NewLRU(100)}
+	b := &UserService{Repo: dao.NewGormRepository(db), RDB: rdb, Cache: cache.NewRedis(rdb), Local: cache.NewLRU(100)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.RunCacheInvalidation(ctx)
+	assert.Eventually(t, func() bool {
+		return mr.PubSubNumSub(cacheInvalidateChannel)[cacheInvalidateChannel] == 1
+	}, time.Second, 10*time.Millisecond)
+
+	pid := "0192f5a8-7c00-7000-8000-000000000021"
+	selectSQL := "^SELECT \\* FROM `users` WHERE public_id = \\?"
+	rows := func(name string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "public_id", "username"}).AddRow(21, pid, name)
+	}
+	mock.ExpectQuery(selectSQL).WithArgs(pid, 1).WillReturnRows(rows("before"))
+
+	// 首次读取回源并写入两级缓存；Redis 中的副本被删除后仍由本地缓存命中
+	user, err := b.GetUser(pid)
+	assert.NoError(t, err)
+	assert.Equal(t, "before", user.Username)
+	mr.Del(userCacheKey(pid))
+	user, err = b.GetUser(pid)
+	assert.NoError(t, err)
+	assert.Equal(t, "before", user.Username)
+
+	// 另一个实例更新后广播失效通知，本实例清除本地副本并重新回源
+	mock.ExpectBegin()
+	mock.ExpectExec("^UPDATE `users` SET").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, a.UpdateUser("21", map[string]interface{}{"username": "x"}))
+	assert.Eventually(t, func() bool {
+		return b.Local.Stats().Size == 0
+	}, time.Second, 10*time.Millisecond)
+
+	mock.ExpectQuery(selectSQL).WithArgs(pid, 1).WillReturnRows(rows("after"))
+	user, err = b.GetUser(pid)
+	assert.NoError(t, err)
+	assert.Equal(t, "after", user.Username)
+
+	stats := b.CacheStats()
+	assert.Equal(t, int64(1), stats.Local.Hits)
+	assert.Equal(t, TierStats{Hits: 0, Misses: 2}, stats.Shared)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserService_GetUserUndecodable(t *testing.T) {
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+	rdb, mr := mockRedis(t)
+	userService := &UserService{Repo: dao.NewGormRepository(db), RDB: rdb, Cache: cache.NewRedis(rdb)}
+	selectSQL := "^SELECT \\* FROM `users` WHERE public_id = \\?"
+
+	legacy := "0192f5a8-7c00-7000-8000-000000000041"
+	stale := "0192f5a8-7c00-7000-8000-000000000042"
+	// 旧版本直接写入的 JSON，以及由其他结构版本写入的值
+	mr.Set(userCacheKey(legacy), `{"id":41,"username":"legacy"}`)
+	old, _ := cache.Codec{}.Encode(cacheSchemas["user"]+1, cacheEnvelope{})
+	mr.Set(userCacheKey(stale), string(old))
+
+	for i, pid := range []string{legacy, stale} {
+		mock.ExpectQuery(selectSQL).WithArgs(pid, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "public_id", "username", "attributes"}).
+				AddRow(41+i, pid, "fresh", `{"level":3}`))
+		user, err := userService.GetUser(pid)
+		assert.NoError(t, err)
+		assert.Equal(t, "fresh", user.Username)
+	}
+
+	// 清除后重新写入的值可以正常读取，MessagePack 读回的属性数字仍为 float64
+	user, err := userService.GetUser(legacy)
+	assert.NoError(t, err)
+	assert.Equal(t, 3.0, user.Attributes["level"])
+
+	assert.Equal(t, DecodeFailureStats{SchemaMismatch: 1, Corrupt: 1}, userService.CacheStats().DecodeFailures)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserService_GetUsers(t *testing.T) {
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+	rdb, mr := mockRedis(t)
+	userService := &UserService{Repo: dao.NewGormRepository(db), RDB: rdb, Cache: cache.NewRedis(rdb), Local: cache.NewLRU(100)}
+	pid := func(n int) string { return fmt.Sprintf("0192f5a8-7c00-7000-8000-%012d", n) }
+
+	// 51 已在缓存中，其余一次查库；53 不存在
+	mock.ExpectQuery("^SELECT \\* FROM `users` WHERE public_id = \\?").WithArgs(pid(51), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "public_id", "username"}).AddRow(51, pid(51), "u51"))
+	_, err = userService.GetUser(pid(51))
+	assert.NoError(t, err)
+	userService.Local.Purge()
+
+	mock.ExpectQuery("^SELECT \\* FROM `users` WHERE public_id IN \\(\\?,\\?\\)").WithArgs(pid(52), pid(53)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "public_id", "username"}).AddRow(52, pid(52), "u52"))
+	users, err := userService.GetUsers([]string{pid(52), pid(51), pid(53), pid(52)})
+	assert.NoError(t, err)
+	if assert.Len(t, users, 2) {
+		assert.Equal(t, "u52", users[0].Username)
+		assert.Equal(t, uint(52), users[0].ID)
+		assert.Equal(t, "u51", users[1].Username)
+	}
+	assert.True(t, mr.Exists(userCacheKey(pid(52))))
+	assert.True(t, mr.Exists(userCacheKey(pid(53))))
+	assert.True(t, mr.Exists(userCacheRefKey("52")))
+
+	// 再次查询全部由本地缓存命中，不再查库
+	users, err = userService.GetUsers([]string{pid(51), pid(52), pid(53)})
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+
+	_, err = userService.GetUsers(nil)
+	assert.NoError(t, err)
+	many := make([]string, maxBatchUsers+1)
+	for i := range many {
+		many[i] = pid(1000 + i)
+	}
+	_, err = userService.GetUsers(many)
+	assert.ErrorIs(t, err, ErrTooManyUsers)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserService_UpdateUserWriteThrough(t *testing.T) {
+	defer func(v bool) { common.Conf.Cache.WriteThrough = v }(common.Conf.Cache.WriteThrough)
+	common.Conf.Cache.WriteThrough = true
+
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+	rdb, mr := mockRedis(t)
+	userService := &UserService{Repo: dao.NewGormRepository(db), RDB: rdb, Cache: cache.NewRedis(rdb)}
+	pid := "0192f5a8-7c00-7000-8000-000000000061"
+	byID := "^SELECT \\* FROM `users` WHERE `users`.`id` = \\?"
+	version := "^SELECT `version` FROM `users` WHERE id = \\?"
+
+	t.Run("Refreshed", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("^UPDATE `users` SET").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery(byID).WillReturnRows(sqlmock.NewRows([]string{"id", "public_id", "username", "version"}).
+			AddRow(61, pid, "renamed", 2))
+		mock.ExpectQuery(version).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+		assert.NoError(t, userService.UpdateUser("61", map[string]interface{}{"username": "x"}))
+
+		// 更新后缓存中已是新值，读取无需回源
+		user, err := userService.GetUser(pid)
+		assert.NoError(t, err)
+		assert.Equal(t, "renamed", user.Username)
+		assert.Equal(t, uint(2), user.Version)
+	})
+
+	t.Run("ConcurrentWriteEvicts", func(t *testing.T) {
+		// 写入缓存后发现版本号已变化，说明写入的可能是旧值，改为清除
+		mock.ExpectBegin()
+		mock.ExpectExec("^UPDATE `users` SET").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery(byID).WillReturnRows(sqlmock.NewRows([]string{"id", "public_id", "username", "version"}).
+			AddRow(61, pid, "stale", 3))
+		mock.ExpectQuery(version).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(4))
+		assert.NoError(t, userService.UpdateUser("61", map[string]interface{}{"username": "y"}))
+		assert.False(t, mr.Exists(userCacheKey(pid)))
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// TestUserService_CachedAvatar 头像不参与 JSON 序列化，经过两级缓存后仍应保留
+func TestUserService_CachedAvatar(t *testing.T) {
+	rdb, _ := mockRedis(t)
+	repo := dao.NewMemoryRepository()
+	userService := &UserService{Repo: repo, RDB: rdb, Cache: cache.NewRedis(rdb), Local: cache.NewLRU(100)}
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", Password: "secret", Avatar: "avatars/1/abc"}
+	assert.NoError(t, repo.InsertUser(user))
+
+	// 首次回源、本地缓存命中、共享缓存命中
+	for i := 0; i < 3; i++ {
+		if i == 2 {
+			userService.Local = cache.NewLRU(100)
+		}
+		got, err := userService.GetUser(user.PublicID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, user.ID, got.ID)
+			assert.Equal(t, "avatars/1/abc", got.Avatar)
+		}
+	}
+	users, err := userService.GetUsers([]string{user.PublicID})
+	if assert.NoError(t, err) && assert.Len(t, users, 1) {
+		assert.Equal(t, "avatars/1/abc", users[0].Avatar)
+	}
+}
+
+// TestUserService_WithoutRedis 只配置进程内缓存、没有 Redis 时缓存照常工作，会话类操作返回明确的错误
+func TestUserService_WithoutRedis(t *testing.T) {
+	store := cache.NewMemory()
+	userService := &UserService{Repo: dao.NewMemoryRepository(), Cache: store}
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Password: "secret"}
+	assert.NoError(t, userService.Register(alice))
+	user, err := userService.GetUser(alice.PublicID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "alice", user.Username)
+	}
+	ref, err := store.Get(context.Background(), userCacheRefKey(fmt.Sprintf("%d", alice.ID)))
+	assert.NoError(t, err)
+	assert.Equal(t, alice.PublicID, string(ref))
+
+	// 更新后通过反向索引清除缓存，再次读取得到新值
+	assert.NoError(t, userService.UpdateUserIfMatch(fmt.Sprintf("%d", alice.ID), map[string]interface{}{"username": "alice2"}, nil))
+	user, err = userService.GetUser(alice.PublicID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "alice2", user.Username)
+	}
+
+	_, err = userService.Login("alice2", "secret")
+	assert.ErrorIs(t, err, ErrSessionsUnavailable)
+	assert.ErrorIs(t, userService.RevokeSessions(alice.ID, ""), ErrSessionsUnavailable)
+	_, err = userService.RefreshToken("token")
+	assert.ErrorIs(t, err, ErrSessionsUnavailable)
+}
+
+func TestUserService_GetUserDegraded(t *testing.T) {
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+	rdb, mr := mockRedis(t)
+	mr.Close()
+	userService := &UserService{Repo: dao.NewGormRepository(db), RDB: rdb, Cache: cache.NewRedis(rdb)}
+
+	// Redis 不可用时每次都直接查库
+	pid := "0192f5a8-7c00-7000-8000-000000000031"
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery("^SELECT \\* FROM `users` WHERE public_id = \\?").WithArgs(pid, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "public_id", "username"}).AddRow(31, pid, "degraded"))
+		user, err := userService.GetUser(pid)
+		assert.NoError(t, err)
+		assert.Equal(t, "degraded", user.Username)
+	}
+	assert.False(t, userService.CacheStats().Available)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCachePolicy(t *testing.T) {
+	defer func(c map[string]common.CachePolicy) { common.Conf.Cache.Policies = c }(common.Conf.Cache.Policies)
+	common.Conf.Cache.Policies = map[string]common.CachePolicy{
+		"user": {TTL: 60, NegativeTTL: -1, Jitter: 0.5},
+	}
+
+	p := cachePolicyFor("user")
+	assert.Equal(t, time.Minute, p.TTL)
+	assert.Equal(t, time.Duration(0), p.NegativeTTL)
+	assert.Equal(t, 1.0, p.EarlyRefresh) // 未配置的项取默认值
+	for i := 0; i < 100; i++ {
+		ttl := p.jittered(p.TTL)
+		assert.True(t, ttl >= 30*time.Second && ttl <= 90*time.Second)
+	}
+	assert.Equal(t, 90*time.Second, p.maxTTL())
+
+	now := time.Now()
+	fresh := &cacheEnvelope{Delta: 1000, Expiry: now.Add(time.Hour).UnixMilli()}
+	expired := &cacheEnvelope{Delta: 1000, Expiry: now.UnixMilli()}
+	assert.False(t, fresh.shouldRefresh(1, now))
+	assert.True(t, expired.shouldRefresh(1, now))
+	assert.False(t, expired.shouldRefresh(0, now))
+}
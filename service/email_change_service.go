@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin-crud/common"
+	"gin-crud/dao"
+	"gin-crud/mail"
+	"gin-crud/models"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidEmailChangeToken 确认或撤销链接无效、已使用或已过期
+var ErrInvalidEmailChangeToken = errors.New("链接无效或已过期")
+
+// emailChange 待确认的邮箱修改申请，保存在 Redis 中，每个用户同时只有一个
+type emailChange struct {
+	UserID       uint      `json:"user_id"`
+	OldEmail     string    `json:"old_email"`
+	NewEmail     string    `json:"new_email"`
+	ConfirmToken string    `json:"confirm_token"` // 发送到新邮箱
+	CancelToken  string    `json:"cancel_token"`  // 发送到旧邮箱
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+func emailChangeKey(userID uint) string {
+	return fmt.Sprintf("email_change:%d", userID)
+}
+
+func emailChangeTokenKey(token string) string {
+	return "email_change_token:" + token
+}
+
+func emailChangeTTL() time.Duration {
+	if n := common.Conf.User.EmailChangeTTL; n > 0 {
+		return time.Duration(n) * time.Minute
+	}
+	return 24 * time.Hour
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func emailChangeLink(action, token string) string {
+	base := strings.TrimRight(common.Conf.Mail.LinkBaseURL, "/")
+	return fmt.Sprintf("%s/email-change/%s?token=%s", base, action, url.QueryEscape(token))
+}
+
+// RequestEmailChange 申请修改邮箱，需要确认密码。向新邮箱发送确认链接，向旧邮箱发送带撤销链接的通知，
+// 确认前邮箱不变；重复申请会使之前的链接失效
+func (s *UserService) RequestEmailChange(id, newEmail, password string) (time.Time, error) {
+	user, err := s.checkPassword(id, password)
+	if err != nil {
+		return time.Time{}, err
+	}
+	newEmail = models.NormalizeEmail(newEmail)
+	if newEmail == user.Email {
+		return time.Time{}, errors.New("新邮箱与当前邮箱相同")
+	}
+	existing, err := s.Repo.FindExistingValues("email", []string{newEmail})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if existing[newEmail] {
+		return time.Time{}, &common.ConflictError{Field: "email"}
+	}
+
+	change := emailChange{
+		UserID:    user.ID,
+		OldEmail:  user.Email,
+		NewEmail:  newEmail,
+		ExpiresAt: time.Now().Add(emailChangeTTL()),
+	}
+	if change.ConfirmToken, err = randomToken(); err != nil {
+		return time.Time{}, err
+	}
+	if change.CancelToken, err = randomToken(); err != nil {
+		return time.Time{}, err
+	}
+
+	rdb, err := s.sessionStore()
+	if err != nil {
+		return time.Time{}, err
+	}
+	ctx := context.Background()
+	s.clearEmailChange(ctx, user.ID)
+	data, _ := json.Marshal(change)
+	userID := strconv.FormatUint(uint64(user.ID), 10)
+	pipe := rdb.TxPipeline()
+	pipe.Set(ctx, emailChangeKey(user.ID), data, emailChangeTTL())
+	pipe.Set(ctx, emailChangeTokenKey(change.ConfirmToken), userID, emailChangeTTL())
+	pipe.Set(ctx, emailChangeTokenKey(change.CancelToken), userID, emailChangeTTL())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return time.Time{}, sessionError(err)
+	}
+
+	if err := s.sendEmailChangeMails(ctx, user, change); err != nil {
+		s.clearEmailChange(ctx, user.ID)
+		return time.Time{}, err
+	}
+	return change.ExpiresAt, nil
+}
+
+func (s *UserService) sendEmailChangeMails(ctx context.Context, user *models.User, change emailChange) error {
+	if s.Mailer == nil {
+		return errors.New("未配置邮件发送")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	expires := change.ExpiresAt.Format("2006-01-02 15:04")
+	confirm := mail.Message{
+		To:      change.NewEmail,
+		Subject: "请确认您的新邮箱",
+		Body: fmt.Sprintf("%s，您好：\n\n您申请将账号邮箱修改为本邮箱，请在 %s 前打开以下链接完成确认：\n%s\n\n如果不是您本人操作，请忽略本邮件。\n",
+			user.Username, expires, emailChangeLink("confirm", change.ConfirmToken)),
+	}
+	if err := s.Mailer.Send(ctx, confirm); err != nil {
+		return fmt.Errorf("发送确认邮件失败: %w", err)
+	}
+
+	notice := mail.Message{
+		To:      change.OldEmail,
+		Subject: "您的账号正在修改邮箱",
+		Body: fmt.Sprintf("%s，您好：\n\n您的账号申请将邮箱修改为 %s，确认后本邮箱将不再关联该账号。\n如果不是您本人操作，请立即打开以下链接撤销并修改密码：\n%s\n",
+			user.Username, change.NewEmail, emailChangeLink("cancel", change.CancelToken)),
+	}
+	if err := s.Mailer.Send(ctx, notice); err != nil {
+		return fmt.Errorf("发送通知邮件失败: %w", err)
+	}
+	return nil
+}
+
+// loadEmailChange 根据链接中的 token 读取待确认的申请
+func (s *UserService) loadEmailChange(ctx context.Context, token string) (*emailChange, error) {
+	if token == "" {
+		return nil, ErrInvalidEmailChangeToken
+	}
+	rdb, err := s.sessionStore()
+	if err != nil {
+		return nil, err
+	}
+	val, err := rdb.Get(ctx, emailChangeTokenKey(token)).Result()
+	if err == redis.Nil {
+		return nil, ErrInvalidEmailChangeToken
+	}
+	if err != nil {
+		return nil, sessionError(err)
+	}
+	userID, _ := strconv.ParseUint(val, 10, 64)
+
+	data, err := rdb.Get(ctx, emailChangeKey(uint(userID))).Result()
+	if err == redis.Nil {
+		return nil, ErrInvalidEmailChangeToken
+	}
+	if err != nil {
+		return nil, sessionError(err)
+	}
+	var change emailChange
+	if err := json.Unmarshal([]byte(data), &change); err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// clearEmailChange 删除用户的待确认申请及其链接
+func (s *UserService) clearEmailChange(ctx context.Context, userID uint) {
+	if s.deferred(func(s *UserService) { s.clearEmailChange(ctx, userID) }) {
+		return
+	}
+	rdb, err := s.sessionStore()
+	if err != nil {
+		return
+	}
+	data, err := rdb.Get(ctx, emailChangeKey(userID)).Result()
+	if err != nil {
+		return
+	}
+	var change emailChange
+	json.Unmarshal([]byte(data), &change)
+	rdb.Del(ctx, emailChangeKey(userID), emailChangeTokenKey(change.ConfirmToken), emailChangeTokenKey(change.CancelToken))
+}
+
+// ConfirmEmailChange 通过新邮箱收到的链接确认修改。申请后邮箱已被其它方式修改时申请作废，
+// 新邮箱在此期间被他人占用时返回 *common.ConflictError
+func (s *UserService) ConfirmEmailChange(token string) error {
+	ctx := context.Background()
+	change, err := s.loadEmailChange(ctx, token)
+	if err != nil {
+		return err
+	}
+	if change.ConfirmToken != token {
+		return ErrInvalidEmailChangeToken
+	}
+
+	id := strconv.FormatUint(uint64(change.UserID), 10)
+	user, err := s.Repo.Primary().GetUserByID(id)
+	if err != nil {
+		s.clearEmailChange(ctx, change.UserID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidEmailChangeToken
+		}
+		return err
+	}
+	if user.Email != change.OldEmail {
+		s.clearEmailChange(ctx, change.UserID)
+		return ErrInvalidEmailChangeToken
+	}
+
+	detail, _ := json.Marshal(map[string]string{"from": change.OldEmail, "to": change.NewEmail})
+	err = s.InTx(func(tx *UserService) error {
+		err := tx.Repo.UpdateUserByID(id, []uint{user.Version}, map[string]interface{}{
+			"email":        change.NewEmail,
+			"unique_email": change.NewEmail,
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Repo.CreateAuditLog(&models.AuditLog{
+			UserID:  user.ID,
+			ActorID: user.ID,
+			Action:  models.AuditEmailChange,
+			Detail:  string(detail),
+		})
+		if err != nil {
+			return err
+		}
+		tx.invalidateUser(id)
+		tx.reindexUser(id)
+		tx.clearEmailChange(ctx, change.UserID)
+		return nil
+	})
+	if errors.Is(err, dao.ErrVersionConflict) {
+		return ErrPreconditionFailed
+	}
+	return err
+}
+
+// CancelEmailChange 通过旧邮箱收到的链接撤销修改申请
+func (s *UserService) CancelEmailChange(token string) error {
+	ctx := context.Background()
+	change, err := s.loadEmailChange(ctx, token)
+	if err != nil {
+		return err
+	}
+	if change.CancelToken != token {
+		return ErrInvalidEmailChangeToken
+	}
+	s.clearEmailChange(ctx, change.UserID)
+	common.Logger.Info("修改邮箱申请已撤销", zap.Uint("user_id", change.UserID))
+	return nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"gin-crud/dao"
+	"gin-crud/mail"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeMailer 记录发送的邮件
+type fakeMailer struct {
+	sent []mail.Message
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var tokenPattern = regexp.MustCompile(`token=([0-9a-f]+)`)
+
+func TestUserService_EmailChange(t *testing.T) {
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+	rdb, mr := mockRedis(t)
+	mailer := &fakeMailer{}
+	userService := &UserService{Repo: dao.NewGormRepository(db), RDB: rdb, Mailer: mailer}
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	userRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "username", "email", "password", "version"}).
+			AddRow(7, "alice", "old@example.com", string(hash), 2)
+	}
+
+	mock.ExpectQuery("^SELECT \\* FROM `users` WHERE `users`.`id` = \\?").WillReturnRows(userRows())
+	mock.ExpectQuery("^SELECT `email` FROM `users` WHERE email IN \\(\\?\\)").
+		WithArgs("new@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"email"}))
+
+	_, err = userService.RequestEmailChange("7", "New@Example.com", "secret")
+	if !assert.NoError(t, err) || !assert.Len(t, mailer.sent, 2) {
+		return
+	}
+	assert.Equal(t, "new@example.com", mailer.sent[0].To)
+	assert.Equal(t, "old@example.com", mailer.sent[1].To)
+	confirmToken := tokenPattern.FindStringSubmatch(mailer.sent[0].Body)[1]
+	cancelToken := tokenPattern.FindStringSubmatch(mailer.sent[1].Body)[1]
+
+	// 撤销链接不能用于确认
+	assert.ErrorIs(t, userService.ConfirmEmailChange(cancelToken), ErrInvalidEmailChangeToken)
+
+	mock.ExpectQuery("^SELECT \\* FROM `users` WHERE `users`.`id` = \\?").WillReturnRows(userRows())
+	mock.ExpectBegin()
+	mock.ExpectExec("^UPDATE `users` SET `email`=\\?,`unique_email`=\\?,`version`=version \\+ 1").
+		WithArgs("new@example.com", "new@example.com", sqlmock.AnyArg(), "7", 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^INSERT INTO `audit_logs`").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, userService.ConfirmEmailChange(confirmToken))
+	// 确认后链接全部失效
+	assert.ErrorIs(t, userService.ConfirmEmailChange(confirmToken), ErrInvalidEmailChangeToken)
+	assert.ErrorIs(t, userService.CancelEmailChange(cancelToken), ErrInvalidEmailChangeToken)
+
+	// 申请过期后无法确认
+	mock.ExpectQuery("^SELECT \\* FROM `users` WHERE `users`.`id` = \\?").WillReturnRows(userRows())
+	mock.ExpectQuery("^SELECT `email` FROM `users`").WillReturnRows(sqlmock.NewRows([]string{"email"}))
+	_, err = userService.RequestEmailChange("7", "other@example.com", "secret")
+	assert.NoError(t, err)
+	mr.FastForward(25 * time.Hour)
+	token := tokenPattern.FindStringSubmatch(mailer.sent[2].Body)[1]
+	assert.ErrorIs(t, userService.ConfirmEmailChange(token), ErrInvalidEmailChangeToken)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
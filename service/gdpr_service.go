@@ -0,0 +1,370 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin-crud/common"
+	"gin-crud/models"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 数据导出任务状态
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+)
+
+// DataExportJob 数据主体导出任务，保存在 Redis 中
+type DataExportJob struct {
+	ID         string     `json:"id"`
+	UserID     uint       `json:"user_id"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// dataSection ZIP 中的一个文件，Blob 非空时直接复制对象存储中的文件，否则将 Data 编码为 JSON
+type dataSection struct {
+	Name string
+	Data interface{}
+	Blob string
+}
+
+func exportJobKey(jobID string) string {
+	return "data_export:" + jobID
+}
+
+func exportTTL() time.Duration {
+	hours := common.Conf.Gdpr.ExportTTLHours
+	if hours <= 0 {
+		hours = 72
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+func exportDir() string {
+	if dir := common.Conf.Gdpr.ExportDir; dir != "" {
+		return dir
+	}
+	return "./storage/exports"
+}
+
+// StartDataExport 创建数据导出任务并在后台生成 ZIP，包含已软删除的用户
+func (s *UserService) StartDataExport(id string, actorID uint) (*DataExportJob, error) {
+	user, err := s.Repo.GetUserByIDUnscoped(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("用户不存在")
+		}
+		return nil, err
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	job := &DataExportJob{
+		ID:        hex.EncodeToString(b),
+		UserID:    user.ID,
+		Status:    ExportPending,
+		CreatedAt: time.Now(),
+	}
+	if err := s.saveExportJob(job); err != nil {
+		return nil, err
+	}
+
+	detail, _ := json.Marshal(map[string]string{"job_id": job.ID})
+	if err := s.Repo.CreateAuditLog(&models.AuditLog{
+		UserID: user.ID, ActorID: actorID, Action: models.AuditDataExport, Detail: string(detail),
+	}); err != nil {
+		common.Logger.Error("写入审计记录失败", zap.Error(err))
+	}
+
+	go s.runDataExport(*job)
+	return job, nil
+}
+
+// GetDataExport 查询导出任务
+func (s *UserService) GetDataExport(jobID string) (*DataExportJob, error) {
+	rdb, err := s.sessionStore()
+	if err != nil {
+		return nil, err
+	}
+	val, err := rdb.Get(context.Background(), exportJobKey(jobID)).Result()
+	if err == redis.Nil {
+		return nil, errors.New("导出任务不存在或已过期")
+	}
+	if err != nil {
+		return nil, sessionError(err)
+	}
+	var job DataExportJob
+	if err := json.Unmarshal([]byte(val), &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// DataExportFile 返回已完成任务的 ZIP 文件路径
+func (s *UserService) DataExportFile(jobID string) (string, error) {
+	job, err := s.GetDataExport(jobID)
+	if err != nil {
+		return "", err
+	}
+	if job.Status != ExportDone {
+		return "", errors.New("导出尚未完成")
+	}
+	return filepath.Join(exportDir(), job.ID+".zip"), nil
+}
+
+func (s *UserService) saveExportJob(job *DataExportJob) error {
+	rdb, err := s.sessionStore()
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(job)
+	return sessionError(rdb.Set(context.Background(), exportJobKey(job.ID), data, exportTTL()).Err())
+}
+
+// runDataExport 生成 ZIP 并更新任务状态，先写临时文件再重命名，避免下载到不完整的文件
+func (s *UserService) runDataExport(job DataExportJob) {
+	job.Status = ExportRunning
+	s.saveExportJob(&job)
+
+	err := s.writeDataExport(job)
+	now := time.Now()
+	job.FinishedAt = &now
+	if err != nil {
+		common.Logger.Error("数据导出失败", zap.String("job_id", job.ID), zap.Error(err))
+		job.Status = ExportFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = ExportDone
+	}
+	if err := s.saveExportJob(&job); err != nil {
+		common.Logger.Error("保存导出任务状态失败", zap.String("job_id", job.ID), zap.Error(err))
+	}
+}
+
+func (s *UserService) writeDataExport(job DataExportJob) error {
+	user, err := s.Repo.GetUserByIDUnscoped(fmt.Sprintf("%d", job.UserID))
+	if err != nil {
+		return err
+	}
+	sections, err := s.collectUserData(user)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(exportDir(), 0o700); err != nil {
+		return err
+	}
+	path := filepath.Join(exportDir(), job.ID+".zip")
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	zw := zip.NewWriter(f)
+	names := make([]string, 0, len(sections))
+	for _, section := range sections {
+		w, err := zw.Create(section.Name)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if err := s.writeSection(w, section); err != nil {
+			f.Close()
+			return err
+		}
+		names = append(names, section.Name)
+	}
+	w, err := zw.Create("manifest.json")
+	if err != nil {
+		f.Close()
+		return err
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":      job.UserID,
+		"job_id":       job.ID,
+		"generated_at": time.Now(),
+		"files":        names,
+	})
+
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *UserService) writeSection(w io.Writer, section dataSection) error {
+	if section.Blob == "" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(section.Data)
+	}
+	r, err := s.Blobs.Get(context.Background(), section.Blob)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// collectUserData 收集与用户相关的全部数据，每个部分对应 ZIP 中的一个文件。
+// 新增与用户关联的数据时需要在这里补充
+func (s *UserService) collectUserData(user *models.User) ([]dataSection, error) {
+	// 个人资料：不导出密码哈希
+	raw, _ := json.Marshal(user)
+	var profile map[string]interface{}
+	json.Unmarshal(raw, &profile)
+	delete(profile, "password")
+
+	sessions, err := s.ListSessions(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := s.Repo.ListAllAuditLogsOf(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	memberships, err := s.Repo.ListMembershipsOfUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	sections := []dataSection{
+		{Name: "profile.json", Data: profile},
+		{Name: "sessions.json", Data: sessions},
+		{Name: "audit_logs.json", Data: logs},
+		{Name: "groups.json", Data: memberships},
+	}
+	// 待确认的邮箱修改申请，不导出链接 token
+	rdb, err := s.sessionStore()
+	if err != nil {
+		return nil, err
+	}
+	if data, err := rdb.Get(context.Background(), emailChangeKey(user.ID)).Result(); err == nil {
+		var change emailChange
+		if json.Unmarshal([]byte(data), &change) == nil {
+			sections = append(sections, dataSection{Name: "email_change.json", Data: map[string]interface{}{
+				"old_email":  change.OldEmail,
+				"new_email":  change.NewEmail,
+				"expires_at": change.ExpiresAt,
+			}})
+		}
+	}
+	// 头像只导出原图，缩略图由原图生成
+	if user.Avatar != "" && s.Blobs != nil {
+		sections = append(sections, dataSection{Name: "avatar.jpg", Blob: avatarKey(user.Avatar, 0)})
+	}
+	return sections, nil
+}
+
+// CleanupExpiredExports 删除超过保留时长的导出文件，返回删除数量
+func (s *UserService) CleanupExpiredExports() (int, error) {
+	entries, err := os.ReadDir(exportDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	deadline := time.Now().Add(-exportTTL())
+	n := 0
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || info.ModTime().After(deadline) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(exportDir(), entry.Name())); err == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// piiAuditActions 详情中记录了用户个人信息（如修改前后的邮箱）的审计动作，匿名化时清空这些记录的详情。
+// 新增在详情中记录个人信息的审计动作时需要在这里补充
+var piiAuditActions = []string{models.AuditEmailChange}
+
+// EraseUser 按数据主体请求匿名化用户：原地覆盖个人信息而不是删除行，
+// 保留 ID 使审计记录等关联数据的引用仍然有效；同时清除缓存并注销所有会话
+func (s *UserService) EraseUser(id string, actorID uint) error {
+	user, err := s.Repo.Primary().GetUserByIDUnscoped(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("用户不存在")
+		}
+		return err
+	}
+	if user.ErasedAt != nil {
+		return errors.New("用户已匿名化")
+	}
+
+	now := time.Now()
+	username := fmt.Sprintf("erased-%d", user.ID)
+	email := fmt.Sprintf("erased-%d@invalid", user.ID)
+	data := map[string]interface{}{
+		"username":              username,
+		"email":                 email,
+		"password":              "", // 空哈希无法通过校验，账号不可再登录
+		"status":                models.StatusBanned,
+		"status_reason":         "erased",
+		"status_expires_at":     nil,
+		"deletion_scheduled_at": nil,
+		"erased_at":             now,
+		"avatar":                "",
+		"attributes":            nil, // 自定义属性可能包含手机号等个人信息
+	}
+	// 未删除的用户同步更新唯一键；已软删除用户的唯一键本就为空
+	if !user.DeletedAt.Valid {
+		data["unique_username"] = username
+		data["unique_email"] = email
+	}
+
+	return s.InTx(func(tx *UserService) error {
+		if err := tx.Repo.AnonymizeUserByID(id, data); err != nil {
+			return err
+		}
+		if err := tx.Repo.AnonymizeInvitations(user.ID, user.Email, email); err != nil {
+			return err
+		}
+		if err := tx.Repo.RedactAuditLogs(user.ID, piiAuditActions); err != nil {
+			return err
+		}
+		err := tx.Repo.CreateAuditLog(&models.AuditLog{UserID: user.ID, ActorID: actorID, Action: models.AuditErase})
+		if err != nil {
+			return err
+		}
+		// 头像文件删除后无法恢复，与其它副作用一样等事务提交后执行
+		tx.invalidateUser(id)
+		tx.reindexUser(id)
+		tx.deleteAvatarBlobs(user.Avatar)
+		tx.clearEmailChange(context.Background(), user.ID)
+		tx.RevokeSessions(user.ID, "")
+		return nil
+	})
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"gin-crud/common"
+	"gin-crud/dao"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserService_WriteDataExport(t *testing.T) {
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+	rdb, mr := mockRedis(t)
+	userService := &UserService{Repo: dao.NewGormRepository(db), RDB: rdb}
+
+	dir := t.TempDir()
+	common.Conf.Gdpr.ExportDir = dir
+	defer func() { common.Conf.Gdpr.ExportDir = "" }()
+
+	mr.SAdd(sessionsKey(5), "token-a", "token-expired")
+	mr.Set("refresh_token:token-a", "5")
+	mr.SetTTL("refresh_token:token-a", time.Hour)
+
+	mock.ExpectQuery("^SELECT \\* FROM `users` WHERE `users`.`id` = \\?").
+		WithArgs("5", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "password"}).
+			AddRow(5, "tester", "tester@example.com", "$2a$10$hash"))
+	mock.ExpectQuery("^SELECT \\* FROM `audit_logs` WHERE user_id = \\? OR actor_id = \\?").
+		WithArgs(5, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "action"}).AddRow(1, 5, "status_change"))
+	mock.ExpectQuery("^SELECT \\* FROM `group_members` WHERE user_id = \\?").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"group_id", "user_id", "role"}).AddRow(2, 5, "member"))
+
+	err = userService.writeDataExport(DataExportJob{ID: "job1", UserID: 5})
+	assert.NoError(t, err)
+
+	zr, err := zip.OpenReader(filepath.Join(dir, "job1.zip"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer zr.Close()
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	assert.Len(t, files, 5)
+
+	rc, _ := files["profile.json"].Open()
+	var profile map[string]interface{}
+	json.NewDecoder(rc).Decode(&profile)
+	rc.Close()
+	assert.Equal(t, "tester", profile["username"])
+	assert.NotContains(t, profile, "password")
+
+	rc, _ = files["sessions.json"].Open()
+	var sessions []SessionInfo
+	json.NewDecoder(rc).Decode(&sessions)
+	rc.Close()
+	if assert.Len(t, sessions, 1) {
+		assert.Equal(t, SessionID("token-a"), sessions[0].SessionID)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
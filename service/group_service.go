@@ -0,0 +1,377 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gin-crud/cache"
+	"gin-crud/models"
+	"sort"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// EffectiveGroups 用户实际所属的组（直接加入的组及其全部上级组）和由此获得的权限
+type EffectiveGroups struct {
+	GroupIDs    []uint   `json:"group_ids"`
+	Permissions []string `json:"permissions"`
+}
+
+// groupsGenKey 组结构版本号。组的层级或权限变化会影响大量用户，
+// 递增版本号使所有用户的有效组缓存一次性失效，而不需要逐个删除
+const groupsGenKey = "groups_gen"
+
+func effectiveGroupsKey(userID uint, gen int64) string {
+	return fmt.Sprintf("user_groups:%d:%d", userID, gen)
+}
+
+// groupsGen 读取组结构版本号，未设置时为 0；ok 为 false 表示无法确定版本号，此时不应使用缓存
+func (s *UserService) groupsGen(ctx context.Context) (gen int64, ok bool) {
+	val, err := s.store().Get(ctx, groupsGenKey)
+	if errors.Is(err, cache.ErrMiss) {
+		return 0, true
+	}
+	if err == nil {
+		gen, err = strconv.ParseInt(string(val), 10, 64)
+	}
+	if err != nil {
+		logCacheError("读取组缓存版本失败", err)
+		return 0, false
+	}
+	return gen, true
+}
+
+// bumpGroupsGen 使所有用户的有效组缓存失效
+func (s *UserService) bumpGroupsGen() {
+	if s.deferred(func(s *UserService) { s.bumpGroupsGen() }) {
+		return
+	}
+	_, err := s.store().Incr(context.Background(), groupsGenKey)
+	logCacheError("更新组缓存版本失败", err)
+}
+
+// invalidateUserGroups 清除单个用户的有效组缓存
+func (s *UserService) invalidateUserGroups(userID uint) {
+	if s.deferred(func(s *UserService) { s.invalidateUserGroups(userID) }) {
+		return
+	}
+	ctx := context.Background()
+	if gen, ok := s.groupsGen(ctx); ok {
+		s.evictCache(ctx, effectiveGroupsKey(userID, gen))
+	}
+}
+
+// withAncestors 返回给定组及其全部上级组，每层一次查询
+func (s *UserService) withAncestors(ids []uint) ([]uint, error) {
+	seen := make(map[uint]bool, len(ids))
+	all := make([]uint, 0, len(ids))
+	frontier := ids
+	for len(frontier) > 0 {
+		next := make([]uint, 0)
+		for _, id := range frontier {
+			if !seen[id] {
+				seen[id] = true
+				all = append(all, id)
+				next = append(next, id)
+			}
+		}
+		if len(next) == 0 {
+			break
+		}
+		parents, err := s.Repo.FindParentGroupIDs(next)
+		if err != nil {
+			return nil, err
+		}
+		frontier = parents
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	return all, nil
+}
+
+// EffectiveGroups 获取用户的有效组和权限 (带缓存)
+func (s *UserService) EffectiveGroups(userID uint) (*EffectiveGroups, error) {
+	load := func() (*EffectiveGroups, bool, error) {
+		primary := s.Primary()
+		direct, err := primary.Repo.FindMemberGroupIDs(userID, "")
+		if err != nil {
+			return nil, false, err
+		}
+		ids, err := primary.withAncestors(direct)
+		if err != nil {
+			return nil, false, err
+		}
+		perms, err := primary.Repo.FindPermissionsOfGroups(ids)
+		if err != nil {
+			return nil, false, err
+		}
+		return &EffectiveGroups{GroupIDs: ids, Permissions: perms}, true, nil
+	}
+
+	gen, ok := s.groupsGen(context.Background())
+	if !ok {
+		eg, _, err := load()
+		return eg, err
+	}
+	eg, _, err := fetchCached(s, "user_groups", effectiveGroupsKey(userID, gen), load)
+	return eg, err
+}
+
+// HasPermission 判断用户是否通过所属组获得了指定权限
+func (s *UserService) HasPermission(userID uint, permission string) (bool, error) {
+	eg, err := s.EffectiveGroups(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range eg.Permissions {
+		if p == permission {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CanManageGroup 管理员、本组或任一上级组的 owner 可以管理组成员
+func (s *UserService) CanManageGroup(user *models.User, groupID uint) (bool, error) {
+	if user.Role == models.RoleAdmin {
+		return true, nil
+	}
+	owned, err := s.Repo.FindMemberGroupIDs(user.ID, models.GroupRoleOwner)
+	if err != nil || len(owned) == 0 {
+		return false, err
+	}
+	ids, err := s.withAncestors([]uint{groupID})
+	if err != nil {
+		return false, err
+	}
+	for _, id := range ids {
+		for _, o := range owned {
+			if id == o {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// getGroup 查询组，不存在时返回统一的错误
+func (s *UserService) getGroup(id string) (*models.Group, error) {
+	group, err := s.Repo.GetGroupByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("组不存在")
+		}
+		return nil, err
+	}
+	return group, nil
+}
+
+// GetGroup 获取组
+func (s *UserService) GetGroup(id string) (*models.Group, error) {
+	return s.getGroup(id)
+}
+
+// ListGroups 获取全部组
+func (s *UserService) ListGroups() ([]models.Group, error) {
+	return s.Repo.ListGroups()
+}
+
+// checkParent 校验上级组存在且不会形成环
+func (s *UserService) checkParent(groupID uint, parentID *uint) error {
+	if parentID == nil {
+		return nil
+	}
+	if _, err := s.getGroup(strconv.FormatUint(uint64(*parentID), 10)); err != nil {
+		if err.Error() == "组不存在" {
+			return errors.New("上级组不存在")
+		}
+		return err
+	}
+	if groupID == 0 {
+		return nil
+	}
+	ancestors, err := s.withAncestors([]uint{*parentID})
+	if err != nil {
+		return err
+	}
+	for _, id := range ancestors {
+		if id == groupID {
+			return errors.New("不能将组移动到自身或其子组下")
+		}
+	}
+	return nil
+}
+
+// CreateGroup 创建组，组名冲突时返回 *common.ConflictError
+func (s *UserService) CreateGroup(group *models.Group) error {
+	group.ID = 0
+	if err := s.checkParent(0, group.ParentID); err != nil {
+		return err
+	}
+	return s.Repo.CreateGroup(group)
+}
+
+// UpdateGroup 修改组名、描述或上级组，修改上级组会使所有用户的有效组缓存失效
+func (s *UserService) UpdateGroup(id string, data map[string]interface{}) error {
+	group, err := s.getGroup(id)
+	if err != nil {
+		return err
+	}
+	updateData := make(map[string]interface{})
+	for _, field := range []string{"name", "description"} {
+		if v, ok := data[field]; ok {
+			updateData[field] = v
+		}
+	}
+	parentChanged := false
+	if v, ok := data["parent_id"]; ok {
+		var parentID *uint
+		if v != nil {
+			f, ok := v.(float64)
+			if !ok || f <= 0 {
+				return errors.New("上级组不存在")
+			}
+			p := uint(f)
+			parentID = &p
+		}
+		if err := s.checkParent(group.ID, parentID); err != nil {
+			return err
+		}
+		updateData["parent_id"] = parentID
+		parentChanged = true
+	}
+	if len(updateData) == 0 {
+		return errors.New("没有可更新的字段")
+	}
+
+	if err := s.Repo.UpdateGroupByID(id, updateData); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("组不存在")
+		}
+		return err
+	}
+	if parentChanged {
+		s.bumpGroupsGen()
+	}
+	return nil
+}
+
+// DeleteGroup 删除组，存在子组时需先删除或移走子组
+func (s *UserService) DeleteGroup(id string) error {
+	group, err := s.getGroup(id)
+	if err != nil {
+		return err
+	}
+	children, err := s.Repo.CountChildGroups(group.ID)
+	if err != nil {
+		return err
+	}
+	if children > 0 {
+		return errors.New("请先删除或移走子组")
+	}
+	if err := s.Repo.DeleteGroupByID(group.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("组不存在")
+		}
+		return err
+	}
+	s.bumpGroupsGen()
+	return nil
+}
+
+// ListGroupMembers 获取组的直接成员
+func (s *UserService) ListGroupMembers(id string) ([]models.GroupMember, error) {
+	group, err := s.getGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.Repo.ListGroupMembers(group.ID)
+}
+
+// AddGroupMember 添加成员或修改成员角色
+func (s *UserService) AddGroupMember(groupID, userID, role string) error {
+	if role == "" {
+		role = models.GroupRoleMember
+	}
+	if role != models.GroupRoleMember && role != models.GroupRoleOwner {
+		return errors.New("无效的组内角色")
+	}
+	group, err := s.getGroup(groupID)
+	if err != nil {
+		return err
+	}
+	user, err := s.Repo.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("用户不存在")
+		}
+		return err
+	}
+
+	if err := s.Repo.UpsertGroupMember(&models.GroupMember{GroupID: group.ID, UserID: user.ID, Role: role}); err != nil {
+		return err
+	}
+	s.invalidateUserGroups(user.ID)
+	return nil
+}
+
+// RemoveGroupMember 移除成员
+func (s *UserService) RemoveGroupMember(groupID, userID string) error {
+	group, err := s.getGroup(groupID)
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.ParseUint(userID, 10, 64)
+	if err != nil {
+		return errors.New("不是该组成员")
+	}
+	if err := s.Repo.DeleteGroupMember(group.ID, uint(uid)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("不是该组成员")
+		}
+		return err
+	}
+	s.invalidateUserGroups(uint(uid))
+	return nil
+}
+
+// ListGroupPermissions 获取组直接拥有的权限
+func (s *UserService) ListGroupPermissions(id string) ([]string, error) {
+	group, err := s.getGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.Repo.ListGroupPermissions(group.ID)
+}
+
+// GrantGroupPermission 授予组权限
+func (s *UserService) GrantGroupPermission(id, permission string) error {
+	group, err := s.getGroup(id)
+	if err != nil {
+		return err
+	}
+	if permission == "" || len(permission) > 100 {
+		return errors.New("无效的权限名")
+	}
+	if err := s.Repo.AddGroupPermission(&models.GroupPermission{GroupID: group.ID, Permission: permission}); err != nil {
+		return err
+	}
+	s.bumpGroupsGen()
+	return nil
+}
+
+// RevokeGroupPermission 收回组权限
+func (s *UserService) RevokeGroupPermission(id, permission string) error {
+	group, err := s.getGroup(id)
+	if err != nil {
+		return err
+	}
+	if err := s.Repo.RemoveGroupPermission(group.ID, permission); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("组没有该权限")
+		}
+		return err
+	}
+	s.bumpGroupsGen()
+	return nil
+}
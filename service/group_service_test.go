@@ -0,0 +1,91 @@
+package service
+
+import (
+	"gin-crud/cache"
+	"gin-crud/dao"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserService_EffectiveGroups(t *testing.T) {
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+	rdb, mr := mockRedis(t)
+	userService := &UserService{Repo: dao.NewGormRepository(db), RDB: rdb, Cache: cache.NewRedis(rdb)}
+
+	// 用户直接属于组 3，组 3 的上级是 2，组 2 的上级是 1
+	expectResolve := func() {
+		mock.ExpectQuery("^SELECT `group_id` FROM `group_members` WHERE user_id = \\?").
+			WithArgs(9).
+			WillReturnRows(sqlmock.NewRows([]string{"group_id"}).AddRow(3))
+		mock.ExpectQuery("^SELECT DISTINCT `parent_id` FROM `groups` WHERE id IN \\(\\?\\) AND parent_id IS NOT NULL").
+			WithArgs(3).
+			WillReturnRows(sqlmock.NewRows([]string{"parent_id"}).AddRow(2))
+		mock.ExpectQuery("^SELECT DISTINCT `parent_id` FROM `groups`").
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"parent_id"}).AddRow(1))
+		mock.ExpectQuery("^SELECT DISTINCT `parent_id` FROM `groups`").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"parent_id"}))
+		mock.ExpectQuery("^SELECT DISTINCT `permission` FROM `group_permissions` WHERE group_id IN \\(\\?,\\?,\\?\\)").
+			WithArgs(1, 2, 3).
+			WillReturnRows(sqlmock.NewRows([]string{"permission"}).AddRow("report:read"))
+	}
+
+	expectResolve()
+	eg, err := userService.EffectiveGroups(9)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []uint{1, 2, 3}, eg.GroupIDs)
+		assert.Equal(t, []string{"report:read"}, eg.Permissions)
+	}
+	assert.True(t, mr.Exists("user_groups:9:0"))
+
+	// 命中缓存，不再查库
+	ok, err := userService.HasPermission(9, "report:read")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// 组结构变化后版本号递增，旧缓存不再使用
+	userService.bumpGroupsGen()
+	expectResolve()
+	_, err = userService.EffectiveGroups(9)
+	assert.NoError(t, err)
+	assert.True(t, mr.Exists("user_groups:9:1"))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserService_UpdateGroupRejectsCycle(t *testing.T) {
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+	rdb, _ := mockRedis(t)
+	userService := &UserService{Repo: dao.NewGormRepository(db), RDB: rdb, Cache: cache.NewRedis(rdb)}
+
+	groupRow := func(id int) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "name"}).AddRow(id, "g")
+	}
+	// 把组 1 移到组 3 下，而组 3 是组 1 的子孙
+	mock.ExpectQuery("^SELECT \\* FROM `groups` WHERE `groups`.`id` = \\?").WithArgs("1", 1).WillReturnRows(groupRow(1))
+	mock.ExpectQuery("^SELECT \\* FROM `groups` WHERE `groups`.`id` = \\?").WithArgs("3", 1).WillReturnRows(groupRow(3))
+	mock.ExpectQuery("^SELECT DISTINCT `parent_id` FROM `groups`").WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"parent_id"}).AddRow(2))
+	mock.ExpectQuery("^SELECT DISTINCT `parent_id` FROM `groups`").WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"parent_id"}).AddRow(1))
+	mock.ExpectQuery("^SELECT DISTINCT `parent_id` FROM `groups`").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"parent_id"}))
+
+	err = userService.UpdateGroup("1", map[string]interface{}{"parent_id": float64(3)})
+	assert.EqualError(t, err, "不能将组移动到自身或其子组下")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
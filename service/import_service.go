@@ -0,0 +1,354 @@
+package service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin-crud/models"
+	"io"
+	"net/mail"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 批量导入导出支持的格式
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// defaultImportChunkSize 每个事务写入的行数
+const defaultImportChunkSize = 100
+
+// ImportOptions 批量导入选项
+type ImportOptions struct {
+	Format    string // csv 或 jsonl
+	DryRun    bool   // 只校验不写入
+	PreHashed bool   // password 列已是 bcrypt 哈希
+	ChunkSize int    // 每个事务写入的行数
+}
+
+// ImportRowError 单行校验或写入错误
+type ImportRowError struct {
+	Line     int    `json:"line"`
+	Username string `json:"username,omitempty"`
+	Message  string `json:"message"`
+}
+
+// ImportResult 批量导入结果
+type ImportResult struct {
+	DryRun   bool             `json:"dry_run"`
+	Total    int              `json:"total"`    // 读取到的数据行数
+	Valid    int              `json:"valid"`    // 校验通过的行数
+	Imported int              `json:"imported"` // 实际写入的行数
+	Errors   []ImportRowError `json:"errors"`
+}
+
+// ExportUser 导出的用户字段（不包含密码哈希）
+type ExportUser struct {
+	ID        string    `json:"id"` // 公开 ID
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// importRow 导入文件中的一行
+type importRow struct {
+	Line     int    `json:"-"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// ImportUsers 从 CSV / JSONL 批量导入用户
+// 先逐行校验并检查用户名冲突，再按 ChunkSize 分块在事务中写入，单块失败只回滚该块
+func (s *UserService) ImportUsers(r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	rows, rowErrs, err := parseImportRows(r, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{DryRun: opts.DryRun, Total: len(rows) + len(rowErrs), Errors: rowErrs}
+
+	// 1. 逐行规范化并校验，同时检查文件内部的重复用户名和邮箱
+	seenUsernames := make(map[string]int)
+	seenEmails := make(map[string]int)
+	var valid []importRow
+	for _, row := range rows {
+		if msg := validateImportRow(row, opts.PreHashed); msg != "" {
+			result.Errors = append(result.Errors, ImportRowError{Line: row.Line, Username: row.Username, Message: msg})
+			continue
+		}
+		row.Username = models.NormalizeUsername(row.Username)
+		row.Email = models.NormalizeEmail(row.Email)
+		if line, ok := seenUsernames[row.Username]; ok {
+			result.Errors = append(result.Errors, ImportRowError{
+				Line: row.Line, Username: row.Username, Message: fmt.Sprintf("用户名与第 %d 行重复", line),
+			})
+			continue
+		}
+		if line, ok := seenEmails[row.Email]; ok {
+			result.Errors = append(result.Errors, ImportRowError{
+				Line: row.Line, Username: row.Username, Message: fmt.Sprintf("邮箱与第 %d 行重复", line),
+			})
+			continue
+		}
+		seenUsernames[row.Username] = row.Line
+		seenEmails[row.Email] = row.Line
+		valid = append(valid, row)
+	}
+
+	// 2. 检查数据库中已存在的用户名和邮箱
+	names := make([]string, 0, len(valid))
+	emails := make([]string, 0, len(valid))
+	for _, row := range valid {
+		names = append(names, row.Username)
+		emails = append(emails, row.Email)
+	}
+	existingNames, err := s.Repo.FindExistingValues("username", names)
+	if err != nil {
+		return nil, err
+	}
+	existingEmails, err := s.Repo.FindExistingValues("email", emails)
+	if err != nil {
+		return nil, err
+	}
+	rows = valid[:0]
+	for _, row := range valid {
+		if existingNames[row.Username] {
+			result.Errors = append(result.Errors, ImportRowError{Line: row.Line, Username: row.Username, Message: "用户名已存在"})
+			continue
+		}
+		if existingEmails[row.Email] {
+			result.Errors = append(result.Errors, ImportRowError{Line: row.Line, Username: row.Username, Message: "邮箱已存在"})
+			continue
+		}
+		rows = append(rows, row)
+	}
+	result.Valid = len(rows)
+
+	if opts.DryRun {
+		return result, nil
+	}
+
+	// 3. 分块事务写入
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultImportChunkSize
+	}
+	for start := 0; start < len(rows); start += chunkSize {
+		end := start + chunkSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		chunk := rows[start:end]
+
+		users := make([]*models.User, 0, len(chunk))
+		for _, row := range chunk {
+			users = append(users, &models.User{
+				Username:       row.Username,
+				Email:          row.Email,
+				Password:       row.Password,
+				Role:           row.Role,
+				PasswordHashed: opts.PreHashed,
+			})
+		}
+		if err := s.Repo.CreateUsers(users); err != nil {
+			for _, row := range chunk {
+				result.Errors = append(result.Errors, ImportRowError{
+					Line: row.Line, Username: row.Username, Message: "写入失败，所在批次已回滚: " + err.Error(),
+				})
+			}
+			continue
+		}
+		for _, u := range users {
+			s.indexUser(u)
+		}
+		result.Imported += len(chunk)
+	}
+
+	return result, nil
+}
+
+// ExportUsers 以 CSV / JSONL 格式流式导出全部用户（不包含密码哈希）
+func (s *UserService) ExportUsers(w io.Writer, format string) error {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"id", "username", "email", "role", "created_at", "updated_at"}); err != nil {
+			return err
+		}
+		err := s.Repo.EachUserBatch(500, func(users []models.User) error {
+			for _, u := range users {
+				record := []string{
+					u.PublicID, u.Username, u.Email, u.Role,
+					u.CreatedAt.Format(time.RFC3339), u.UpdatedAt.Format(time.RFC3339),
+				}
+				if err := cw.Write(record); err != nil {
+					return err
+				}
+			}
+			cw.Flush()
+			return cw.Error()
+		})
+		if err != nil {
+			return err
+		}
+		cw.Flush()
+		return cw.Error()
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		return s.Repo.EachUserBatch(500, func(users []models.User) error {
+			for _, u := range users {
+				if err := enc.Encode(toExportUser(u)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	default:
+		return errors.New("不支持的格式")
+	}
+}
+
+func toExportUser(u models.User) ExportUser {
+	return ExportUser{
+		ID:        u.PublicID,
+		Username:  u.Username,
+		Email:     u.Email,
+		Role:      u.Role,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+	}
+}
+
+// parseImportRows 解析导入文件，返回成功解析的行以及无法解析的行错误
+func parseImportRows(r io.Reader, format string) ([]importRow, []ImportRowError, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSVRows(r)
+	case FormatJSONL:
+		return parseJSONLRows(r)
+	default:
+		return nil, nil, errors.New("不支持的格式")
+	}
+}
+
+func parseCSVRows(r io.Reader) ([]importRow, []ImportRowError, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil, errors.New("文件为空")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("CSV 表头解析失败: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"username", "email", "password"} {
+		if _, ok := columns[name]; !ok {
+			return nil, nil, fmt.Errorf("CSV 缺少 %s 列", name)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var rows []importRow
+	var rowErrs []ImportRowError
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// 列数不一致只影响当前行，其它解析错误（如引号不闭合）无法继续
+			if errors.Is(err, csv.ErrFieldCount) {
+				line, _ := cr.FieldPos(0)
+				rowErrs = append(rowErrs, ImportRowError{Line: line, Message: "列数与表头不一致"})
+				continue
+			}
+			return nil, nil, fmt.Errorf("CSV 解析失败: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		rows = append(rows, importRow{
+			Line:     line,
+			Username: field(record, "username"),
+			Email:    field(record, "email"),
+			Password: field(record, "password"),
+			Role:     field(record, "role"),
+		})
+	}
+	return rows, rowErrs, nil
+}
+
+func parseJSONLRows(r io.Reader) ([]importRow, []ImportRowError, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var rows []importRow
+	var rowErrs []ImportRowError
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var row importRow
+		if err := json.Unmarshal([]byte(text), &row); err != nil {
+			rowErrs = append(rowErrs, ImportRowError{Line: line, Message: "JSON 解析失败: " + err.Error()})
+			continue
+		}
+		row.Line = line
+		row.Username = strings.TrimSpace(row.Username)
+		row.Email = strings.TrimSpace(row.Email)
+		row.Role = strings.TrimSpace(row.Role)
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("JSONL 读取失败: %w", err)
+	}
+	if line == 0 {
+		return nil, nil, errors.New("文件为空")
+	}
+	return rows, rowErrs, nil
+}
+
+// validateImportRow 校验单行数据，返回错误信息，通过时返回空串
+func validateImportRow(row importRow, preHashed bool) string {
+	if row.Username == "" {
+		return "用户名不能为空"
+	}
+	if addr, err := mail.ParseAddress(row.Email); err != nil || addr.Address != row.Email {
+		return "邮箱格式不正确"
+	}
+	if preHashed {
+		if _, err := bcrypt.Cost([]byte(row.Password)); err != nil {
+			return "密码不是有效的 bcrypt 哈希"
+		}
+	} else if len(row.Password) < 6 {
+		return "密码长度不能少于 6 位"
+	}
+	switch row.Role {
+	case "", models.RoleUser, models.RoleAdmin:
+	default:
+		return "角色无效"
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"gin-crud/dao"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseImportRows(t *testing.T) {
+	t.Run("CSV", func(t *testing.T) {
+		data := "Username,Email,Password\n" +
+			"alice,alice@example.com,secret1\n" +
+			"bob,bob@example.com\n" +
+			"carol, carol@example.com ,secret3\n"
+
+		rows, rowErrs, err := parseImportRows(strings.NewReader(data), FormatCSV)
+
+		assert.NoError(t, err)
+		if assert.Len(t, rows, 2) {
+			assert.Equal(t, 2, rows[0].Line)
+			assert.Equal(t, "carol", rows[1].Username)
+			assert.Equal(t, "carol@example.com", rows[1].Email)
+		}
+		if assert.Len(t, rowErrs, 1) {
+			assert.Equal(t, 3, rowErrs[0].Line)
+		}
+	})
+
+	t.Run("CSVMissingColumn", func(t *testing.T) {
+		_, _, err := parseImportRows(strings.NewReader("username,email\nalice,a@b.com\n"), FormatCSV)
+
+		assert.EqualError(t, err, "CSV 缺少 password 列")
+	})
+
+	t.Run("JSONL", func(t *testing.T) {
+		data := `{"username":"alice","email":"alice@example.com","password":"secret1"}` + "\n\n" +
+			`{"username":` + "\n" +
+			`{"username":"bob","email":"bob@example.com","password":"secret2","role":"admin"}` + "\n"
+
+		rows, rowErrs, err := parseImportRows(strings.NewReader(data), FormatJSONL)
+
+		assert.NoError(t, err)
+		if assert.Len(t, rows, 2) {
+			assert.Equal(t, 1, rows[0].Line)
+			assert.Equal(t, 4, rows[1].Line)
+			assert.Equal(t, "admin", rows[1].Role)
+		}
+		if assert.Len(t, rowErrs, 1) {
+			assert.Equal(t, 3, rowErrs[0].Line)
+		}
+	})
+}
+
+func TestValidateImportRow(t *testing.T) {
+	hash := "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"
+
+	assert.Equal(t, "", validateImportRow(importRow{Username: "a", Email: "a@b.com", Password: "secret1"}, false))
+	assert.Equal(t, "用户名不能为空", validateImportRow(importRow{Email: "a@b.com", Password: "secret1"}, false))
+	assert.Equal(t, "邮箱格式不正确", validateImportRow(importRow{Username: "a", Email: "A <a@b.com>", Password: "secret1"}, false))
+	assert.Equal(t, "密码长度不能少于 6 位", validateImportRow(importRow{Username: "a", Email: "a@b.com", Password: "123"}, false))
+	assert.Equal(t, "", validateImportRow(importRow{Username: "a", Email: "a@b.com", Password: hash}, true))
+	assert.Equal(t, "密码不是有效的 bcrypt 哈希", validateImportRow(importRow{Username: "a", Email: "a@b.com", Password: "secret1"}, true))
+	assert.Equal(t, "角色无效", validateImportRow(importRow{Username: "a", Email: "a@b.com", Password: "secret1", Role: "root"}, false))
+}
+
+func TestUserService_ImportUsersDryRun(t *testing.T) {
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+
+	userService := &UserService{Repo: dao.NewGormRepository(db)}
+
+	data := "username,email,password\n" +
+		"alice,alice@example.com,secret1\n" +
+		"bob,bob@example.com,secret2\n" +
+		"Alice,alice2@example.com,secret3\n" +
+		"carol,not-an-email,secret4\n" +
+		"dave,Alice@Example.com,secret5\n"
+
+	mock.ExpectQuery("^SELECT `username` FROM `users` WHERE username IN \\(\\?,\\?\\)").
+		WithArgs("alice", "bob").
+		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("bob"))
+	mock.ExpectQuery("^SELECT `email` FROM `users` WHERE email IN \\(\\?,\\?\\)").
+		WithArgs("alice@example.com", "bob@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"email"}))
+
+	result, err := userService.ImportUsers(strings.NewReader(data), ImportOptions{Format: FormatCSV, DryRun: true})
+
+	assert.NoError(t, err)
+	if assert.NotNil(t, result) {
+		assert.True(t, result.DryRun)
+		assert.Equal(t, 5, result.Total)
+		assert.Equal(t, 1, result.Valid)
+		assert.Equal(t, 0, result.Imported)
+		assert.Len(t, result.Errors, 4)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin-crud/common"
+	"gin-crud/mail"
+	"gin-crud/models"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrRegistrationClosed 配置为关闭注册，邀请也不可使用
+	ErrRegistrationClosed = errors.New("注册已关闭")
+	// ErrInviteOnly 配置为仅限受邀注册
+	ErrInviteOnly = errors.New("仅限受邀注册")
+	// ErrInvalidInvitation 邀请不存在、已使用、已撤销或已过期
+	ErrInvalidInvitation = errors.New("邀请无效或已过期")
+	// ErrInvitationForbidden 当前用户无权创建或撤销该邀请
+	ErrInvitationForbidden = errors.New("无权操作该邀请")
+)
+
+// registrationMode 当前的注册方式，未配置时为开放注册
+func registrationMode() string {
+	if mode := common.Conf.User.RegistrationMode; mode != "" {
+		return mode
+	}
+	return models.RegistrationOpen
+}
+
+// checkOpenRegistration 自助注册前检查注册方式，无法识别的配置按关闭处理
+func checkOpenRegistration() error {
+	switch registrationMode() {
+	case models.RegistrationOpen:
+		return nil
+	case models.RegistrationInvite:
+		return ErrInviteOnly
+	default:
+		return ErrRegistrationClosed
+	}
+}
+
+// invitationsAllowed 开放注册和仅限受邀注册时都可以使用邀请
+func invitationsAllowed() bool {
+	mode := registrationMode()
+	return mode == models.RegistrationOpen || mode == models.RegistrationInvite
+}
+
+func invitationTTL() time.Duration {
+	if n := common.Conf.User.InvitationTTL; n > 0 {
+		return time.Duration(n) * time.Hour
+	}
+	return 72 * time.Hour
+}
+
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func invitationLink(token string) string {
+	base := strings.TrimRight(common.Conf.Mail.LinkBaseURL, "/")
+	return fmt.Sprintf("%s/invitations/accept?token=%s", base, url.QueryEscape(token))
+}
+
+// InvitationRequest 创建邀请的参数
+type InvitationRequest struct {
+	Email     string     `json:"email" binding:"required,email"`
+	Role      string     `json:"role"`       // 为空时为普通用户，只有管理员可以邀请管理员
+	GroupID   *uint      `json:"group_id"`   // 接受后加入的组，非管理员必须指定自己管理的组
+	ExpiresAt *time.Time `json:"expires_at"` // 为空时使用配置的默认有效期
+}
+
+// CreateInvitation 创建邀请并把一次性链接发送到被邀请的邮箱。
+// 管理员可以邀请任意角色；组 owner 只能邀请普通用户加入自己管理的组
+func (s *UserService) CreateInvitation(inviter *models.User, req InvitationRequest) (*models.Invitation, error) {
+	if !invitationsAllowed() {
+		return nil, ErrRegistrationClosed
+	}
+	role := req.Role
+	if role == "" {
+		role = models.RoleUser
+	}
+	if role != models.RoleUser && role != models.RoleAdmin {
+		return nil, errors.New("无效的角色")
+	}
+
+	var group *models.Group
+	if req.GroupID != nil {
+		g, err := s.getGroup(strconv.FormatUint(uint64(*req.GroupID), 10))
+		if err != nil {
+			return nil, err
+		}
+		group = g
+	}
+	if inviter.Role != models.RoleAdmin {
+		if role != models.RoleUser || group == nil {
+			return nil, ErrInvitationForbidden
+		}
+		ok, err := s.CanManageGroup(inviter, group.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrInvitationForbidden
+		}
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(invitationTTL())
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(now) {
+			return nil, errors.New("过期时间必须晚于当前时间")
+		}
+		expiresAt = *req.ExpiresAt
+	}
+
+	email := models.NormalizeEmail(req.Email)
+	existing, err := s.Repo.FindExistingValues("email", []string{email})
+	if err != nil {
+		return nil, err
+	}
+	if existing[email] {
+		return nil, &common.ConflictError{Field: "email"}
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	inv := &models.Invitation{
+		TokenHash: hashInvitationToken(token),
+		Email:     email,
+		Role:      role,
+		GroupID:   req.GroupID,
+		InviterID: inviter.ID,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.Repo.CreateInvitation(inv); err != nil {
+		return nil, err
+	}
+
+	if err := s.sendInvitationMail(inviter, inv, group, token); err != nil {
+		// 邮件没有发出时 token 无人知晓，撤销邀请避免留下不可用的记录
+		s.Repo.RevokeInvitation(inv.ID, time.Now())
+		return nil, err
+	}
+	return inv, nil
+}
+
+func (s *UserService) sendInvitationMail(inviter *models.User, inv *models.Invitation, group *models.Group, token string) error {
+	if s.Mailer == nil {
+		return errors.New("未配置邮件发送")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	target := "本系统"
+	if group != nil {
+		target = "组「" + group.Name + "」"
+	}
+	msg := mail.Message{
+		To:      inv.Email,
+		Subject: "您收到一份注册邀请",
+		Body: fmt.Sprintf("您好：\n\n%s 邀请您加入%s。请在 %s 前打开以下链接设置用户名和密码，链接只能使用一次：\n%s\n\n如果您不认识邀请人，请忽略本邮件。\n",
+			inviter.Username, target, inv.ExpiresAt.Format("2006-01-02 15:04"), invitationLink(token)),
+	}
+	if err := s.Mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("发送邀请邮件失败: %w", err)
+	}
+	return nil
+}
+
+// pendingInvitation 根据 token 读取仍可使用的邀请
+func (s *UserService) pendingInvitation(token string) (*models.Invitation, error) {
+	if token == "" {
+		return nil, ErrInvalidInvitation
+	}
+	inv, err := s.Repo.GetInvitationByTokenHash(hashInvitationToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidInvitation
+		}
+		return nil, err
+	}
+	if !inv.Pending(time.Now()) {
+		return nil, ErrInvalidInvitation
+	}
+	return inv, nil
+}
+
+// GetInvitation 受邀人打开链接时查看邀请的邮箱、角色和有效期
+func (s *UserService) GetInvitation(token string) (*models.Invitation, error) {
+	return s.pendingInvitation(token)
+}
+
+// AcceptInvitation 使用邀请注册。邮箱和角色以邀请为准，受邀人只设置用户名、密码和自定义属性；
+// 创建用户、标记邀请已使用和加入组在同一事务中完成，同一邀请并发使用时只有一次成功
+func (s *UserService) AcceptInvitation(token string, user *models.User) error {
+	if !invitationsAllowed() {
+		return ErrRegistrationClosed
+	}
+	inv, err := s.pendingInvitation(token)
+	if err != nil {
+		return err
+	}
+
+	attrs, err := validateAttributes(nil, user.Attributes)
+	if err != nil {
+		return err
+	}
+	user.Attributes = attrs
+	user.Email = inv.Email
+	user.Role = inv.Role
+	user.Status = models.StatusActive
+	user.PublicID = ""
+
+	detail, _ := json.Marshal(map[string]interface{}{"invitation_id": inv.ID})
+	return s.InTx(func(tx *UserService) error {
+		if err := tx.Repo.InsertUser(user); err != nil {
+			return err
+		}
+		if err := tx.Repo.MarkInvitationAccepted(inv.ID, user.ID, time.Now()); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidInvitation
+			}
+			return err
+		}
+		if inv.GroupID != nil {
+			member := &models.GroupMember{GroupID: *inv.GroupID, UserID: user.ID, Role: models.GroupRoleMember}
+			if err := tx.Repo.UpsertGroupMember(member); err != nil {
+				return err
+			}
+			tx.invalidateUserGroups(user.ID)
+		}
+		err := tx.Repo.CreateAuditLog(&models.AuditLog{
+			UserID:  user.ID,
+			ActorID: inv.InviterID,
+			Action:  models.AuditInvite,
+			Detail:  string(detail),
+		})
+		if err != nil {
+			return err
+		}
+		tx.indexUser(user)
+		return nil
+	})
+}
+
+// ListInvitations 管理员查看全部邀请，其他用户只能查看自己发出的邀请
+func (s *UserService) ListInvitations(actor *models.User, page, size int) ([]models.Invitation, int64, error) {
+	inviterID := actor.ID
+	if actor.Role == models.RoleAdmin {
+		inviterID = 0
+	}
+	return s.Repo.ListInvitations(inviterID, page, size)
+}
+
+// RevokeInvitation 撤销尚未接受的邀请，管理员或邀请人可操作
+func (s *UserService) RevokeInvitation(actor *models.User, id string) error {
+	inv, err := s.Repo.GetInvitationByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("邀请不存在")
+		}
+		return err
+	}
+	if actor.Role != models.RoleAdmin && inv.InviterID != actor.ID {
+		return ErrInvitationForbidden
+	}
+	if err := s.Repo.RevokeInvitation(inv.ID, time.Now()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("邀请已被接受或撤销")
+		}
+		return err
+	}
+	common.Logger.Info("邀请已撤销", zap.Uint("invitation_id", inv.ID), zap.Uint("actor_id", actor.ID))
+	return nil
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"gin-crud/common"
+	"gin-crud/dao"
+	"gin-crud/models"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserService_RegistrationMode(t *testing.T) {
+	defer func(mode string) { common.Conf.User.RegistrationMode = mode }(common.Conf.User.RegistrationMode)
+	userService := &UserService{}
+
+	common.Conf.User.RegistrationMode = models.RegistrationInvite
+	assert.ErrorIs(t, userService.Register(&models.User{Username: "eve"}), ErrInviteOnly)
+
+	common.Conf.User.RegistrationMode = models.RegistrationClosed
+	assert.ErrorIs(t, userService.Register(&models.User{Username: "eve"}), ErrRegistrationClosed)
+	assert.ErrorIs(t, userService.AcceptInvitation("token", &models.User{Username: "eve"}), ErrRegistrationClosed)
+}
+
+func TestUserService_Invitation(t *testing.T) {
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+	mailer := &fakeMailer{}
+	userService := &UserService{Repo: dao.NewGormRepository(db), Mailer: mailer}
+	admin := &models.User{ID: 1, Username: "root", Role: models.RoleAdmin}
+
+	t.Run("OwnerNeedsGroup", func(t *testing.T) {
+		owner := &models.User{ID: 2, Role: models.RoleUser}
+		_, err := userService.CreateInvitation(owner, InvitationRequest{Email: "new@example.com"})
+		assert.ErrorIs(t, err, ErrInvitationForbidden)
+	})
+
+	var token string
+	t.Run("Create", func(t *testing.T) {
+		mock.ExpectQuery("^SELECT `email` FROM `users` WHERE email IN \\(\\?\\)").
+			WithArgs("new@example.com").
+			WillReturnRows(sqlmock.NewRows([]string{"email"}))
+		mock.ExpectBegin()
+		mock.ExpectExec("^INSERT INTO `invitations`").WillReturnResult(sqlmock.NewResult(3, 1))
+		mock.ExpectCommit()
+
+		inv, err := userService.CreateInvitation(admin, InvitationRequest{Email: "New@Example.com", Role: models.RoleAdmin})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "new@example.com", inv.Email)
+		assert.Equal(t, models.RoleAdmin, inv.Role)
+		if assert.Len(t, mailer.sent, 1) {
+			assert.Equal(t, "new@example.com", mailer.sent[0].To)
+			m := tokenPattern.FindStringSubmatch(mailer.sent[0].Body)
+			if assert.Len(t, m, 2) {
+				token = m[1]
+				assert.Equal(t, inv.TokenHash, hashInvitationToken(token))
+			}
+		}
+	})
+
+	invRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "token_hash", "email", "role", "inviter_id", "expires_at"}).
+			AddRow(3, hashInvitationToken(token), "new@example.com", models.RoleAdmin, 1, time.Now().Add(time.Hour))
+	}
+	selectSQL := "^SELECT \\* FROM `invitations` WHERE token_hash = \\?"
+
+	t.Run("Accept", func(t *testing.T) {
+		mock.ExpectQuery(selectSQL).WillReturnRows(invRows())
+		mock.ExpectBegin()
+		mock.ExpectExec("^INSERT INTO `users`").WillReturnResult(sqlmock.NewResult(9, 1))
+		mock.ExpectExec("^UPDATE `invitations` SET `accepted_at`=\\?,`user_id`=\\? WHERE id = \\? AND accepted_at IS NULL").
+			WithArgs(sqlmock.AnyArg(), 9, 3, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("^INSERT INTO `audit_logs`").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		chosen := "0192f5a8-7c00-7000-8000-000000000001"
+		user := &models.User{PublicID: chosen, Username: "Newbie", Email: "ignored@example.com", Password: "password123", Role: models.RoleUser}
+		err := userService.AcceptInvitation(token, user)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "new@example.com", user.Email)
+		assert.Equal(t, models.RoleAdmin, user.Role)
+		assert.NotEqual(t, chosen, user.PublicID)
+	})
+
+	t.Run("AlreadyUsed", func(t *testing.T) {
+		// 并发使用同一邀请时条件更新未命中，整个事务回滚
+		mock.ExpectQuery(selectSQL).WillReturnRows(invRows())
+		mock.ExpectBegin()
+		mock.ExpectExec("^INSERT INTO `users`").WillReturnResult(sqlmock.NewResult(10, 1))
+		mock.ExpectExec("^UPDATE `invitations`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err := userService.AcceptInvitation(token, &models.User{Username: "other", Password: "password123"})
+
+		assert.ErrorIs(t, err, ErrInvalidInvitation)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		mock.ExpectQuery(selectSQL).WillReturnRows(
+			sqlmock.NewRows([]string{"id", "email", "expires_at"}).AddRow(4, "x@example.com", time.Now().Add(-time.Minute)))
+
+		_, err := userService.GetInvitation("stale")
+
+		assert.ErrorIs(t, err, ErrInvalidInvitation)
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
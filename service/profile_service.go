@@ -0,0 +1,129 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"gin-crud/common"
+	"gin-crud/models"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// profileFields 用户可通过 PATCH /me 修改的字段
+var profileFields = []string{"username", "attributes"}
+
+// UpdateProfile 用户修改自己的资料，只允许修改 profileFields 中的字段，密码需走 ChangePassword
+func (s *UserService) UpdateProfile(id string, data map[string]interface{}, versions []uint) error {
+	updateData := make(map[string]interface{})
+	for _, field := range profileFields {
+		if v, ok := data[field]; ok {
+			updateData[field] = v
+		}
+	}
+	if len(updateData) == 0 {
+		return errors.New("没有可更新的字段")
+	}
+	return s.UpdateUserIfMatch(id, updateData, versions)
+}
+
+// checkPassword 校验用户的当前密码，直接查主库避免使用缓存或副本中可能过期的哈希
+func (s *UserService) checkPassword(id, password string) (*models.User, error) {
+	user, err := s.Repo.Primary().GetUserByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("用户不存在")
+		}
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return nil, errors.New("密码错误")
+	}
+	return user, nil
+}
+
+// ChangePassword 修改密码，需要校验当前密码，成功后注销除当前会话外的所有会话
+func (s *UserService) ChangePassword(id, currentPassword, newPassword, sessionID string) error {
+	user, err := s.checkPassword(id, currentPassword)
+	if err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := s.applyUpdate(id, nil, map[string]interface{}{"password": string(hash)}); err != nil {
+		return err
+	}
+
+	if err := s.RevokeSessions(user.ID, sessionID); err != nil {
+		common.Logger.Error("注销其它会话失败", zap.Uint("user_id", user.ID), zap.Error(err))
+	}
+	return nil
+}
+
+// RequestDeletion 用户申请注销账号，需要确认密码。
+// 冷静期大于 0 时只记录计划删除时间，到期后由后台任务删除；否则立即删除并注销所有会话
+func (s *UserService) RequestDeletion(id, password string) (*time.Time, error) {
+	user, err := s.checkPassword(id, password)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletionScheduledAt != nil {
+		return nil, errors.New("已申请注销，请勿重复提交")
+	}
+
+	days := common.Conf.User.DeletionCoolingDays
+	if days <= 0 {
+		return nil, s.deleteUserNow(user.ID)
+	}
+
+	scheduledAt := time.Now().Add(time.Duration(days) * 24 * time.Hour)
+	if err := s.applyUpdate(id, nil, map[string]interface{}{"deletion_scheduled_at": scheduledAt}); err != nil {
+		return nil, err
+	}
+	return &scheduledAt, nil
+}
+
+// CancelDeletion 冷静期内撤销注销申请
+func (s *UserService) CancelDeletion(id string) error {
+	user, err := s.GetUser(id)
+	if err != nil {
+		return err
+	}
+	if user.DeletionScheduledAt == nil {
+		return errors.New("没有待执行的注销申请")
+	}
+	return s.applyUpdate(id, nil, map[string]interface{}{"deletion_scheduled_at": nil})
+}
+
+// ProcessScheduledDeletions 删除冷静期已结束的用户，返回删除数量
+func (s *UserService) ProcessScheduledDeletions() (int, error) {
+	users, err := s.Repo.FindUsersDueForDeletion(time.Now())
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, u := range users {
+		if err := s.deleteUserNow(u.ID); err != nil {
+			common.Logger.Error("计划注销失败", zap.Uint("user_id", u.ID), zap.Error(err))
+			continue
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// deleteUserNow 软删除用户并注销其所有会话
+func (s *UserService) deleteUserNow(userID uint) error {
+	if err := s.DeleteUser(fmt.Sprintf("%d", userID)); err != nil {
+		return err
+	}
+	if err := s.RevokeSessions(userID, ""); err != nil {
+		common.Logger.Error("注销会话失败", zap.Uint("user_id", userID), zap.Error(err))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gin-crud/common"
+	"gin-crud/mail"
+	"gin-crud/models"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// RegisterUniform 统一响应模式下的注册。用户名或邮箱已被占用时同样返回 nil，
+// 注册结果只通过邮件告知邮箱持有人：新账号收到注册成功通知，已有账号的持有人收到有人尝试注册的提醒，
+// 用户名被占用时告知申请人更换用户名。属性校验等与已有账号无关的错误照常返回
+func (s *UserService) RegisterUniform(user *models.User) error {
+	email := models.NormalizeEmail(user.Email)
+	username := models.NormalizeUsername(user.Username)
+
+	err := s.Register(user)
+	var conflict *common.ConflictError
+	if err != nil && !errors.As(err, &conflict) {
+		return err
+	}
+
+	var msg mail.Message
+	switch {
+	case err == nil:
+		msg = mail.Message{
+			To:      email,
+			Subject: "注册成功",
+			Body:    fmt.Sprintf("%s，您好：\n\n您的账号已注册成功，现在可以使用用户名 %s 登录。\n", username, username),
+		}
+	default:
+		// 唯一键冲突只报告其中一个字段，用户名冲突时邮箱也可能已被占用
+		existing, lookupErr := s.Repo.GetUserByEmail(email)
+		if lookupErr != nil && !errors.Is(lookupErr, gorm.ErrRecordNotFound) {
+			return lookupErr
+		}
+		if existing != nil {
+			msg = mail.Message{
+				To:      email,
+				Subject: "有人尝试使用您的邮箱注册",
+				Body: fmt.Sprintf("%s，您好：\n\n有人尝试使用本邮箱注册新账号，但本邮箱已关联账号 %s，新账号未创建。\n如果是您本人操作，请直接使用该账号登录；如果不是，请忽略本邮件。\n",
+					existing.Username, existing.Username),
+			}
+		} else {
+			msg = mail.Message{
+				To:      email,
+				Subject: "注册未完成",
+				Body:    fmt.Sprintf("您好：\n\n您申请注册的用户名 %s 已被占用，账号未创建，请更换用户名后重新注册。\n", username),
+			}
+		}
+	}
+
+	// 各种结果都在后台发送一封邮件，响应耗时不随结果变化
+	go s.sendRegistrationMail(msg)
+	return nil
+}
+
+func (s *UserService) sendRegistrationMail(msg mail.Message) {
+	if s.Mailer == nil {
+		common.Logger.Error("未配置邮件发送，注册结果通知未发出")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := s.Mailer.Send(ctx, msg); err != nil {
+		common.Logger.Error("发送注册结果通知失败", zap.Error(err))
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"gin-crud/dao"
+	"gin-crud/mail"
+	"gin-crud/models"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// chanMailer 把邮件写入 channel，用于等待后台发送的邮件
+type chanMailer chan mail.Message
+
+func (m chanMailer) Send(ctx context.Context, msg mail.Message) error {
+	m <- msg
+	return nil
+}
+
+func (m chanMailer) next(t *testing.T) mail.Message {
+	select {
+	case msg := <-m:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("没有收到邮件")
+		return mail.Message{}
+	}
+}
+
+func TestUserService_RegisterUniform(t *testing.T) {
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+	mailer := make(chanMailer, 1)
+	userService := &UserService{Repo: dao.NewGormRepository(db), Mailer: mailer}
+	insertSQL := "^INSERT INTO `users`"
+	selectSQL := "^SELECT \\* FROM `users` WHERE email = \\?"
+
+	t.Run("Created", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(insertSQL).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err := userService.RegisterUniform(&models.User{Username: "carol", Email: "carol@example.com", Password: "password123"})
+
+		assert.NoError(t, err)
+		msg := mailer.next(t)
+		assert.Equal(t, "carol@example.com", msg.To)
+		assert.Equal(t, "注册成功", msg.Subject)
+	})
+
+	t.Run("EmailTaken", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(insertSQL).
+			WillReturnError(&mysqlDriver.MySQLError{Number: 1062, Message: "Duplicate entry 'bob@example.com' for key 'users.uk_users_email'"})
+		mock.ExpectRollback()
+		mock.ExpectQuery(selectSQL).WithArgs("bob@example.com", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email"}).AddRow(2, "bob", "bob@example.com"))
+
+		err := userService.RegisterUniform(&models.User{Username: "mallory", Email: "Bob@example.com", Password: "password123"})
+
+		assert.NoError(t, err)
+		msg := mailer.next(t)
+		assert.Equal(t, "bob@example.com", msg.To)
+		assert.Equal(t, "有人尝试使用您的邮箱注册", msg.Subject)
+		assert.Contains(t, msg.Body, "bob")
+	})
+
+	t.Run("UsernameTaken", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(insertSQL).
+			WillReturnError(&mysqlDriver.MySQLError{Number: 1062, Message: "Duplicate entry 'bob' for key 'users.uk_users_username'"})
+		mock.ExpectRollback()
+		mock.ExpectQuery(selectSQL).WithArgs("dave@example.com", 1).WillReturnError(gorm.ErrRecordNotFound)
+
+		err := userService.RegisterUniform(&models.User{Username: "bob", Email: "dave@example.com", Password: "password123"})
+
+		assert.NoError(t, err)
+		msg := mailer.next(t)
+		assert.Equal(t, "dave@example.com", msg.To)
+		assert.Equal(t, "注册未完成", msg.Subject)
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin-crud/cache"
+	"gin-crud/common"
+	"gin-crud/dao"
+	"gin-crud/migrate"
+	"gin-crud/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// openSQLite 已执行全部迁移的 SQLite 内存数据库
+func openSQLite(t *testing.T) *gorm.DB {
+	db, err := common.OpenDB(common.Datasource{DriverName: "sqlite", Database: ":memory:"})
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	m, err := migrate.New(db)
+	if err == nil {
+		_, err = m.Up(0)
+	}
+	if err != nil {
+		t.Fatalf("failed to migrate sqlite: %v", err)
+	}
+	return db
+}
+
+// repoBackends 服务层测试矩阵：内存实现和 SQLite 内存数据库，都不需要外部服务
+var repoBackends = map[string]func(t *testing.T) dao.UserRepository{
+	"memory": func(t *testing.T) dao.UserRepository { return dao.NewMemoryRepository() },
+	"sqlite": func(t *testing.T) dao.UserRepository { return dao.NewGormRepository(openSQLite(t)) },
+}
+
+func TestUserService_Repositories(t *testing.T) {
+	withAttributes(t, []common.Attribute{
+		{Name: "department", Type: "string"},
+		{Name: "level", Type: "int"},
+		{Name: "remote", Type: "bool"},
+	})
+	for name, newRepo := range repoBackends {
+		t.Run(name, func(t *testing.T) { testUserServiceFlows(t, newRepo(t)) })
+	}
+}
+
+// TestGormRepository_Primary 两个互不同步的库分别作为主库和副本，
+// 能否读到刚写入的数据即可区分查询走的是哪个库
+func TestGormRepository_Primary(t *testing.T) {
+	primary, replica := openSQLite(t), openSQLite(t)
+	replicaConn, err := replica.DB()
+	assert.NoError(t, err)
+	assert.NoError(t, primary.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: []gorm.Dialector{&sqlite.Dialector{Conn: replicaConn}},
+	})))
+
+	repo := dao.NewGormRepository(primary)
+	user := &models.User{Username: "alice", Email: "alice@example.com", Password: "secret"}
+	assert.NoError(t, repo.InsertUser(user))
+
+	// 默认查询副本，副本上没有这条数据
+	_, err = repo.GetUserByUsername("alice")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	got, err := repo.Primary().GetUserByUsername("alice")
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, got.ID)
+
+	// 缓存从主库填充，不会把副本上的旧数据写入缓存
+	userService := &UserService{Repo: repo, Cache: cache.NewMemory()}
+	_, err = userService.GetUser(user.PublicID)
+	assert.NoError(t, err)
+	users, err := userService.GetUsers([]string{user.PublicID})
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	_, err = userService.ResolveUserID(user.PublicID)
+	assert.NoError(t, err)
+
+	// 刚写入过的客户端使用 Primary 派生的服务，不经缓存的查询也读主库
+	_, total, err := userService.ListUsers(1, 10, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), total)
+	_, total, err = userService.Primary().ListUsers(1, 10, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+
+	// 先读后写的流程从主库读取当前状态和版本号
+	id := fmt.Sprintf("%d", user.ID)
+	assert.NoError(t, userService.ChangeStatus(id, models.StatusSuspended, "spam", nil, 0))
+	got, err = repo.Primary().GetUserByID(id)
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusSuspended, got.Status)
+}
+
+// TestGormRepository_StringIDs 字符串形式的 ID 作为参数绑定，不会被当作 SQL 条件拼接
+func TestGormRepository_StringIDs(t *testing.T) {
+	repo := dao.NewGormRepository(openSQLite(t))
+	assert.NoError(t, repo.CreateGroup(&models.Group{Name: "eng"}))
+	assert.NoError(t, repo.InsertUser(&models.User{Username: "alice", Email: "alice@example.com", Password: "secret"}))
+	assert.NoError(t, repo.CreateInvitation(&models.Invitation{TokenHash: "hash", Email: "bob@example.com"}))
+
+	const injected = "0 OR 1=1"
+	_, err := repo.GetGroupByID(injected)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = repo.GetUserByID(injected)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = repo.GetUserByIDUnscoped(injected)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = repo.GetInvitationByID(injected)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	group, err := repo.GetGroupByID("1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "eng", group.Name)
+	}
+}
+
+// testUserServiceFlows 不依赖具体 SQL 的业务流程，对每种 repo 实现都应得到相同结果
+func testUserServiceFlows(t *testing.T, repo dao.UserRepository) {
+	rdb, _ := mockRedis(t)
+	userService := &UserService{Repo: repo, RDB: rdb}
+
+	alice := &models.User{
+		Username:   "Alice",
+		Email:      "Alice@Example.com",
+		Password:   "secret",
+		Attributes: models.Attributes{"department": "engineering", "level": float64(3), "remote": true},
+	}
+	assert.NoError(t, userService.Register(alice))
+	bob := &models.User{Username: "bob", Email: "bob@example.com", Password: "secret",
+		Attributes: models.Attributes{"department": "3", "level": float64(30)}}
+	assert.NoError(t, userService.Register(bob))
+	id := fmt.Sprintf("%d", alice.ID)
+
+	t.Run("Register", func(t *testing.T) {
+		assert.Equal(t, "alice", alice.Username)
+		assert.NotEmpty(t, alice.PublicID)
+
+		// 密码哈希不出现在响应中
+		raw, _ := json.Marshal(alice)
+		assert.NotContains(t, string(raw), "password")
+		assert.NotContains(t, string(raw), alice.Password)
+
+		var conflict *common.ConflictError
+		err := userService.Register(&models.User{Username: "ALICE", Email: "other@example.com", Password: "secret"})
+		if assert.True(t, errors.As(err, &conflict)) {
+			assert.Equal(t, "username", conflict.Field)
+		}
+	})
+
+	t.Run("Login", func(t *testing.T) {
+		token, err := userService.Login("alice", "secret")
+		assert.NoError(t, err)
+		assert.NotEmpty(t, token.AccessToken)
+
+		_, err = userService.Login("alice", "wrong")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+
+	t.Run("FilterByAttributes", func(t *testing.T) {
+		for _, tt := range []struct {
+			filters map[string]string
+			want    []string
+		}{
+			{map[string]string{"department": "engineering"}, []string{"alice"}},
+			{map[string]string{"department": "3"}, []string{"bob"}},
+			{map[string]string{"level": "3"}, []string{"alice"}},
+			{map[string]string{"remote": "true", "level": "03"}, []string{"alice"}},
+			{map[string]string{"remote": "false"}, []string{}},
+		} {
+			users, total, err := userService.ListUsers(1, 10, tt.filters)
+			assert.NoError(t, err)
+			names := []string{}
+			for _, u := range users {
+				names = append(names, u.Username)
+			}
+			assert.Equal(t, tt.want, names, "filters: %v", tt.filters)
+			assert.Equal(t, int64(len(tt.want)), total)
+		}
+	})
+
+	t.Run("UpdateIfMatch", func(t *testing.T) {
+		user, _ := userService.GetUser(id)
+		err := userService.UpdateUserIfMatch(id, map[string]interface{}{"username": "stale"}, []uint{user.Version + 1})
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+
+		// 不在允许列表中的字段被忽略，只有这些字段时不更新；密码只能通过 ChangePassword 修改
+		err = userService.UpdateUserIfMatch(id, map[string]interface{}{
+			"public_id": "hijacked", "email": "new@example.com", "password": "hijacked",
+		}, nil)
+		assert.EqualError(t, err, "没有可更新的字段")
+		assert.NoError(t, userService.UpdateUserIfMatch(id, map[string]interface{}{
+			"username": "Alicia", "public_id": "hijacked", "id": 99, "created_at": "2000-01-01T00:00:00Z",
+		}, []uint{user.Version}))
+		updated, _ := userService.GetUser(id)
+		assert.Equal(t, "alicia", updated.Username)
+		assert.Equal(t, user.Version+1, updated.Version)
+		assert.Equal(t, user.PublicID, updated.PublicID)
+		assert.Equal(t, user.ID, updated.ID)
+		assert.Equal(t, user.CreatedAt.Unix(), updated.CreatedAt.Unix())
+		_, err = userService.Login("alicia", "secret")
+		assert.NoError(t, err)
+	})
+
+	t.Run("ChangePassword", func(t *testing.T) {
+		assert.EqualError(t, userService.ChangePassword(id, "wrong", "secret2", ""), "密码错误")
+		assert.NoError(t, userService.ChangePassword(id, "secret", "secret2", ""))
+		_, err := userService.Login("alicia", "secret2")
+		assert.NoError(t, err)
+		assert.NoError(t, userService.ChangePassword(id, "secret2", "secret", ""))
+	})
+
+	t.Run("ChangeStatus", func(t *testing.T) {
+		assert.NoError(t, userService.ChangeStatus(id, models.StatusSuspended, "spam", nil, 1))
+		logs, total, err := userService.ListAuditLogs(id, 1, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+		assert.Equal(t, models.AuditStatusChange, logs[0].Action)
+		assert.NoError(t, userService.ChangeStatus(id, models.StatusActive, "", nil, 1))
+	})
+
+	t.Run("Groups", func(t *testing.T) {
+		parent := &models.Group{Name: "staff"}
+		assert.NoError(t, userService.CreateGroup(parent))
+		child := &models.Group{Name: "ops", ParentID: &parent.ID}
+		assert.NoError(t, userService.CreateGroup(child))
+		assert.NoError(t, userService.GrantGroupPermission(fmt.Sprintf("%d", parent.ID), "reports.read"))
+		assert.NoError(t, userService.AddGroupMember(fmt.Sprintf("%d", child.ID), id, ""))
+
+		ok, err := userService.HasPermission(alice.ID, "reports.read")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		members, err := userService.ListGroupMembers(fmt.Sprintf("%d", child.ID))
+		if assert.NoError(t, err) && assert.Len(t, members, 1) && assert.NotNil(t, members[0].User) {
+			assert.Equal(t, alice.PublicID, members[0].User.PublicID)
+			assert.Empty(t, members[0].User.Password)
+			assert.Empty(t, members[0].User.Email)
+		}
+		assert.EqualError(t, userService.DeleteGroup(fmt.Sprintf("%d", parent.ID)), "请先删除或移走子组")
+	})
+
+	t.Run("DeleteAndRestore", func(t *testing.T) {
+		assert.NoError(t, userService.DeleteUser(id))
+		_, err := userService.GetUser(id)
+		assert.EqualError(t, err, "用户不存在")
+
+		// 删除后用户名可以被重新使用，恢复时产生冲突
+		taken := &models.User{Username: "alicia", Email: "taken@example.com", Password: "secret"}
+		assert.NoError(t, userService.Register(taken))
+		var conflict *common.ConflictError
+		if assert.True(t, errors.As(userService.RestoreUser(id), &conflict)) {
+			assert.Equal(t, "username", conflict.Field)
+		}
+
+		assert.NoError(t, userService.DeleteUser(fmt.Sprintf("%d", taken.ID)))
+		assert.NoError(t, userService.RestoreUser(id))
+		restored, err := userService.GetUser(id)
+		assert.NoError(t, err)
+		assert.Equal(t, "alicia", restored.Username)
+	})
+
+	t.Run("TransactionRollback", func(t *testing.T) {
+		err := repo.Transaction(func(tx dao.UserRepository) error {
+			if err := tx.UpdateUserByID(id, nil, map[string]interface{}{"status_reason": "rolled back"}); err != nil {
+				return err
+			}
+			return errors.New("abort")
+		})
+		assert.EqualError(t, err, "abort")
+		user, _ := repo.GetUserByID(id)
+		assert.Empty(t, user.StatusReason)
+	})
+
+	t.Run("Erase", func(t *testing.T) {
+		carol := &models.User{Username: "carol", Email: "carol@example.com", Password: "secret",
+			Attributes: models.Attributes{"department": "sales"}}
+		assert.NoError(t, userService.Register(carol))
+		assert.NoError(t, repo.CreateAuditLog(&models.AuditLog{UserID: carol.ID, ActorID: carol.ID,
+			Action: models.AuditEmailChange, Detail: `{"from":"old@example.com","to":"carol@example.com"}`}))
+		assert.NoError(t, repo.CreateAuditLog(&models.AuditLog{UserID: carol.ID, ActorID: 1,
+			Action: models.AuditStatusChange, Detail: `{"status":"suspended"}`}))
+
+		assert.NoError(t, userService.EraseUser(fmt.Sprintf("%d", carol.ID), 1))
+
+		// 自定义属性和审计详情中的邮箱随匿名化清除，其它审计详情保留
+		erased, err := repo.GetUserByIDUnscoped(fmt.Sprintf("%d", carol.ID))
+		if assert.NoError(t, err) {
+			assert.Equal(t, fmt.Sprintf("erased-%d", carol.ID), erased.Username)
+			assert.Empty(t, erased.Attributes)
+		}
+		logs, err := repo.ListAllAuditLogsOf(carol.ID)
+		assert.NoError(t, err)
+		details := map[string]string{}
+		for _, log := range logs {
+			details[log.Action] = log.Detail
+		}
+		assert.Empty(t, details[models.AuditEmailChange])
+		assert.Equal(t, `{"status":"suspended"}`, details[models.AuditStatusChange])
+		assert.Contains(t, details, models.AuditErase)
+	})
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"gin-crud/common"
+	"gin-crud/models"
+	"gin-crud/search"
+	"strconv"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// UserSearchHit 用户检索结果
+type UserSearchHit struct {
+	User       *models.User      `json:"user"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"` // 命中部分用 <em></em> 包裹
+}
+
+// SearchUsers 按用户名或邮箱的部分内容检索用户，结果按相关度排序
+func (s *UserService) SearchUsers(query string, page, size int) ([]UserSearchHit, int64, error) {
+	if s.Search == nil {
+		return nil, 0, errors.New("未配置用户检索")
+	}
+	result, err := s.Search.Search(context.Background(), query, page, size)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]uint, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		ids = append(ids, hit.ID)
+	}
+	users, err := s.Repo.GetUsersByIDs(ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	byID := make(map[uint]*models.User, len(users))
+	for i := range users {
+		byID[users[i].ID] = &users[i]
+	}
+
+	// 按检索结果的顺序返回，索引中残留的已删除用户跳过
+	hits := make([]UserSearchHit, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		if user, ok := byID[hit.ID]; ok {
+			hits = append(hits, UserSearchHit{User: user, Score: hit.Score, Highlights: hit.Highlights})
+		}
+	}
+	return hits, result.Total, nil
+}
+
+func searchDocument(user *models.User) search.Document {
+	return search.Document{ID: user.ID, Username: user.Username, Email: user.Email}
+}
+
+// indexUser 将用户写入检索索引，失败只记录日志，不影响业务操作
+func (s *UserService) indexUser(user *models.User) {
+	if s.deferred(func(s *UserService) { s.indexUser(user) }) {
+		return
+	}
+	if s.Search == nil {
+		return
+	}
+	if err := s.Search.Index(context.Background(), searchDocument(user)); err != nil {
+		common.Logger.Error("更新检索索引失败", zap.Uint("user_id", user.ID), zap.Error(err))
+	}
+}
+
+// reindexUser 按数据库中的最新数据更新检索索引，用户已不存在时从索引中删除
+func (s *UserService) reindexUser(id string) {
+	if s.deferred(func(s *UserService) { s.reindexUser(id) }) {
+		return
+	}
+	if s.Search == nil {
+		return
+	}
+	user, err := s.Repo.GetUserByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		s.unindexUser(id)
+		return
+	}
+	if err != nil {
+		common.Logger.Error("更新检索索引失败", zap.String("user_id", id), zap.Error(err))
+		return
+	}
+	s.indexUser(user)
+}
+
+// unindexUser 从检索索引中删除用户
+func (s *UserService) unindexUser(id string) {
+	if s.deferred(func(s *UserService) { s.unindexUser(id) }) {
+		return
+	}
+	if s.Search == nil {
+		return
+	}
+	uid, _ := strconv.ParseUint(id, 10, 64)
+	if err := s.Search.Delete(context.Background(), uint(uid)); err != nil {
+		common.Logger.Error("删除检索索引失败", zap.String("user_id", id), zap.Error(err))
+	}
+}
+
+// RebuildSearchIndex 将全部未删除用户写入检索索引，用于进程内索引启动时的全量重建
+func (s *UserService) RebuildSearchIndex() (int, error) {
+	if s.Search == nil {
+		return 0, nil
+	}
+	ctx := context.Background()
+	count := 0
+	err := s.Repo.EachUserBatch(500, func(users []models.User) error {
+		for i := range users {
+			if err := s.Search.Index(ctx, searchDocument(&users[i])); err != nil {
+				return err
+			}
+		}
+		count += len(users)
+		return nil
+	})
+	return count, err
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"gin-crud/dao"
+	"gin-crud/models"
+	"gin-crud/search"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserService_SearchUsers(t *testing.T) {
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+	rdb, _ := mockRedis(t)
+	idx := search.NewMemoryIndex()
+	userService := &UserService{Repo: dao.NewGormRepository(db), RDB: rdb, Search: idx}
+
+	// 注册后写入索引
+	mock.ExpectBegin()
+	mock.ExpectExec("^INSERT INTO `users`").WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, userService.Register(&models.User{Username: "Alice", Email: "alice@example.com", Password: "password123"}))
+
+	mock.ExpectQuery("^SELECT \\* FROM `users` WHERE id IN \\(\\?\\)").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email"}).AddRow(5, "alice", "alice@example.com"))
+	hits, total, err := userService.SearchUsers("lic", 1, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	if assert.Len(t, hits, 1) {
+		assert.Equal(t, "alice", hits[0].User.Username)
+		assert.Equal(t, "a<em>lic</em>e", hits[0].Highlights["username"])
+	}
+
+	// 删除后从索引中移除
+	mock.ExpectBegin()
+	mock.ExpectExec("^UPDATE `users` SET").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, userService.DeleteUser("5"))
+	res, _ := idx.Search(context.Background(), "lic", 1, 20)
+	assert.Equal(t, int64(0), res.Total)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
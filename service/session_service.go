@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gin-crud/common"
+	"gin-crud/models"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// refreshTokenTTL Refresh Token 有效期
+const refreshTokenTTL = 7 * 24 * time.Hour
+
+// sessionsKey 用户会话索引，Set 中保存该用户所有 Refresh Token
+func sessionsKey(userID uint) string {
+	return fmt.Sprintf("user_sessions:%d", userID)
+}
+
+// ErrSessionsUnavailable 会话、邮箱修改申请和导出任务只保存在 Redis 中，没有数据库副本，
+// 不能像缓存一样降级；Redis 未配置或连接失败时相关操作返回该错误
+var ErrSessionsUnavailable = errors.New("会话服务暂不可用，请稍后重试")
+
+// sessionStore 保存会话等状态的 Redis 客户端，未配置时返回 ErrSessionsUnavailable
+func (s *UserService) sessionStore() (*redis.Client, error) {
+	if s.RDB == nil {
+		return nil, ErrSessionsUnavailable
+	}
+	return s.RDB, nil
+}
+
+// sessionError 与缓存的降级判断一致：Redis 返回的命令错误（包括 redis.Nil）原样返回，
+// 其它错误视为连接失败，转换为 ErrSessionsUnavailable
+func sessionError(err error) error {
+	var replyErr redis.Error
+	if err == nil || errors.As(err, &replyErr) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrSessionsUnavailable, err)
+}
+
+// SessionID 由 Refresh Token 派生会话 ID，写入 Access Token 用于识别当前会话，
+// 避免在 Access Token 中暴露 Refresh Token 本身
+func SessionID(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:16])
+}
+
+// createSession 为用户创建新会话并签发双 Token
+func (s *UserService) createSession(user *models.User) (*TokenResponse, error) {
+	// 1. 生成 Refresh Token
+	refreshToken, err := common.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. 生成 Access Token
+	accessToken, err := common.GenerateAccessToken(user.PublicID, user.Username, SessionID(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. 将 Refresh Token 存入 Redis (有效期 7 天)，并加入用户会话索引
+	// Key: refresh_token:{token} -> Value: userID
+	// Key: user_sessions:{userID} -> Set{token}
+	rdb, err := s.sessionStore()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	pipe := rdb.TxPipeline()
+	pipe.Set(ctx, "refresh_token:"+refreshToken, user.ID, refreshTokenTTL)
+	pipe.SAdd(ctx, sessionsKey(user.ID), refreshToken)
+	pipe.Expire(ctx, sessionsKey(user.ID), refreshTokenTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, sessionError(err)
+	}
+
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// RevokeSessions 注销用户的所有会话，exceptSessionID 非空时保留该会话。
+// 已签发的 Access Token 仍会在短有效期（15 分钟）内自然过期。
+// 在事务中调用时于提交后执行，此时失败只记录日志
+func (s *UserService) RevokeSessions(userID uint, exceptSessionID string) error {
+	if s.deferred(func(s *UserService) {
+		if err := s.RevokeSessions(userID, exceptSessionID); err != nil {
+			common.Logger.Error("注销会话失败", zap.Uint("user_id", userID), zap.Error(err))
+		}
+	}) {
+		return nil
+	}
+	rdb, err := s.sessionStore()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	tokens, err := rdb.SMembers(ctx, sessionsKey(userID)).Result()
+	if err != nil {
+		return sessionError(err)
+	}
+
+	pipe := rdb.TxPipeline()
+	for _, token := range tokens {
+		if exceptSessionID != "" && SessionID(token) == exceptSessionID {
+			continue
+		}
+		pipe.Del(ctx, "refresh_token:"+token)
+		pipe.SRem(ctx, sessionsKey(userID), token)
+	}
+	_, err = pipe.Exec(ctx)
+	return sessionError(err)
+}
+
+// SessionInfo 会话信息，不包含 Refresh Token 本身
+type SessionInfo struct {
+	SessionID string    `json:"session_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ListSessions 列出用户当前有效的会话，顺带清理索引中已过期的 Token
+func (s *UserService) ListSessions(userID uint) ([]SessionInfo, error) {
+	rdb, err := s.sessionStore()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	tokens, err := rdb.SMembers(ctx, sessionsKey(userID)).Result()
+	if err != nil {
+		return nil, sessionError(err)
+	}
+
+	sessions := make([]SessionInfo, 0, len(tokens))
+	for _, token := range tokens {
+		ttl, err := rdb.TTL(ctx, "refresh_token:"+token).Result()
+		if err != nil {
+			return nil, sessionError(err)
+		}
+		// -2 表示 Key 不存在，Token 已过期
+		if ttl < 0 {
+			rdb.SRem(ctx, sessionsKey(userID), token)
+			continue
+		}
+		sessions = append(sessions, SessionInfo{SessionID: SessionID(token), ExpiresAt: time.Now().Add(ttl)})
+	}
+	return sessions, nil
+}
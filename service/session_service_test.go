@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"gin-crud/common"
+	"gin-crud/models"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockRedis 启动一个内存 Redis，测试结束自动关闭
+func mockRedis(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	return redis.NewClient(&redis.Options{Addr: mr.Addr()}), mr
+}
+
+func TestUserService_RevokeSessions(t *testing.T) {
+	rdb, mr := mockRedis(t)
+	userService := &UserService{RDB: rdb}
+	user := &models.User{Username: "tester"}
+	user.ID = 42
+
+	current, err := userService.createSession(user)
+	assert.NoError(t, err)
+	other, err := userService.createSession(user)
+	assert.NoError(t, err)
+
+	claims, err := common.ParseToken(current.AccessToken)
+	if assert.NoError(t, err) {
+		assert.Equal(t, SessionID(current.RefreshToken), claims.SessionID)
+	}
+
+	assert.NoError(t, userService.RevokeSessions(user.ID, claims.SessionID))
+
+	assert.True(t, mr.Exists("refresh_token:"+current.RefreshToken))
+	assert.False(t, mr.Exists("refresh_token:"+other.RefreshToken))
+	members, _ := rdb.SMembers(context.Background(), sessionsKey(user.ID)).Result()
+	assert.Equal(t, []string{current.RefreshToken}, members)
+
+	_, err = userService.RefreshToken(other.RefreshToken)
+	assert.EqualError(t, err, "Refresh Token 无效或已过期")
+
+	assert.NoError(t, userService.Logout(current.RefreshToken))
+	assert.False(t, mr.Exists(sessionsKey(user.ID)))
+}
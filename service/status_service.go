@@ -0,0 +1,139 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin-crud/common"
+	"gin-crud/dao"
+	"gin-crud/models"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// AccountStatusError 账号状态不允许登录或访问
+type AccountStatusError struct {
+	Status    string
+	Reason    string
+	ExpiresAt *time.Time
+}
+
+func (e *AccountStatusError) Error() string {
+	switch e.Status {
+	case models.StatusPending:
+		return "账号尚未激活"
+	case models.StatusSuspended:
+		return "账号已被暂停使用"
+	case models.StatusBanned:
+		return "账号已被封禁"
+	default:
+		return "账号状态异常"
+	}
+}
+
+// ErrUserErased 账号已匿名化，不允许再变更状态
+var ErrUserErased = errors.New("用户已匿名化，不能变更状态")
+
+// CheckActive 检查用户当前是否允许登录和访问，不允许时返回 *AccountStatusError
+func CheckActive(user *models.User) error {
+	status := user.EffectiveStatus(time.Now())
+	if status == models.StatusActive {
+		return nil
+	}
+	return &AccountStatusError{Status: status, Reason: user.StatusReason, ExpiresAt: user.StatusExpiresAt}
+}
+
+// statusChange 状态变更审计详情
+type statusChange struct {
+	From      string     `json:"from"`
+	To        string     `json:"to"`
+	Reason    string     `json:"reason,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// ChangeStatus 变更账号状态并写入审计记录，actorID 为 0 表示系统操作。
+// 暂停或封禁时同时注销该用户的所有会话
+func (s *UserService) ChangeStatus(id, to, reason string, expiresAt *time.Time, actorID uint) error {
+	// 从主库读取，副本延迟时旧的状态和版本号会导致误判状态流转或乐观锁冲突
+	user, err := s.Repo.Primary().GetUserByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("用户不存在")
+		}
+		return err
+	}
+	// 匿名化的账号不可恢复，状态也不再允许变更
+	if user.ErasedAt != nil {
+		return ErrUserErased
+	}
+
+	// 恢复正常时以存储的状态为准（包括已到期的暂停/封禁），其它变更以实际生效的状态为准
+	from := user.Status
+	if from == "" || to != models.StatusActive {
+		from = user.EffectiveStatus(time.Now())
+	}
+	if !models.CanTransition(from, to) {
+		return fmt.Errorf("不允许从 %s 变更为 %s", from, to)
+	}
+	if to == models.StatusActive || to == models.StatusPending {
+		expiresAt = nil
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return errors.New("到期时间必须晚于当前时间")
+	}
+
+	detail, _ := json.Marshal(statusChange{From: from, To: to, Reason: reason, ExpiresAt: expiresAt})
+	err = s.InTx(func(tx *UserService) error {
+		// 以读取时的版本号作为乐观锁条件，防止并发变更互相覆盖
+		err := tx.Repo.UpdateUserByID(id, []uint{user.Version}, map[string]interface{}{
+			"status":            to,
+			"status_reason":     reason,
+			"status_expires_at": expiresAt,
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Repo.CreateAuditLog(&models.AuditLog{
+			UserID:  user.ID,
+			ActorID: actorID,
+			Action:  models.AuditStatusChange,
+			Detail:  string(detail),
+		})
+		if err != nil {
+			return err
+		}
+		tx.invalidateUser(id)
+		if to == models.StatusSuspended || to == models.StatusBanned {
+			tx.RevokeSessions(user.ID, "")
+		}
+		return nil
+	})
+	if errors.Is(err, dao.ErrVersionConflict) {
+		return ErrPreconditionFailed
+	}
+	return err
+}
+
+// ListAuditLogs 分页查询用户的审计记录
+func (s *UserService) ListAuditLogs(id string, page, size int) ([]models.AuditLog, int64, error) {
+	return s.Repo.ListAuditLogs(id, page, size)
+}
+
+// ReactivateExpired 将暂停或封禁已到期的用户恢复为正常状态，返回恢复数量
+func (s *UserService) ReactivateExpired() (int, error) {
+	users, err := s.Repo.FindUsersWithExpiredStatus(time.Now())
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, u := range users {
+		if err := s.ChangeStatus(fmt.Sprintf("%d", u.ID), models.StatusActive, "到期自动恢复", nil, 0); err != nil {
+			common.Logger.Error("自动恢复账号状态失败", zap.Uint("user_id", u.ID), zap.Error(err))
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
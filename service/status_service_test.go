@@ -0,0 +1,92 @@
+package service
+
+import (
+	"gin-crud/cache"
+	"gin-crud/dao"
+	"gin-crud/models"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckActive(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	assert.NoError(t, CheckActive(&models.User{}))
+	assert.NoError(t, CheckActive(&models.User{Status: models.StatusActive}))
+	assert.NoError(t, CheckActive(&models.User{Status: models.StatusSuspended, StatusExpiresAt: &past}))
+
+	var statusErr *AccountStatusError
+	err := CheckActive(&models.User{Status: models.StatusSuspended, StatusReason: "spam", StatusExpiresAt: &future})
+	if assert.ErrorAs(t, err, &statusErr) {
+		assert.Equal(t, models.StatusSuspended, statusErr.Status)
+		assert.Equal(t, "spam", statusErr.Reason)
+	}
+	assert.EqualError(t, CheckActive(&models.User{Status: models.StatusBanned}), "账号已被封禁")
+	assert.EqualError(t, CheckActive(&models.User{Status: models.StatusPending}), "账号尚未激活")
+}
+
+func TestUserService_ChangeStatus(t *testing.T) {
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+
+	rdb, mr := mockRedis(t)
+	userService := &UserService{Repo: dao.NewGormRepository(db), RDB: rdb, Cache: cache.NewRedis(rdb)}
+	selectSQL := "^SELECT \\* FROM `users` WHERE `users`.`id` = \\? AND `users`.`deleted_at` IS NULL"
+
+	t.Run("InvalidTransition", func(t *testing.T) {
+		mock.ExpectQuery(selectSQL).
+			WithArgs("3", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "status", "version"}).AddRow(3, models.StatusBanned, 2))
+
+		err := userService.ChangeStatus("3", models.StatusSuspended, "spam", nil, 1)
+
+		assert.EqualError(t, err, "不允许从 banned 变更为 suspended")
+	})
+
+	t.Run("Erased", func(t *testing.T) {
+		mock.ExpectQuery(selectSQL).
+			WithArgs("5", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "status", "status_reason", "erased_at", "version"}).
+				AddRow(5, models.StatusBanned, "erased", time.Now(), 2))
+
+		err := userService.ChangeStatus("5", models.StatusActive, "", nil, 1)
+
+		assert.ErrorIs(t, err, ErrUserErased)
+	})
+
+	t.Run("SuspendRevokesSessions", func(t *testing.T) {
+		mr.SAdd(sessionsKey(4), "token-a")
+		mr.Set("refresh_token:token-a", "4")
+		pid := "0192f5a8-7c00-7000-8000-000000000004"
+		mr.Set("user:"+pid, "{}")
+		mr.Set("user_ref:4", pid)
+
+		mock.ExpectQuery(selectSQL).
+			WithArgs("4", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "status", "version"}).AddRow(4, models.StatusActive, 2))
+		mock.ExpectBegin()
+		mock.ExpectExec("^UPDATE `users` SET `status`=\\?,`status_expires_at`=\\?,`status_reason`=\\?,`version`=version \\+ 1,`updated_at`=\\? WHERE id = \\? AND version IN \\(\\?\\)").
+			WithArgs(models.StatusSuspended, nil, "spam", sqlmock.AnyArg(), "4", 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("^INSERT INTO `audit_logs`").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err := userService.ChangeStatus("4", models.StatusSuspended, "spam", nil, 1)
+
+		assert.NoError(t, err)
+		assert.False(t, mr.Exists("user:"+pid))
+		assert.False(t, mr.Exists("user_ref:4"))
+		assert.False(t, mr.Exists("refresh_token:token-a"))
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
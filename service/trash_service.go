@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"gin-crud/common"
+	"gin-crud/models"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ListDeletedUsers 分页查看回收站中的用户
+func (s *UserService) ListDeletedUsers(page, size int) ([]models.User, int64, error) {
+	return s.Repo.ListDeletedUsers(page, size)
+}
+
+// RestoreUser 从回收站恢复用户，用户名或邮箱已被他人占用时返回 *common.ConflictError
+func (s *UserService) RestoreUser(id string) error {
+	if err := s.Repo.RestoreUserByID(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("用户不存在")
+		}
+		return err
+	}
+
+	// 删除期间按公开 ID 查询会缓存"不存在"的空值，恢复后需要清除
+	user, err := s.Repo.Primary().GetUserByID(id)
+	if err != nil {
+		common.Logger.Error("恢复后读取用户失败", zap.String("user_id", id), zap.Error(err))
+		return nil
+	}
+	s.evictCache(context.Background(), userCacheKey(user.PublicID))
+	s.indexUser(user)
+	return nil
+}
+
+// PurgeUser 永久删除回收站中的用户，同时删除其头像文件
+func (s *UserService) PurgeUser(id string) error {
+	user, err := s.Repo.GetDeletedUserByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("用户不存在")
+		}
+		return err
+	}
+	if err := s.Repo.PurgeUserByID(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("用户不存在")
+		}
+		return err
+	}
+	s.deleteAvatarBlobs(user.Avatar)
+	s.cleanupMemberships()
+	return nil
+}
+
+// cleanupMemberships 清理已永久删除用户的组成员关系
+func (s *UserService) cleanupMemberships() {
+	if _, err := s.Repo.DeleteOrphanMemberships(); err != nil {
+		common.Logger.Error("清理组成员关系失败", zap.Error(err))
+	}
+}
+
+// PurgeExpiredUsers 永久删除软删除时间超过保留期的用户及其头像文件
+func (s *UserService) PurgeExpiredUsers(retention time.Duration) (int64, error) {
+	before := time.Now().Add(-retention)
+	avatars, err := s.Repo.FindAvatarsDeletedBefore(before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := s.Repo.PurgeUsersDeletedBefore(before)
+	if err != nil {
+		return 0, err
+	}
+	for _, prefix := range avatars {
+		s.deleteAvatarBlobs(prefix)
+	}
+	if n > 0 {
+		s.cleanupMemberships()
+	}
+	return n, nil
+}
+
+// RunMaintenance 后台定时任务：恢复暂停/封禁到期的账号，执行到期的自助注销，
+// 删除过期的数据导出文件，并清理超过保留期的回收站用户。
+// 每次执行时读取最新配置，支持热更新
+func (s *UserService) RunMaintenance(ctx context.Context) {
+	for {
+		interval := time.Duration(common.Conf.User.TrashPurgeInterval) * time.Minute
+		if interval <= 0 {
+			interval = time.Hour
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		if n, err := s.ReactivateExpired(); err != nil {
+			common.Logger.Error("恢复到期账号失败", zap.Error(err))
+		} else if n > 0 {
+			common.Logger.Info("到期账号已恢复正常", zap.Int("reactivated", n))
+		}
+
+		if n, err := s.ProcessScheduledDeletions(); err != nil {
+			common.Logger.Error("执行计划注销失败", zap.Error(err))
+		} else if n > 0 {
+			common.Logger.Info("计划注销执行完成", zap.Int("deleted", n))
+		}
+
+		if n, err := s.CleanupExpiredExports(); err != nil {
+			common.Logger.Error("清理过期导出文件失败", zap.Error(err))
+		} else if n > 0 {
+			common.Logger.Info("过期导出文件已清理", zap.Int("removed", n))
+		}
+
+		days := common.Conf.User.TrashRetentionDays
+		if days <= 0 {
+			continue
+		}
+		n, err := s.PurgeExpiredUsers(time.Duration(days) * 24 * time.Hour)
+		if err != nil {
+			common.Logger.Error("回收站清理失败", zap.Error(err))
+			continue
+		}
+		if n > 0 {
+			common.Logger.Info("回收站清理完成", zap.Int64("purged", n))
+		}
+	}
+}
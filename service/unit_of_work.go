@@ -0,0 +1,72 @@
+package service
+
+import "gin-crud/dao"
+
+// unitOfWork 一次事务中登记的提交后操作
+type unitOfWork struct {
+	effects []func(s *UserService)
+}
+
+// InTx 在同一事务中执行 fn，fn 通过传入的 tx 调用服务方法，tx 的 Repo 绑定在该事务上。
+// 缓存清除、检索索引更新和会话注销等副作用登记后在提交成功时按顺序执行，回滚时丢弃，
+// 避免其他请求在提交前把旧数据重新读入缓存，或读到最终未提交的数据。
+// tx 不读写缓存，查询直接访问数据库；在 tx 上再调用 InTx 时加入当前事务
+func (s *UserService) InTx(fn func(tx *UserService) error) error {
+	if s.uow != nil {
+		return fn(s)
+	}
+	uow := &unitOfWork{}
+	err := s.Repo.Transaction(func(repo dao.UserRepository) error {
+		return fn(&UserService{
+			Repo:   repo,
+			RDB:    s.RDB,
+			Blobs:  s.Blobs,
+			Mailer: s.Mailer,
+			Search: s.Search,
+			uow:    uow,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	for _, effect := range uow.effects {
+		effect(s)
+	}
+	return nil
+}
+
+// deferred 服务绑定在事务上时把 effect 登记到提交后由原服务执行并返回 true，
+// 否则返回 false，由调用方立即执行
+func (s *UserService) deferred(effect func(s *UserService)) bool {
+	if s.uow == nil {
+		return false
+	}
+	s.uow.effects = append(s.uow.effects, effect)
+	return true
+}
+
+// Primary 返回查询也使用主库的服务，与 s 共用缓存，用于刚写入过的客户端读到自己的修改。
+// 事务中的服务本就使用主库，返回自身
+func (s *UserService) Primary() *UserService {
+	if s.uow != nil {
+		return s
+	}
+	return &UserService{
+		Repo:   s.Repo.Primary(),
+		RDB:    s.RDB,
+		Blobs:  s.Blobs,
+		Mailer: s.Mailer,
+		Search: s.Search,
+		Cache:  s.Cache,
+		Local:  s.Local,
+		base:   s.root(),
+	}
+}
+
+// root 派生服务的 base，否则为自身
+func (s *UserService) root() *UserService {
+	if s.base != nil {
+		return s.base
+	}
+	return s
+}
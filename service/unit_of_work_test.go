@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gin-crud/cache"
+	"gin-crud/dao"
+	"gin-crud/models"
+	"gin-crud/search"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserService_InTx(t *testing.T) {
+	rdb, mr := mockRedis(t)
+	idx := search.NewMemoryIndex()
+	repo := dao.NewMemoryRepository()
+	userService := &UserService{Repo: repo, RDB: rdb, Cache: cache.NewRedis(rdb), Search: idx}
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", Password: "secret"}
+	assert.NoError(t, userService.Register(alice))
+	id := fmt.Sprintf("%d", alice.ID)
+	_, err := userService.GetUser(alice.PublicID)
+	assert.NoError(t, err)
+	assert.True(t, mr.Exists(userCacheKey(alice.PublicID)))
+
+	t.Run("Rollback", func(t *testing.T) {
+		errAbort := errors.New("abort")
+		bob := &models.User{Username: "bob", Email: "bob@example.com", Password: "secret"}
+		err := userService.InTx(func(tx *UserService) error {
+			if err := tx.Register(bob); err != nil {
+				return err
+			}
+			if err := tx.applyUpdate(id, nil, map[string]interface{}{"username": "alice2"}); err != nil {
+				return err
+			}
+			return errAbort
+		})
+		assert.ErrorIs(t, err, errAbort)
+
+		// 数据和副作用一起丢弃：缓存未被清除，索引中没有 bob
+		_, err = repo.GetUserByUsername("bob")
+		assert.Error(t, err)
+		user, err := repo.GetUserByID(id)
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", user.Username)
+		assert.True(t, mr.Exists(userCacheKey(alice.PublicID)))
+		res, _ := idx.Search(context.Background(), "bob", 1, 20)
+		assert.Equal(t, int64(0), res.Total)
+	})
+
+	t.Run("Commit", func(t *testing.T) {
+		err := userService.InTx(func(tx *UserService) error {
+			if err := tx.applyUpdate(id, nil, map[string]interface{}{"username": "alice2"}); err != nil {
+				return err
+			}
+			// 提交前缓存保持不变
+			assert.True(t, mr.Exists(userCacheKey(alice.PublicID)))
+			return tx.RevokeSessions(alice.ID, "")
+		})
+		assert.NoError(t, err)
+
+		assert.False(t, mr.Exists(userCacheKey(alice.PublicID)))
+		res, _ := idx.Search(context.Background(), "alice2", 1, 20)
+		assert.Equal(t, int64(1), res.Total)
+		user, err := userService.GetUser(alice.PublicID)
+		assert.NoError(t, err)
+		assert.Equal(t, "alice2", user.Username)
+	})
+}
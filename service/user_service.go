@@ -2,25 +2,45 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"gin-crud/cache"
 	"gin-crud/common"
 	"gin-crud/dao"
+	"gin-crud/mail"
 	"gin-crud/models"
+	"gin-crud/search"
+	"gin-crud/storage"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/sync/singleflight"
 	"gorm.io/gorm"
 )
 
 type UserService struct {
-	DB  *gorm.DB
-	RDB *redis.Client
+	Repo   dao.UserRepository
+	RDB    *redis.Client
+	Blobs  storage.BlobStore // 头像等文件的对象存储
+	Mailer mail.Mailer
+	Search search.Index // 用户全文检索，为空时不维护索引
+	Cache  cache.Cache  // 多实例共享的缓存，为空时不缓存
+	Local  *cache.LRU   // 共享缓存之前的进程内缓存，为空时不启用
+
+	flight     singleflight.Group // 合并同一缓存 key 的并发回源
+	cacheStats cacheCounters
+	uow        *unitOfWork  // 非空表示服务绑定在事务上，见 InTx
+	base       *UserService // 非空表示由 Primary 派生，回源合并和缓存统计使用 base 的
 }
 
+// ErrPreconditionFailed 条件请求的版本号与当前数据不一致
+var ErrPreconditionFailed = errors.New("用户已被修改，请刷新后重试")
+
 // TokenResponse 登录返回结构
 type TokenResponse struct {
 	AccessToken  string `json:"access_token"`
@@ -28,140 +48,491 @@ type TokenResponse struct {
 }
 
 // Register 注册业务逻辑
+// 用户名和邮箱的唯一性由数据库唯一索引保证，并发注册同名用户时只有一个能成功，
+// 冲突时返回 *common.ConflictError；注册方式不是开放注册时返回 ErrInviteOnly 或 ErrRegistrationClosed
 func (s *UserService) Register(user *models.User) error {
-	var count int64
-	s.DB.Model(&models.User{}).Where("username = ?", user.Username).Count(&count)
-	if count > 0 {
-		return errors.New("用户名已存在")
+	if err := checkOpenRegistration(); err != nil {
+		return err
 	}
-	return s.DB.Create(user).Error
+	// 角色和状态只能由管理员分配，注册时一律为正常状态的普通用户；公开 ID 一律由 BeforeCreate 生成
+	user.Role = models.RoleUser
+	user.Status = models.StatusActive
+	user.PublicID = ""
+	attrs, err := validateAttributes(nil, user.Attributes)
+	if err != nil {
+		return err
+	}
+	user.Attributes = attrs
+	return s.InTx(func(tx *UserService) error {
+		if err := tx.Repo.InsertUser(user); err != nil {
+			return err
+		}
+		tx.indexUser(user)
+		return nil
+	})
 }
 
+// ErrInvalidCredentials 登录失败时不区分用户不存在和密码错误，避免暴露哪些用户名已注册
+var ErrInvalidCredentials = errors.New("用户名或密码错误")
+
+// dummyPasswordHash 用户不存在时仍做一次同等成本的哈希比对，使两种失败的耗时一致
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+	return hash
+})
+
 // Login 登录业务逻辑 (返回双 Token)
 func (s *UserService) Login(username, password string) (*TokenResponse, error) {
-	var user models.User
-	if err := s.DB.Where("username = ?", username).First(&user).Error; err != nil {
+	user, err := s.Repo.GetUserByUsername(models.NormalizeUsername(username))
+	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("用户不存在")
+			bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+			return nil, ErrInvalidCredentials
 		}
 		return nil, err
 	}
-	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-	if err != nil {
-		return nil, errors.New("密码错误")
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
 	}
-
-	// 1. 生成 Access Token
-	accessToken, err := common.GenerateAccessToken(user.ID, user.Username)
-	if err != nil {
-		return nil, err
-	}
-
-	// 2. 生成 Refresh Token
-	refreshToken, err := common.GenerateRefreshToken()
-	if err != nil {
+	// 密码正确后再检查账号状态，避免向未知请求方泄露状态
+	if err := CheckActive(user); err != nil {
 		return nil, err
 	}
 
-	// 3. 将 Refresh Token 存入 Redis (有效期 7 天)
-	// Key: refresh_token:{token} -> Value: userID
-	err = s.RDB.Set(context.Background(), "refresh_token:"+refreshToken, user.ID, 7*24*time.Hour).Err()
-	if err != nil {
-		return nil, err
-	}
-
-	return &TokenResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-	}, nil
+	return s.createSession(user)
 }
 
 // RefreshToken 刷新 Access Token
 func (s *UserService) RefreshToken(refreshToken string) (string, error) {
 	// 1. 查 Redis
-	val, err := s.RDB.Get(context.Background(), "refresh_token:"+refreshToken).Result()
+	rdb, err := s.sessionStore()
+	if err != nil {
+		return "", err
+	}
+	val, err := rdb.Get(context.Background(), "refresh_token:"+refreshToken).Result()
 	if err == redis.Nil {
 		return "", errors.New("Refresh Token 无效或已过期")
 	}
 	if err != nil {
-		return "", err
+		return "", sessionError(err)
 	}
 
 	// 2. 获取 UserID
 	userID, _ := strconv.ParseUint(val, 10, 64)
 
 	// 3. 查用户信息 (确保用户没被封号)
-	user, err := dao.GetUserByID(fmt.Sprintf("%d", userID), s.DB)
+	user, err := s.Repo.GetUserByID(fmt.Sprintf("%d", userID))
 	if err != nil {
 		return "", errors.New("用户不存在")
 	}
+	if err := CheckActive(user); err != nil {
+		return "", err
+	}
 
-	// 4. 生成新的 Access Token
-	return common.GenerateAccessToken(user.ID, user.Username)
+	// 4. 生成新的 Access Token，沿用同一会话
+	return common.GenerateAccessToken(user.PublicID, user.Username, SessionID(refreshToken))
 }
 
 // Logout 登出
 func (s *UserService) Logout(refreshToken string) error {
-	return s.RDB.Del(context.Background(), "refresh_token:"+refreshToken).Err()
+	rdb, err := s.sessionStore()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	val, err := rdb.Get(ctx, "refresh_token:"+refreshToken).Result()
+	if err != nil {
+		return sessionError(err)
+	}
+	userID, _ := strconv.ParseUint(val, 10, 64)
+
+	pipe := rdb.TxPipeline()
+	pipe.Del(ctx, "refresh_token:"+refreshToken)
+	pipe.SRem(ctx, sessionsKey(uint(userID)), refreshToken)
+	_, err = pipe.Exec(ctx)
+	return sessionError(err)
 }
 
-// GetUser 获取单个用户 (带缓存)
+// cachedUser 缓存中的用户。User 的内部 ID 和头像不参与 JSON 序列化，需要单独保存
+type cachedUser struct {
+	InternalID uint   `json:"internal_id"`
+	Avatar     string `json:"avatar"`
+	*models.User
+}
+
+func newCachedUser(user *models.User) cachedUser {
+	return cachedUser{InternalID: user.ID, Avatar: user.Avatar, User: user}
+}
+
+// user 还原缓存中的用户，补回不参与序列化的字段
+func (c cachedUser) user() *models.User {
+	c.User.ID = c.InternalID
+	c.User.Avatar = c.Avatar
+	return c.User
+}
+
+func userCacheKey(publicID string) string {
+	return "user:" + publicID
+}
+
+// userCacheRefKey 内部 ID 到缓存 key 的反向索引，写操作只知道内部 ID，借此找到要清除的缓存
+func userCacheRefKey(id string) string {
+	return "user_ref:" + id
+}
+
+// GetUser 获取单个用户 (带缓存)，id 可以是公开 ID 或内部自增 ID。
+// 缓存以公开 ID 为 key，按内部 ID 查询时直接查库
 func (s *UserService) GetUser(id string) (*models.User, error) {
-	cacheKey := "user:" + id
-	val, err := s.RDB.Get(context.Background(), cacheKey).Result()
-	if err == nil {
-		var user models.User
-		if err := json.Unmarshal([]byte(val), &user); err == nil {
-			common.Logger.Info("Cache Hit: " + id)
-			return &user, nil
+	if !models.IsPublicID(id) {
+		user, err := s.Repo.GetUserByID(id)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errors.New("用户不存在")
+			}
+			return nil, err
 		}
+		return user, nil
 	}
 
-	common.Logger.Info("Cache Miss: " + id)
-	user, err := dao.GetUserByID(id, s.DB)
-	if err != nil {
+	load := func() (cachedUser, bool, error) {
+		user, err := s.Repo.Primary().GetUserByPublicID(id)
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("用户不存在")
+			return cachedUser{}, false, nil
+		}
+		if err != nil {
+			return cachedUser{}, false, err
 		}
+		return newCachedUser(user), true, nil
+	}
+	// 反向索引的有效期不短于缓存，保证写操作能找到要清除的缓存
+	ref := func(c cachedUser) []cache.Entry {
+		return []cache.Entry{{
+			Key:   userCacheRefKey(strconv.FormatUint(uint64(c.InternalID), 10)),
+			Value: []byte(c.PublicID),
+			TTL:   cachePolicyFor("user").maxTTL(),
+		}}
+	}
+	cached, found, err := fetchCachedWith(s, "user", userCacheKey(id), load, ref)
+	if err != nil {
 		return nil, err
 	}
+	if !found {
+		return nil, errors.New("用户不存在")
+	}
+	return cached.user(), nil
+}
+
+// maxBatchUsers GetUsers 一次最多查询的用户数
+const maxBatchUsers = 100
 
-	jsonBytes, _ := json.Marshal(user)
-	s.RDB.Set(context.Background(), cacheKey, jsonBytes, 10*time.Minute)
+// ErrTooManyUsers 批量查询的用户数超过上限
+var ErrTooManyUsers = fmt.Errorf("一次最多查询 %d 个用户", maxBatchUsers)
 
-	return user, nil
+// GetUsers 按公开 ID 批量获取用户 (带缓存)，按 ids 的顺序返回，不存在的用户和重复的 ID 被忽略。
+// 本地缓存未命中的部分一次 MGET 读取，共享缓存也未命中的部分一次查库，查询结果通过 pipeline 一次写回
+func (s *UserService) GetUsers(ids []string) ([]models.User, error) {
+	ctx := context.Background()
+	keys := make([]string, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if models.IsPublicID(id) && !seen[id] {
+			seen[id] = true
+			keys = append(keys, userCacheKey(id))
+		}
+	}
+	if len(keys) > maxBatchUsers {
+		return nil, ErrTooManyUsers
+	}
+
+	found := make(map[string]cachedUser, len(keys))
+	resolved := make(map[string]bool, len(keys))
+	pending := keys
+	if s.Local != nil {
+		pending = make([]string, 0, len(keys))
+		for _, key := range keys {
+			v, ok := s.Local.Get(key)
+			if !ok {
+				pending = append(pending, key)
+				continue
+			}
+			cached, ok, err := decodeEnvelope[cachedUser](v.(*cacheEnvelope))
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				found[key] = cached
+			}
+			resolved[key] = true
+		}
+	}
+
+	var missing []string
+	if len(pending) > 0 {
+		values, err := s.store().GetMany(ctx, pending)
+		if err != nil {
+			logCacheError("读取缓存失败", err)
+			values = make([][]byte, len(pending))
+		}
+		for i, key := range pending {
+			if values[i] != nil {
+				if env, cached, ok, decoded := openShared[cachedUser](s, ctx, "user", key, values[i]); decoded {
+					s.root().cacheStats.sharedHits.Add(1)
+					s.setLocal(key, env)
+					if ok {
+						found[key] = cached
+					}
+					resolved[key] = true
+					continue
+				}
+			}
+			s.root().cacheStats.sharedMisses.Add(1)
+			missing = append(missing, strings.TrimPrefix(key, userCacheKey("")))
+		}
+	}
+
+	if len(missing) > 0 {
+		if err := s.loadUsers(ctx, missing, found); err != nil {
+			return nil, err
+		}
+	}
+
+	users := make([]models.User, 0, len(found))
+	for _, key := range keys {
+		if cached, ok := found[key]; ok {
+			users = append(users, *cached.user())
+		}
+	}
+	return users, nil
+}
+
+// loadUsers 一次查库取得缓存未命中的用户，写回缓存（不存在的用户按策略缓存空值）并放入 found
+func (s *UserService) loadUsers(ctx context.Context, publicIDs []string, found map[string]cachedUser) error {
+	start := time.Now()
+	users, err := s.Repo.Primary().GetUsersByPublicIDs(publicIDs)
+	if err != nil {
+		return err
+	}
+	delta := time.Since(start)
+	byPublicID := make(map[string]*models.User, len(users))
+	for i := range users {
+		byPublicID[users[i].PublicID] = &users[i]
+	}
+
+	policy := cachePolicyFor("user")
+	entries := make([]cache.Entry, 0, 2*len(publicIDs))
+	for _, pid := range publicIDs {
+		key := userCacheKey(pid)
+		user, ok := byPublicID[pid]
+		var cached cachedUser
+		if ok {
+			cached = newCachedUser(user)
+			found[key] = cached
+		}
+		env, data, ttl, err := sealEnvelope("user", policy, cached, ok, delta)
+		if err != nil {
+			return err
+		}
+		if ttl <= 0 {
+			continue
+		}
+		entries = append(entries, cache.Entry{Key: key, Value: data, TTL: ttl})
+		if ok {
+			ref := userCacheRefKey(strconv.FormatUint(uint64(user.ID), 10))
+			entries = append(entries, cache.Entry{Key: ref, Value: []byte(pid), TTL: policy.maxTTL()})
+		}
+		s.setLocal(key, env)
+	}
+	logCacheError("写入缓存失败", s.store().SetMany(ctx, entries))
+	return nil
+}
+
+// AcceptsUserRef 判断接口传入的用户标识格式是否可接受：公开 ID，或过渡期内的自增 ID
+func AcceptsUserRef(ref string) bool {
+	if models.IsPublicID(ref) {
+		return true
+	}
+	_, err := strconv.ParseUint(ref, 10, 64)
+	return err == nil && common.Conf.User.AcceptLegacyIDs
+}
+
+// ResolveUserID 将接口传入的用户标识转换为内部 ID，包括已软删除的用户。
+// 公开 ID 与内部 ID 的对应关系不会改变，长期缓存；过渡期内自增 ID 原样返回
+func (s *UserService) ResolveUserID(ref string) (string, error) {
+	if !AcceptsUserRef(ref) {
+		return "", errors.New("用户不存在")
+	}
+	if !models.IsPublicID(ref) {
+		return ref, nil
+	}
+
+	id, found, err := fetchCached(s, "user_pid", "user_pid:"+ref, func() (uint, bool, error) {
+		id, err := s.Repo.Primary().FindUserIDByPublicID(ref)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, false, nil
+		}
+		return id, err == nil, err
+	})
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", errors.New("用户不存在")
+	}
+	return strconv.FormatUint(uint64(id), 10), nil
+}
+
+// invalidateUser 清除用户缓存，id 为内部 ID。反向索引随缓存写入且有效期不短于缓存，
+// 索引不存在时缓存也不存在；缓存不可用时查库取得公开 ID，由缓存在恢复后补删
+func (s *UserService) invalidateUser(id string) {
+	if s.deferred(func(s *UserService) { s.invalidateUser(id) }) {
+		return
+	}
+	ctx := context.Background()
+	ref, err := s.store().Get(ctx, userCacheRefKey(id))
+	publicID := string(ref)
+	switch {
+	case errors.Is(err, cache.ErrMiss):
+		return
+	case errors.Is(err, cache.ErrUnavailable):
+		user, err := s.Repo.GetUserByIDUnscoped(id)
+		if err != nil {
+			common.Logger.Error("清除用户缓存失败", zap.String("user_id", id), zap.Error(err))
+			return
+		}
+		publicID = user.PublicID
+	case err != nil:
+		common.Logger.Error("清除用户缓存失败", zap.String("user_id", id), zap.Error(err))
+		return
+	}
+	s.evictCache(ctx, userCacheKey(publicID), userCacheRefKey(id))
+}
+
+// refreshUser 写穿模式下用数据库中的最新值覆盖用户缓存，id 为内部 ID。
+// 写入后再核对一次版本号：并发更新时后写入缓存的可能是较旧的值，此时改为清除缓存
+func (s *UserService) refreshUser(id string) {
+	if s.deferred(func(s *UserService) { s.refreshUser(id) }) {
+		return
+	}
+	ctx := context.Background()
+	start := time.Now()
+	user, err := s.Repo.Primary().GetUserByID(id)
+	if err != nil {
+		common.Logger.Error("刷新用户缓存失败", zap.String("user_id", id), zap.Error(err))
+		s.invalidateUser(id)
+		return
+	}
+	policy := cachePolicyFor("user")
+	key := userCacheKey(user.PublicID)
+	_, data, ttl, err := sealEnvelope("user", policy, newCachedUser(user), true, time.Since(start))
+	if err == nil && ttl > 0 {
+		err = s.store().SetMany(ctx, []cache.Entry{
+			{Key: key, Value: data, TTL: ttl},
+			{Key: userCacheRefKey(id), Value: []byte(user.PublicID), TTL: policy.maxTTL()},
+		})
+	}
+	if err != nil || ttl <= 0 {
+		logCacheError("刷新用户缓存失败", err, zap.String("user_id", id))
+		s.invalidateUser(id)
+		return
+	}
+
+	version, err := s.Repo.Primary().GetUserVersion(id)
+	if err != nil || version != user.Version {
+		s.invalidateUser(id)
+		return
+	}
+	s.evictLocal(ctx, key)
 }
 
 // DeleteUser 删除用户
 func (s *UserService) DeleteUser(id string) error {
-	err := dao.DeleteUserByID(id, s.DB)
+	return s.DeleteUserIfMatch(id, nil)
+}
+
+// DeleteUserIfMatch 删除用户，versions 非空时只有当前版本号属于其中之一才删除，否则返回 ErrPreconditionFailed
+func (s *UserService) DeleteUserIfMatch(id string, versions []uint) error {
+	err := s.Repo.DeleteUserByID(id, versions)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return errors.New("用户不存在")
 		}
+		if errors.Is(err, dao.ErrVersionConflict) {
+			return ErrPreconditionFailed
+		}
 		return err
 	}
-	s.RDB.Del(context.Background(), "user:"+id)
+	s.invalidateUser(id)
+	s.unindexUser(id)
 	return nil
 }
 
+// updatableFields 普通更新接口可以修改的字段，其余字段（公开 ID、角色、状态、时间戳等）只能由内部流程修改，
+// 邮箱需通过 RequestEmailChange 验证后修改，密码需通过 ChangePassword 校验当前密码后修改
+var updatableFields = []string{"username", "attributes"}
+
 // UpdateUser 更新用户
 func (s *UserService) UpdateUser(id string, updateData map[string]interface{}) error {
-	if pwd, ok := updateData["password"].(string); ok && pwd != "" {
-		hash, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.DefaultCost)
+	return s.UpdateUserIfMatch(id, updateData, nil)
+}
+
+// UpdateUserIfMatch 更新用户，versions 非空时只有当前版本号属于其中之一才更新，否则返回 ErrPreconditionFailed
+func (s *UserService) UpdateUserIfMatch(id string, updateData map[string]interface{}, versions []uint) error {
+	// 只保留允许修改的字段，角色、版本号、唯一键等内部字段不能通过普通更新接口直接修改
+	allowed := make(map[string]interface{}, len(updatableFields))
+	for _, field := range updatableFields {
+		if v, ok := updateData[field]; ok {
+			allowed[field] = v
+		}
+	}
+	if len(allowed) == 0 {
+		return errors.New("没有可更新的字段")
+	}
+	updateData = allowed
+
+	// 用户名规范化后同步写入唯一键
+	if username, ok := updateData["username"].(string); ok {
+		username = models.NormalizeUsername(username)
+		updateData["username"] = username
+		updateData["unique_username"] = username
+	}
+
+	// 自定义属性按字段合并，合并后整体校验
+	if raw, ok := updateData["attributes"]; ok {
+		attrs, err := s.mergeUserAttributes(id, raw)
 		if err != nil {
 			return err
 		}
-		updateData["password"] = string(hash)
+		updateData["attributes"] = attrs
 	}
 
-	err := dao.UpdateUserByID(id, updateData, s.DB)
+	return s.applyUpdate(id, versions, updateData)
+}
+
+// searchFields 参与检索的字段，修改后需要更新检索索引
+var searchFields = []string{"username", "email"}
+
+// applyUpdate 写入已校验的字段并清除缓存，供内部流程直接修改受保护字段
+func (s *UserService) applyUpdate(id string, versions []uint, updateData map[string]interface{}) error {
+	err := s.Repo.UpdateUserByID(id, versions, updateData)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return errors.New("用户不存在")
 		}
+		if errors.Is(err, dao.ErrVersionConflict) {
+			return ErrPreconditionFailed
+		}
 		return err
 	}
-	s.RDB.Del(context.Background(), "user:"+id)
+	if common.Conf.Cache.WriteThrough {
+		s.refreshUser(id)
+	} else {
+		s.invalidateUser(id)
+	}
+	for _, field := range searchFields {
+		if _, ok := updateData[field]; ok {
+			s.reindexUser(id)
+			break
+		}
+	}
 	return nil
 }
@@ -1,15 +1,31 @@
 package service
 
 import (
+	"context"
+	"gin-crud/cache"
+	"gin-crud/common"
+	"gin-crud/dao"
 	"gin-crud/models"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	mysqlDriver "github.com/go-sql-driver/mysql"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
+func TestMain(m *testing.M) {
+	// 测试中不初始化文件日志和配置文件，使用空 Logger 和最小配置
+	common.Logger = zap.NewNop()
+	common.Conf = &common.Config{Jwt: common.Jwt{Secret: "test-secret"}}
+	os.Exit(m.Run())
+}
+
 // mockDB 创建一个 Mock 的 GORM DB 实例
 func mockDB() (*gorm.DB, sqlmock.Sqlmock, error) {
 	db, mock, err := sqlmock.New()
@@ -31,7 +47,8 @@ func TestUserService_GetUser(t *testing.T) {
 		t.Fatalf("failed to mock db: %v", err)
 	}
 
-	userService := &UserService{DB: db}
+	rdb, _ := mockRedis(t)
+	userService := &UserService{Repo: dao.NewGormRepository(db), RDB: rdb, Cache: cache.NewRedis(rdb)}
 
 	t.Run("UserExists", func(t *testing.T) {
 		userID := "123"
@@ -74,6 +91,246 @@ func TestUserService_GetUser(t *testing.T) {
 		assert.Equal(t, "用户不存在", err.Error())
 	})
 
+	t.Run("ByPublicIDCached", func(t *testing.T) {
+		pid, err := models.NewPublicID(time.Now())
+		assert.NoError(t, err)
+
+		mock.ExpectQuery("^SELECT \\* FROM `users` WHERE public_id = \\? AND `users`.`deleted_at` IS NULL").
+			WithArgs(pid, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "public_id", "username"}).AddRow(42, pid, "alice"))
+
+		// 第二次读取命中缓存，内部 ID 随缓存一起恢复
+		for i := 0; i < 2; i++ {
+			user, err := userService.GetUser(pid)
+			assert.NoError(t, err)
+			if assert.NotNil(t, user) {
+				assert.Equal(t, uint(42), user.ID)
+				assert.Equal(t, pid, user.PublicID)
+			}
+		}
+
+		userService.invalidateUser("42")
+		assert.Equal(t, int64(0), rdb.Exists(context.Background(), userCacheKey(pid)).Val())
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserService_ResolveUserID(t *testing.T) {
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+
+	rdb, _ := mockRedis(t)
+	userService := &UserService{Repo: dao.NewGormRepository(db), RDB: rdb, Cache: cache.NewRedis(rdb)}
+	pid, _ := models.NewPublicID(time.Now())
+
+	t.Run("PublicID", func(t *testing.T) {
+		mock.ExpectQuery("^SELECT `id` FROM `users` WHERE public_id = \\?").
+			WithArgs(pid, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+
+		// 对应关系不会改变，第二次解析不查库
+		for i := 0; i < 2; i++ {
+			id, err := userService.ResolveUserID(pid)
+			assert.NoError(t, err)
+			assert.Equal(t, "7", id)
+		}
+	})
+
+	t.Run("LegacyID", func(t *testing.T) {
+		defer func(v bool) { common.Conf.User.AcceptLegacyIDs = v }(common.Conf.User.AcceptLegacyIDs)
+		common.Conf.User.AcceptLegacyIDs = true
+		id, err := userService.ResolveUserID("7")
+		assert.NoError(t, err)
+		assert.Equal(t, "7", id)
+
+		common.Conf.User.AcceptLegacyIDs = false
+		_, err = userService.ResolveUserID("7")
+		assert.EqualError(t, err, "用户不存在")
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		_, err := userService.ResolveUserID("not-an-id")
+		assert.EqualError(t, err, "用户不存在")
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserService_Login(t *testing.T) {
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+
+	userService := &UserService{Repo: dao.NewGormRepository(db)}
+	selectSQL := "^SELECT \\* FROM `users` WHERE username = \\?"
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+
+	// 用户不存在和密码错误返回同一个错误
+	mock.ExpectQuery(selectSQL).WithArgs("nobody", 1).WillReturnError(gorm.ErrRecordNotFound)
+	_, err = userService.Login("nobody", "secret")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	mock.ExpectQuery(selectSQL).WithArgs("alice", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password"}).AddRow(1, "alice", string(hash)))
+	_, err = userService.Login("Alice", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserService_Register(t *testing.T) {
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+
+	userService := &UserService{Repo: dao.NewGormRepository(db)}
+	insertSQL := "^INSERT INTO `users` \\(`created_at`,`updated_at`,`deleted_at`,`public_id`,`username`,`email`,`password`,`role`,`version`," +
+		"`status`,`status_reason`,`status_expires_at`,`deletion_scheduled_at`,`attributes`,`avatar`,`erased_at`,`unique_username`,`unique_email`\\)"
+
+	t.Run("Normalized", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(insertSQL).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, sqlmock.AnyArg(), "alice", "alice@example.com", sqlmock.AnyArg(), "user", 1,
+				"active", "", nil, nil, nil, "", nil, "alice", "alice@example.com").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		chosen := "0192f5a8-7c00-7000-8000-000000000001"
+		user := &models.User{PublicID: chosen, Username: "  ＡLICE ", Email: "Alice@Example.com", Password: "password123", Role: "admin"}
+		err := userService.Register(user)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", user.Username)
+		assert.Equal(t, "alice@example.com", user.Email)
+		if assert.NotNil(t, user.UniqueUsername) {
+			assert.Equal(t, "alice", *user.UniqueUsername)
+		}
+		assert.Equal(t, models.RoleUser, user.Role)
+		// 公开 ID 由服务端生成，忽略客户端传入的值
+		assert.NotEqual(t, chosen, user.PublicID)
+		assert.True(t, models.IsPublicID(user.PublicID))
+	})
+
+	t.Run("DuplicateEmail", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(insertSQL).
+			WillReturnError(&mysqlDriver.MySQLError{Number: 1062, Message: "Duplicate entry 'bob@example.com' for key 'users.uk_users_email'"})
+		mock.ExpectRollback()
+
+		err := userService.Register(&models.User{Username: "bob", Email: "bob@example.com", Password: "password123"})
+
+		var conflict *common.ConflictError
+		if assert.ErrorAs(t, err, &conflict) {
+			assert.Equal(t, "email", conflict.Field)
+			assert.Equal(t, "邮箱已存在", err.Error())
+		}
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserService_RestoreUser(t *testing.T) {
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+
+	rdb, mr := mockRedis(t)
+	userService := &UserService{Repo: dao.NewGormRepository(db), RDB: rdb, Cache: cache.NewRedis(rdb)}
+	restoreSQL := "^UPDATE `users` SET `deleted_at`=\\?,.*`unique_email`=email,`unique_username`=username,.* WHERE id = \\? AND deleted_at IS NOT NULL$"
+
+	t.Run("UsernameTaken", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(restoreSQL).
+			WillReturnError(&mysqlDriver.MySQLError{Number: 1062, Message: "Duplicate entry 'tester' for key 'users.uk_users_username'"})
+		mock.ExpectRollback()
+
+		err := userService.RestoreUser("7")
+
+		assert.EqualError(t, err, "用户名已存在")
+	})
+
+	t.Run("Restored", func(t *testing.T) {
+		pid := "0192f5a8-7c00-7000-8000-000000000008"
+		mr.Set(userCacheKey(pid), `{"missing":true}`)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(restoreSQL).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery("^SELECT \\* FROM `users` WHERE `users`.`id` = \\?").
+			WithArgs("8", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "public_id"}).AddRow(8, pid))
+
+		assert.NoError(t, userService.RestoreUser("8"))
+		assert.False(t, mr.Exists(userCacheKey(pid)))
+	})
+
+	t.Run("NotInTrash", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(restoreSQL).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		assert.EqualError(t, userService.RestoreUser("9"), "用户不存在")
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserService_UpdateUserIfMatch(t *testing.T) {
+	db, mock, err := mockDB()
+	if err != nil {
+		t.Fatalf("failed to mock db: %v", err)
+	}
+
+	userService := &UserService{Repo: dao.NewGormRepository(db)}
+	updateSQL := "^UPDATE `users` SET `unique_username`=\\?,`username`=\\?,`version`=version \\+ 1,`updated_at`=\\? WHERE id = \\? AND version IN \\(\\?\\) AND `users`.`deleted_at` IS NULL$"
+
+	t.Run("VersionMismatch", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(updateSQL).
+			WithArgs("newname", "newname", sqlmock.AnyArg(), "5", 3).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		mock.ExpectQuery("^SELECT count\\(\\*\\) FROM `users` WHERE id = \\?").
+			WithArgs("5").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+		err := userService.UpdateUserIfMatch("5", map[string]interface{}{"username": " NewName "}, []uint{3})
+
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(updateSQL).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		mock.ExpectQuery("^SELECT count\\(\\*\\) FROM `users` WHERE id = \\?").
+			WithArgs("6").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+		err := userService.UpdateUserIfMatch("6", map[string]interface{}{"username": "newname"}, []uint{3})
+
+		assert.EqualError(t, err, "用户不存在")
+	})
+
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStore_PutGetDelete(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), "http://example.com/blobs", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "avatars/1/a/original.jpg", strings.NewReader("hello"), 5, "image/jpeg"); err != nil {
+		t.Fatalf("Put 失败: %v", err)
+	}
+	r, err := store.Get(ctx, "avatars/1/a/original.jpg")
+	if err != nil {
+		t.Fatalf("Get 失败: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "hello" {
+		t.Errorf("内容不一致: %q", data)
+	}
+
+	if err := store.Delete(ctx, "avatars/1/a/original.jpg"); err != nil {
+		t.Fatalf("Delete 失败: %v", err)
+	}
+	if _, err := store.Get(ctx, "avatars/1/a/original.jpg"); err != ErrNotFound {
+		t.Errorf("删除后应返回 ErrNotFound，实际 %v", err)
+	}
+	// 重复删除不报错
+	if err := store.Delete(ctx, "avatars/1/a/original.jpg"); err != nil {
+		t.Errorf("重复删除不应报错: %v", err)
+	}
+
+	if err := store.Put(ctx, "../escape", strings.NewReader("x"), 1, ""); err == nil {
+		t.Error("越出根目录的 key 应被拒绝")
+	}
+}
+
+func TestLocalStore_SignedURL(t *testing.T) {
+	store, _ := NewLocalStore(t.TempDir(), "http://example.com/blobs", "secret")
+	ctx := context.Background()
+	store.Put(ctx, "a/b.jpg", strings.NewReader("img"), 3, "image/jpeg")
+	srv := http.StripPrefix("/blobs", store.Handler())
+
+	get := func(rawURL string) *httptest.ResponseRecorder {
+		u, _ := url.Parse(rawURL)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest("GET", u.RequestURI(), nil))
+		return w
+	}
+
+	signed, _ := store.SignedURL(ctx, "a/b.jpg", time.Minute)
+	if w := get(signed); w.Code != 200 || w.Body.String() != "img" {
+		t.Errorf("有效签名应返回文件，实际 %d %q", w.Code, w.Body.String())
+	}
+
+	if w := get(strings.Replace(signed, "sig=", "sig=0", 1)); w.Code != http.StatusForbidden {
+		t.Errorf("篡改签名应返回 403，实际 %d", w.Code)
+	}
+	if w := get(strings.Replace(signed, "a/b.jpg", "a/c.jpg", 1)); w.Code != http.StatusForbidden {
+		t.Errorf("签名不能用于其它 key，实际 %d", w.Code)
+	}
+
+	expired, _ := store.SignedURL(ctx, "a/b.jpg", -time.Minute)
+	if w := get(expired); w.Code != http.StatusForbidden {
+		t.Errorf("过期签名应返回 403，实际 %d", w.Code)
+	}
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("对象不存在")
+
+// BlobStore 二进制对象存储，key 使用 / 分隔的相对路径（如 avatars/1/abc/64.jpg）
+type BlobStore interface {
+	// Put 写入对象，size 未知时传 -1
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get 读取对象，调用方负责关闭
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete 删除对象，对象不存在时不报错
+	Delete(ctx context.Context, key string) error
+	// SignedURL 生成带有效期的访问地址
+	SignedURL(ctx context.Context, key string, expires time.Duration) (string, error)
+}
+
+// cleanKey 规范化 key 并拒绝越出存储根目录的路径
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || strings.Contains(key, "..") {
+		return "", errors.New("非法的对象 key")
+	}
+	return cleaned, nil
+}